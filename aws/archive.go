@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	magicZip = []byte("PK\x03\x04")
+	magicTar = []byte("ustar")
+)
+
+// tarMagicOffset offset of magic bytes on tar headers
+const tarMagicOffset = 257
+
+// ArchiveMemberHandler handles each file contained on an archive. r must not be used once
+// handler returns
+type ArchiveMemberHandler func(member string, r io.Reader) error
+
+// ReadArchive calls mh for each regular file contained on r when it is a zip or tar archive
+// (already decompressed). Members are decompressed if needed. When r is not an archive, mh is
+// called once with an empty member name and the whole content
+func ReadArchive(r io.Reader, mh ArchiveMemberHandler) error {
+	br := bufio.NewReaderSize(r, peekSize)
+	header := peek(br)
+	switch {
+	case bytes.HasPrefix(header, magicZip):
+		return readZip(br, mh)
+	case len(header) >= tarMagicOffset+len(magicTar) &&
+		bytes.Equal(header[tarMagicOffset:tarMagicOffset+len(magicTar)], magicTar):
+		return readTar(br, mh)
+	}
+	return mh("", br)
+}
+
+// readZip reads a zip archive. As zip needs random access, content is copied to a temporary file
+func readZip(r io.Reader, mh ArchiveMemberHandler) error {
+	f, err := ioutil.TempFile("", "s3logsbeat-zip-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("Could not open archive member %s: %v", zf.Name, err)
+		}
+		err = readMember(zf.Name, rc, mh)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTar reads a tar archive
+func readTar(r io.Reader, mh ArchiveMemberHandler) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := readMember(h.Name, tr, mh); err != nil {
+			return err
+		}
+	}
+}
+
+// readMember decompresses (if needed) a member of an archive and passes it to mh
+func readMember(member string, r io.Reader, mh ArchiveMemberHandler) error {
+	dr, err := newDecompressReader(r, "")
+	if err != nil {
+		return fmt.Errorf("Could not decompress archive member %s: %v", member, err)
+	}
+	defer dr.Close()
+	return mh(member, dr)
+}
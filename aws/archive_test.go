@@ -0,0 +1,76 @@
+// +build !integration
+
+package aws
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readArchive(t *testing.T, b []byte) map[string]string {
+	rc, err := NewS3ReadCloser(ioutil.NopCloser(bytes.NewReader(b)), "")
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer rc.Close()
+
+	members := map[string]string{}
+	err = ReadArchive(rc, func(member string, r io.Reader) error {
+		c, err := ioutil.ReadAll(r)
+		members[member] = string(c)
+		return err
+	})
+	assert.NoError(t, err)
+	return members
+}
+
+func TestReadArchiveNoArchive(t *testing.T) {
+	assert.Equal(t, map[string]string{"": content}, readArchive(t, compress(t, CodecGzip)))
+}
+
+func TestReadArchiveZip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	_, err := w.Create("dir/")
+	assert.NoError(t, err)
+	f, err := w.Create("dir/a.log")
+	assert.NoError(t, err)
+	f.Write([]byte(content))
+	f, err = w.Create("b.log.gz")
+	assert.NoError(t, err)
+	f.Write(compress(t, CodecGzip))
+	assert.NoError(t, w.Close())
+
+	expected := map[string]string{
+		"dir/a.log": content,
+		"b.log.gz":  content,
+	}
+	assert.Equal(t, expected, readArchive(t, buf.Bytes()))
+}
+
+func TestReadArchiveTarGz(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	assert.NoError(t, w.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for _, name := range []string{"dir/a.log", "b.log"} {
+		assert.NoError(t, w.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+		_, err := w.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, gz.Close())
+
+	expected := map[string]string{
+		"dir/a.log": content,
+		"b.log":     content,
+	}
+	assert.Equal(t, expected, readArchive(t, buf.Bytes()))
+}
@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Compression codecs supported on objects
+const (
+	CodecNone   = ""
+	CodecGzip   = "gzip"
+	CodecBzip2  = "bzip2"
+	CodecZstd   = "zstd"
+	CodecSnappy = "snappy"
+	CodecLZ4    = "lz4"
+)
+
+// peekSize number of bytes read in advance to detect codecs and archives (tar magic is at offset 257)
+const peekSize = 512
+
+var (
+	magicGzip   = []byte{0x1f, 0x8b}
+	magicBzip2  = []byte("BZh")
+	magicZstd   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicSnappy = []byte("\xff\x06\x00\x00sNaPpY")
+	magicLZ4    = []byte{0x04, 0x22, 0x4d, 0x18}
+
+	// bzip2 block header (pi), present after stream header ("BZh" + block size)
+	magicBzip2Block = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+
+	// contentEncodings maps Content-Encoding values to codecs
+	contentEncodings = map[string]string{
+		"gzip":    CodecGzip,
+		"x-gzip":  CodecGzip,
+		"bzip2":   CodecBzip2,
+		"x-bzip2": CodecBzip2,
+		"zstd":    CodecZstd,
+		"snappy":  CodecSnappy,
+		"lz4":     CodecLZ4,
+	}
+)
+
+// detectCodec detects the codec of content based on its first bytes (header). Content-Encoding (hint)
+// is only used when header does not match any known magic bytes
+func detectCodec(header []byte, hint string) string {
+	switch {
+	case bytes.HasPrefix(header, magicGzip):
+		return CodecGzip
+	case bytes.HasPrefix(header, magicBzip2) && len(header) >= 10 &&
+		header[3] >= '1' && header[3] <= '9' && bytes.Equal(header[4:10], magicBzip2Block):
+		return CodecBzip2
+	case bytes.HasPrefix(header, magicZstd):
+		return CodecZstd
+	case bytes.HasPrefix(header, magicSnappy):
+		return CodecSnappy
+	case bytes.HasPrefix(header, magicLZ4):
+		return CodecLZ4
+	}
+	if hint == "" {
+		return CodecNone
+	}
+	for _, e := range strings.Split(hint, ",") {
+		if codec, ok := contentEncodings[strings.ToLower(strings.TrimSpace(e))]; ok {
+			return codec
+		}
+	}
+	return CodecNone
+}
+
+// peek obtains the first bytes of r without consuming them
+func peek(r *bufio.Reader) []byte {
+	header, _ := r.Peek(peekSize)
+	return header
+}
+
+// newDecompressReader wraps r decompressing its content based on detected codec
+func newDecompressReader(r io.Reader, hint string) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, peekSize)
+	codec := detectCodec(peek(br), hint)
+	if codec != CodecNone {
+		logp.Debug("s3logsbeat", "Content detected as %s", codec)
+	}
+	return newCodecReader(br, codec, false)
+}
+
+// newCodecReader wraps r decompressing its content with codec. If parallel is set, gzip content
+// is decompressed in separate goroutines, reading blocks ahead
+func newCodecReader(br io.Reader, codec string, parallel bool) (io.ReadCloser, error) {
+	switch codec {
+	case CodecGzip:
+		if parallel {
+			return pgzip.NewReader(br)
+		}
+		return gzip.NewReader(br)
+	case CodecBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	case CodecZstd:
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case CodecSnappy:
+		return ioutil.NopCloser(snappy.NewReader(br)), nil
+	case CodecLZ4:
+		return ioutil.NopCloser(lz4.NewReader(br)), nil
+	case CodecNone:
+		return ioutil.NopCloser(br), nil
+	}
+	return nil, fmt.Errorf("Unsupported codec %s", codec)
+}
@@ -0,0 +1,84 @@
+// +build !integration
+
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const content = "line 1\nline 2\n"
+
+// bzip2Content content compressed with bzip2 (there is no bzip2 writer on standard library)
+const bzip2Content = "QlpoOTFBWSZTWTGIIWgAAAVZAAAQQAAwAAIlIAAxDAgShkaJMZCHEPF3JFOFCQMYghaA"
+
+func compress(t *testing.T, codec string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch codec {
+	case CodecGzip:
+		w = gzip.NewWriter(&buf)
+	case CodecZstd:
+		var err error
+		w, err = zstd.NewWriter(&buf)
+		assert.NoError(t, err)
+	case CodecSnappy:
+		w = snappy.NewBufferedWriter(&buf)
+	case CodecLZ4:
+		w = lz4.NewWriter(&buf)
+	case CodecBzip2:
+		b, err := base64.StdEncoding.DecodeString(bzip2Content)
+		assert.NoError(t, err)
+		return b
+	default:
+		return []byte(content)
+	}
+	_, err := w.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, b []byte, contentEncoding string) string {
+	rc, err := NewS3ReadCloser(ioutil.NopCloser(bytes.NewReader(b)), contentEncoding)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer rc.Close()
+	r, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	return string(r)
+}
+
+func TestDetectCodec(t *testing.T) {
+	for _, codec := range []string{CodecNone, CodecGzip, CodecBzip2, CodecZstd, CodecSnappy, CodecLZ4} {
+		b := compress(t, codec)
+		assert.Equal(t, codec, detectCodec(b, ""), "codec %s", codec)
+		assert.Equal(t, content, readAll(t, b, ""), "codec %s", codec)
+	}
+}
+
+func TestDetectCodecContentEncodingHint(t *testing.T) {
+	// Content has precedence over hint
+	assert.Equal(t, CodecNone, detectCodec([]byte(content), ""))
+	assert.Equal(t, CodecGzip, detectCodec(compress(t, CodecGzip), "zstd"))
+	assert.Equal(t, CodecZstd, detectCodec([]byte{}, "x-custom, zstd"))
+	assert.Equal(t, CodecNone, detectCodec([]byte(content), "identity"))
+
+	// Plain text starting as bzip2 stream header
+	assert.Equal(t, CodecNone, detectCodec([]byte("BZh9 is not bzip2\n"), ""))
+}
+
+func TestNewS3ReadCloserInvalidContent(t *testing.T) {
+	_, err := NewS3ReadCloser(ioutil.NopCloser(bytes.NewReader([]byte(content))), "gzip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+package aws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+const webIdentityProviderName = "WebIdentityProvider"
+
+// SessionConfig configures the AWS session used by an input. Credentials are obtained from (by priority):
+// 1. Web identity token file (requires role_arn)
+// 2. Shared credentials file and/or profile
+// 3. SDK default credential chain
+// If role_arn is set (and no web identity token file is used), that role is assumed using previous credentials
+type SessionConfig struct {
+	Region               string        `config:"region"`
+	Profile              string        `config:"profile"`
+	CredentialsFile      string        `config:"credentials_file"`
+	RoleARN              string        `config:"role_arn"`
+	ExternalID           string        `config:"external_id"`
+	RoleSessionName      string        `config:"role_session_name"`
+	AssumeRoleDuration   time.Duration `config:"assume_role_duration" validate:"min=0"`
+	WebIdentityTokenFile string        `config:"web_identity_token_file"`
+
+	// Settings for S3-compatible storages and private networks. Endpoint, path style and SSL are only
+	// applied to S3 and SQS clients of the input
+	Endpoint         string `config:"endpoint"`
+	S3ForcePathStyle bool   `config:"s3_force_path_style"`
+	DisableSSL       bool   `config:"disable_ssl"`
+	CABundle         string `config:"ca_bundle"`
+	ProxyURL         string `config:"proxy_url"`
+}
+
+// Validate validates session config logic
+func (c *SessionConfig) Validate() error {
+	if c.WebIdentityTokenFile != "" && c.RoleARN == "" {
+		return fmt.Errorf("web_identity_token_file requires role_arn")
+	}
+	if c.ExternalID != "" && c.RoleARN == "" {
+		return fmt.Errorf("external_id requires role_arn")
+	}
+	if c.ProxyURL != "" {
+		if _, err := url.Parse(c.ProxyURL); err != nil {
+			return fmt.Errorf("Invalid proxy_url %s: %v", c.ProxyURL, err)
+		}
+	}
+	return nil
+}
+
+// NewSessionFromConfig creates an AWS session from config. If no region is set, it is based on the
+// default session (see NewSession), otherwise region is not looked up on EC2 metadata.
+// Credentials are cached on the session and refreshed when they expire. Endpoint settings are not
+// applied (see ClientSession), as this session is also used by STS, KMS and the dead-letter sink
+func NewSessionFromConfig(c *SessionConfig) (*session.Session, error) {
+	config := aws.NewConfig()
+	if c.CABundle != "" || c.ProxyURL != "" {
+		httpClient, err := c.httpClient()
+		if err != nil {
+			return nil, err
+		}
+		config.WithHTTPClient(httpClient)
+	}
+
+	var base *session.Session
+	if c.Region != "" {
+		config.WithRegion(c.Region)
+		var err error
+		if base, err = session.NewSession(config); err != nil {
+			return nil, err
+		}
+	} else {
+		base = NewSession().Copy(config)
+	}
+
+	var creds *credentials.Credentials
+	switch {
+	case c.WebIdentityTokenFile != "":
+		creds = credentials.NewCredentials(&webIdentityProvider{
+			client:      sts.New(base),
+			roleARN:     c.RoleARN,
+			sessionName: c.roleSessionName(),
+			tokenFile:   c.WebIdentityTokenFile,
+			duration:    c.AssumeRoleDuration,
+		})
+	case c.Profile != "" || c.CredentialsFile != "":
+		creds = credentials.NewSharedCredentials(c.CredentialsFile, c.Profile)
+	}
+
+	if c.RoleARN != "" && c.WebIdentityTokenFile == "" {
+		source := base
+		if creds != nil {
+			source = base.Copy(&aws.Config{Credentials: creds})
+		}
+		creds = stscreds.NewCredentials(source, c.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = c.roleSessionName()
+			if c.ExternalID != "" {
+				p.ExternalID = aws.String(c.ExternalID)
+			}
+			if c.AssumeRoleDuration > 0 {
+				p.Duration = c.AssumeRoleDuration
+			}
+		})
+	}
+
+	if creds != nil {
+		return base.Copy(&aws.Config{Credentials: creds}), nil
+	}
+	return base, nil
+}
+
+// ClientSession obtains a copy of sess used by the S3 and SQS clients of the input, which connect to
+// the endpoint of config (if set)
+func (c *SessionConfig) ClientSession(sess *session.Session) *session.Session {
+	config := aws.NewConfig()
+	if c.Endpoint != "" {
+		config.WithEndpoint(c.Endpoint)
+	}
+	if c.S3ForcePathStyle {
+		config.WithS3ForcePathStyle(true)
+	}
+	if c.DisableSSL {
+		config.WithDisableSSL(true)
+	}
+	return sess.Copy(config)
+}
+
+// httpClient creates the HTTP client used by AWS clients, trusting certificates of CA bundle and
+// using proxy (if set)
+func (c *SessionConfig) httpClient() (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if c.ProxyURL != "" {
+		proxyURL, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if c.CABundle != "" {
+		pem, err := ioutil.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CA bundle %s: %v", c.CABundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found on CA bundle %s", c.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func (c *SessionConfig) roleSessionName() string {
+	if c.RoleSessionName != "" {
+		return c.RoleSessionName
+	}
+	return fmt.Sprintf("s3logsbeat-%d", time.Now().UTC().UnixNano())
+}
+
+// webIdentityProvider obtains credentials assuming a role with the web identity token present on a
+// file (e.g. projected service account tokens on Kubernetes), read again on each refresh
+type webIdentityProvider struct {
+	credentials.Expiry
+	client      stsiface.STSAPI
+	roleARN     string
+	sessionName string
+	tokenFile   string
+	duration    time.Duration
+}
+
+// Retrieve assumes the role with the web identity token
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return credentials.Value{ProviderName: webIdentityProviderName}, fmt.Errorf("Could not read web identity token file %s: %v", p.tokenFile, err)
+	}
+	input := &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.roleARN),
+		RoleSessionName:  aws.String(p.sessionName),
+		WebIdentityToken: aws.String(strings.TrimSpace(string(token))),
+	}
+	if p.duration > 0 {
+		input.DurationSeconds = aws.Int64(int64(p.duration / time.Second))
+	}
+	out, err := p.client.AssumeRoleWithWebIdentity(input)
+	if err != nil {
+		return credentials.Value{ProviderName: webIdentityProviderName}, err
+	}
+
+	// Refresh credentials one minute before they expire
+	p.SetExpiration(aws.TimeValue(out.Credentials.Expiration), time.Minute)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(out.Credentials.SessionToken),
+		ProviderName:    webIdentityProviderName,
+	}, nil
+}
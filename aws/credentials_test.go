@@ -0,0 +1,186 @@
+// +build !integration
+
+package aws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSTS struct {
+	stsiface.STSAPI
+	requests []*sts.AssumeRoleWithWebIdentityInput
+}
+
+func (f *fakeSTS) AssumeRoleWithWebIdentity(input *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	f.requests = append(f.requests, input)
+	return &sts.AssumeRoleWithWebIdentityOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("AKIDWEB"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func TestSessionConfigValidate(t *testing.T) {
+	assert.NoError(t, (&SessionConfig{}).Validate())
+	assert.NoError(t, (&SessionConfig{RoleARN: "arn:aws:iam::123456789012:role/logs", ExternalID: "id"}).Validate())
+	assert.Error(t, (&SessionConfig{WebIdentityTokenFile: "/var/run/token"}).Validate())
+	assert.Error(t, (&SessionConfig{ExternalID: "id"}).Validate())
+	assert.Error(t, (&SessionConfig{ProxyURL: "http://proxy:port"}).Validate())
+}
+
+func TestWebIdentityProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("mytoken\n"), 0600))
+
+	client := &fakeSTS{}
+	p := &webIdentityProvider{
+		client:      client,
+		roleARN:     "arn:aws:iam::123456789012:role/logs",
+		sessionName: "mysession",
+		tokenFile:   tokenFile,
+		duration:    time.Hour,
+	}
+	assert.True(t, p.IsExpired())
+	v, err := p.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDWEB", v.AccessKeyID)
+	assert.Equal(t, "token", v.SessionToken)
+	assert.False(t, p.IsExpired())
+	if assert.Len(t, client.requests, 1) {
+		r := client.requests[0]
+		assert.Equal(t, "mytoken", aws.StringValue(r.WebIdentityToken))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/logs", aws.StringValue(r.RoleArn))
+		assert.Equal(t, "mysession", aws.StringValue(r.RoleSessionName))
+		assert.Equal(t, int64(3600), aws.Int64Value(r.DurationSeconds))
+	}
+
+	// Token is read again on each refresh
+	os.Remove(tokenFile)
+	_, err = p.Retrieve()
+	assert.Error(t, err)
+}
+
+// setTestEnv sets environment variable key to value. Returns the function which restores its previous value
+func setTestEnv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestNewSessionFromSharedCredentials(t *testing.T) {
+	defer setTestEnv("AWS_REGION", "eu-west-1")()
+	dir, err := ioutil.TempDir("", "s3logsbeat-credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	credentialsFile := filepath.Join(dir, "credentials")
+	assert.NoError(t, ioutil.WriteFile(credentialsFile, []byte("[logs]\naws_access_key_id = AKIDLOGS\naws_secret_access_key = secret\n"), 0600))
+
+	s, err := NewSessionFromConfig(&SessionConfig{
+		Region:          "us-east-1",
+		Profile:         "logs",
+		CredentialsFile: credentialsFile,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", aws.StringValue(s.Config.Region))
+	v, err := s.Config.Credentials.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDLOGS", v.AccessKeyID)
+
+	// Default session is not created (so it does not take the region of this test)
+	assert.Nil(t, sess)
+}
+
+func TestNewSessionWithEndpoint(t *testing.T) {
+	c := &SessionConfig{
+		Region:           "us-east-1",
+		Endpoint:         "http://localhost:9000",
+		S3ForcePathStyle: true,
+		DisableSSL:       true,
+		ProxyURL:         "http://proxy:3128",
+	}
+	sess, err := NewSessionFromConfig(c)
+	assert.NoError(t, err)
+	client := c.ClientSession(sess)
+	assert.Equal(t, "http://localhost:9000", aws.StringValue(client.Config.Endpoint))
+	assert.True(t, aws.BoolValue(client.Config.S3ForcePathStyle))
+	assert.True(t, aws.BoolValue(client.Config.DisableSSL))
+	assert.Equal(t, "us-east-1", aws.StringValue(client.Config.Region))
+
+	// Endpoint is not used by other clients (e.g. STS or KMS)
+	assert.Nil(t, sess.Config.Endpoint)
+	assert.False(t, aws.BoolValue(sess.Config.S3ForcePathStyle))
+	assert.False(t, aws.BoolValue(sess.Config.DisableSSL))
+
+	transport := sess.Config.HTTPClient.Transport.(*http.Transport)
+	req, _ := http.NewRequest("GET", "http://localhost:9000/bucket/key", nil)
+	proxy, err := transport.Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy:3128", proxy.String())
+}
+
+func TestNewSessionWithCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(bundle, newTestCertificate(t), 0600))
+	sess, err := NewSessionFromConfig(&SessionConfig{Region: "us-east-1", CABundle: bundle})
+	assert.NoError(t, err)
+	transport := sess.Config.HTTPClient.Transport.(*http.Transport)
+	assert.NotNil(t, transport.TLSClientConfig.RootCAs)
+
+	invalid := filepath.Join(dir, "invalid.pem")
+	assert.NoError(t, ioutil.WriteFile(invalid, []byte("not a certificate"), 0600))
+	_, err = NewSessionFromConfig(&SessionConfig{Region: "us-east-1", CABundle: invalid})
+	assert.Error(t, err)
+
+	_, err = NewSessionFromConfig(&SessionConfig{Region: "us-east-1", CABundle: filepath.Join(dir, "missing.pem")})
+	assert.Error(t, err)
+}
+
+// newTestCertificate creates a self-signed certificate encoded as PEM
+func newTestCertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "s3logsbeat test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
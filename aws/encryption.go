@@ -0,0 +1,208 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Metadata set by the S3 encryption client on client-side encrypted objects (envelope v2)
+const (
+	metaKeyV2   = "X-Amz-Key-V2"
+	metaIV      = "X-Amz-Iv"
+	metaCEKAlg  = "X-Amz-Cek-Alg"
+	metaWrapAlg = "X-Amz-Wrap-Alg"
+	metaMatDesc = "X-Amz-Matdesc"
+	metaTagLen  = "X-Amz-Tag-Len"
+
+	cekAlgAESGCM  = "AES/GCM/NoPadding"
+	wrapAlgKMS    = "kms"
+	wrapAlgKMSCtx = "kms+context"
+	sseCAlgorithm = "AES256"
+	sseCKeyLength = 32
+	gcmTagLenBits = "128"
+)
+
+// EncryptionConfig configures how encrypted objects are read
+type EncryptionConfig struct {
+	SSECustomerKey *SSECustomerKeyConfig `config:"sse_c"`
+	ClientSide     bool                  `config:"client_side"`
+}
+
+// SSECustomerKeyConfig configures where the customer key used to read SSE-C objects is obtained from.
+// The key (256 bits) can be stored raw or base64 encoded on a file, or base64 encoded on an
+// environment variable
+type SSECustomerKeyConfig struct {
+	KeyFile string `config:"key_file"`
+	KeyEnv  string `config:"key_env"`
+}
+
+// Validate validates SSE-C config logic
+func (c *SSECustomerKeyConfig) Validate() error {
+	if (c.KeyFile == "") == (c.KeyEnv == "") {
+		return fmt.Errorf("SSE-C requires either key_file or key_env (but not both)")
+	}
+	return nil
+}
+
+// Encryption keys and clients used to read encrypted objects
+type Encryption struct {
+	sseCustomerKey string
+	kms            kmsiface.KMSAPI
+}
+
+// NewEncryption creates the encryption used to read objects from config. KMS client used to decrypt
+// client-side encrypted objects is created from session
+func NewEncryption(config *EncryptionConfig, session *session.Session) (*Encryption, error) {
+	e := &Encryption{}
+	if config.SSECustomerKey != nil {
+		key, err := config.SSECustomerKey.load()
+		if err != nil {
+			return nil, err
+		}
+		e.sseCustomerKey = key
+	}
+	if config.ClientSide {
+		e.kms = kms.New(session)
+	}
+	return e, nil
+}
+
+// load reads the customer key
+func (c *SSECustomerKeyConfig) load() (string, error) {
+	var content []byte
+	if c.KeyFile != "" {
+		var err error
+		if content, err = ioutil.ReadFile(c.KeyFile); err != nil {
+			return "", fmt.Errorf("Could not read SSE-C key file %s: %v", c.KeyFile, err)
+		}
+		if len(content) == sseCKeyLength {
+			return string(content), nil
+		}
+	} else {
+		value, ok := os.LookupEnv(c.KeyEnv)
+		if !ok {
+			return "", fmt.Errorf("Environment variable %s with SSE-C key is not set", c.KeyEnv)
+		}
+		content = []byte(value)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode base64 SSE-C key: %v", err)
+	}
+	if len(key) != sseCKeyLength {
+		return "", fmt.Errorf("SSE-C key must have %d bytes (%d found)", sseCKeyLength, len(key))
+	}
+	return string(key), nil
+}
+
+// getObjectInput creates the input to get o, with customer key if needed
+func (s *S3) getObjectInput(o *S3Object) *s3.GetObjectInput {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(o.Bucket),
+		Key:    aws.String(o.Key),
+	}
+	if s.encryption != nil && s.encryption.sseCustomerKey != "" {
+		input.SSECustomerAlgorithm = aws.String(sseCAlgorithm)
+		input.SSECustomerKey = aws.String(s.encryption.sseCustomerKey)
+	}
+	return input
+}
+
+// headObjectInput creates the input to get metadata of o, with customer key if needed
+func (s *S3) headObjectInput(o *S3Object) *s3.HeadObjectInput {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(o.Bucket),
+		Key:    aws.String(o.Key),
+	}
+	if s.encryption != nil && s.encryption.sseCustomerKey != "" {
+		input.SSECustomerAlgorithm = aws.String(sseCAlgorithm)
+		input.SSECustomerKey = aws.String(s.encryption.sseCustomerKey)
+	}
+	return input
+}
+
+// isClientSideEncrypted returns whether metadata belongs to a client-side encrypted object
+// which has to be decrypted
+func (s *S3) isClientSideEncrypted(metadata map[string]*string) bool {
+	return s.encryption != nil && s.encryption.kms != nil && getMetadata(metadata, metaKeyV2) != ""
+}
+
+// decrypt decrypts body of a client-side encrypted object (whose metadata is passed). The data key is
+// decrypted with KMS and content with AES-GCM, which requires reading the whole object before
+// returning any content
+func (s *S3) decrypt(o *S3Object, body io.ReadCloser, metadata map[string]*string) (io.ReadCloser, error) {
+	defer body.Close()
+
+	if alg := getMetadata(metadata, metaCEKAlg); alg != cekAlgAESGCM {
+		return nil, fmt.Errorf("Unsupported content encryption algorithm %q on %s", alg, o.String())
+	}
+	if wrap := getMetadata(metadata, metaWrapAlg); wrap != wrapAlgKMS && wrap != wrapAlgKMSCtx {
+		return nil, fmt.Errorf("Unsupported key wrap algorithm %q on %s", wrap, o.String())
+	}
+	if tagLen := getMetadata(metadata, metaTagLen); tagLen != "" && tagLen != gcmTagLenBits {
+		return nil, fmt.Errorf("Unsupported tag length %s on %s", tagLen, o.String())
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(getMetadata(metadata, metaKeyV2))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode encrypted key of %s: %v", o.String(), err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(getMetadata(metadata, metaIV))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode IV of %s: %v", o.String(), err)
+	}
+	matDesc := map[string]*string{}
+	if m := getMetadata(metadata, metaMatDesc); m != "" {
+		if err := json.Unmarshal([]byte(m), &matDesc); err != nil {
+			return nil, fmt.Errorf("Could not parse material description of %s: %v", o.String(), err)
+		}
+	}
+
+	key, err := s.encryption.kms.Decrypt(&kms.DecryptInput{
+		CiphertextBlob:    encryptedKey,
+		EncryptionContext: matDesc,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not decrypt key of %s with KMS: %v", o.String(), err)
+	}
+	block, err := aes.NewCipher(key.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(ciphertext[:0], iv, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decrypt %s: %v", o.String(), err)
+	}
+	return ioutil.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+// getMetadata obtains user metadata key (case insensitive)
+func getMetadata(metadata map[string]*string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+// +build !integration
+
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testSSECKey   = []byte("0123456789abcdef0123456789abcdef")
+	testDataKey   = []byte("fedcba9876543210fedcba9876543210")
+	testWrapped   = []byte("wrapped-data-key")
+	testIV        = []byte("0123456789ab")
+	testCMKID     = "arn:aws:kms:eu-west-1:123456789012:key/mykey"
+	testPlaintext = "line 1\nline 2\nline 3\n"
+)
+
+// fakeKMS local KMS stand-in which only decrypts testWrapped for testCMKID
+type fakeKMS struct {
+	kmsiface.KMSAPI
+}
+
+func (f *fakeKMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if !bytes.Equal(input.CiphertextBlob, testWrapped) || aws.StringValue(input.EncryptionContext["kms_cmk_id"]) != testCMKID {
+		return nil, errors.New("InvalidCiphertextException")
+	}
+	return &kms.DecryptOutput{Plaintext: testDataKey}, nil
+}
+
+// newClientSideEncryptedFakeS3 serves gzipped testPlaintext encrypted as the S3 encryption client does
+func newClientSideEncryptedFakeS3(t *testing.T) *fakeS3 {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte(testPlaintext))
+	w.Close()
+
+	block, err := aes.NewCipher(testDataKey)
+	assert.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	assert.NoError(t, err)
+
+	return &fakeS3{
+		content: gcm.Seal(nil, testIV, compressed.Bytes(), nil),
+		etag:    `"etag"`,
+		metadata: map[string]*string{
+			"X-Amz-Key-V2":   aws.String(base64.StdEncoding.EncodeToString(testWrapped)),
+			"X-Amz-Iv":       aws.String(base64.StdEncoding.EncodeToString(testIV)),
+			"X-Amz-Cek-Alg":  aws.String("AES/GCM/NoPadding"),
+			"X-Amz-Wrap-Alg": aws.String("kms"),
+			"X-Amz-Matdesc":  aws.String(`{"kms_cmk_id":"` + testCMKID + `"}`),
+			"X-Amz-Tag-Len":  aws.String("128"),
+		},
+	}
+}
+
+func TestSSECustomerKeyFromEnv(t *testing.T) {
+	os.Setenv("S3LOGSBEAT_TEST_SSEC_KEY", base64.StdEncoding.EncodeToString(testSSECKey))
+	defer os.Unsetenv("S3LOGSBEAT_TEST_SSEC_KEY")
+
+	e, err := NewEncryption(&EncryptionConfig{SSECustomerKey: &SSECustomerKeyConfig{KeyEnv: "S3LOGSBEAT_TEST_SSEC_KEY"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, string(testSSECKey), e.sseCustomerKey)
+
+	_, err = NewEncryption(&EncryptionConfig{SSECustomerKey: &SSECustomerKeyConfig{KeyEnv: "S3LOGSBEAT_TEST_SSEC_UNSET"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestSSECustomerKeyFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-ssec")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	raw := filepath.Join(dir, "raw.key")
+	assert.NoError(t, ioutil.WriteFile(raw, testSSECKey, 0600))
+	encoded := filepath.Join(dir, "encoded.key")
+	assert.NoError(t, ioutil.WriteFile(encoded, []byte(base64.StdEncoding.EncodeToString(testSSECKey)+"\n"), 0600))
+	short := filepath.Join(dir, "short.key")
+	assert.NoError(t, ioutil.WriteFile(short, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600))
+
+	for _, path := range []string{raw, encoded} {
+		key, err := (&SSECustomerKeyConfig{KeyFile: path}).load()
+		assert.NoError(t, err, path)
+		assert.Equal(t, string(testSSECKey), key, path)
+	}
+	_, err = (&SSECustomerKeyConfig{KeyFile: short}).load()
+	assert.Error(t, err)
+}
+
+func TestSSECustomerKeyRequests(t *testing.T) {
+	f := newFakeS3(1)
+	s := (&S3{client: f}).WithResumeRetries(1).WithEncryption(&Encryption{sseCustomerKey: string(testSSECKey)})
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, f.content, content)
+	// Resumed requests include the customer key too
+	if assert.Len(t, f.requests, 2) {
+		for _, r := range f.requests {
+			assert.Equal(t, "AES256", aws.StringValue(r.SSECustomerAlgorithm))
+			assert.Equal(t, string(testSSECKey), aws.StringValue(r.SSECustomerKey))
+		}
+	}
+}
+
+func TestClientSideEncryptedObject(t *testing.T) {
+	f := newClientSideEncryptedFakeS3(t)
+	s := (&S3{client: f}).WithEncryption(&Encryption{kms: &fakeKMS{}})
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, testPlaintext, string(content))
+}
+
+func TestClientSideEncryptedObjectResumed(t *testing.T) {
+	f := newClientSideEncryptedFakeS3(t)
+	f.failures = 1
+	f.failAfter = 10
+	s := (&S3{client: f}).WithResumeRetries(1).WithEncryption(&Encryption{kms: &fakeKMS{}})
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, testPlaintext, string(content))
+	assert.Len(t, f.requests, 2)
+}
+
+func TestClientSideEncryptedObjectTampered(t *testing.T) {
+	f := newClientSideEncryptedFakeS3(t)
+	f.content[0] ^= 0xff
+	s := (&S3{client: f}).WithEncryption(&Encryption{kms: &fakeKMS{}})
+	_, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.Error(t, err)
+}
+
+func TestClientSideEncryptedObjectWrongContext(t *testing.T) {
+	f := newClientSideEncryptedFakeS3(t)
+	f.metadata["X-Amz-Matdesc"] = aws.String(`{"kms_cmk_id":"otherkey"}`)
+	s := (&S3{client: f}).WithEncryption(&Encryption{kms: &fakeKMS{}})
+	_, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.Error(t, err)
+}
+
+func TestClientSideEncryptedObjectNotDecrypted(t *testing.T) {
+	// Without client-side decryption, content is read as is (encrypted)
+	f := newClientSideEncryptedFakeS3(t)
+	rc, err := (&S3{client: f}).GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, f.content, content)
+}
@@ -0,0 +1,74 @@
+package aws
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// EventBridgeSourceS3 source of the events sent by S3 to EventBridge
+	EventBridgeSourceS3 = "aws.s3"
+)
+
+// eventBridgeEvent event sent by S3 to EventBridge, delivered to SQS by an EventBridge rule
+// (https://docs.aws.amazon.com/AmazonS3/latest/userguide/ev-events.html)
+type eventBridgeEvent struct {
+	Source     string    `json:"source"`
+	DetailType string    `json:"detail-type"`
+	Time       time.Time `json:"time"`
+	Detail     struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key  string `json:"key"`
+			Size int64  `json:"size"`
+			ETag string `json:"etag"`
+		} `json:"object"`
+		Reason       string `json:"reason"`
+		DeletionType string `json:"deletion-type"`
+	} `json:"detail"`
+}
+
+// eventBridgeCreatedReasons event names of S3 event notifications equivalent to the reasons of
+// EventBridge "Object Created" events
+var eventBridgeCreatedReasons = map[string]string{
+	"PutObject":               "ObjectCreated:Put",
+	"POST Object":             "ObjectCreated:Post",
+	"CopyObject":              "ObjectCreated:Copy",
+	"CompleteMultipartUpload": "ObjectCreated:CompleteMultipartUpload",
+}
+
+// eventName obtains the name of the S3 event notification equivalent to the event, so objects can be
+// filtered by event name whatever the way they were notified. Detail types without equivalent are
+// named as the detail type without spaces (e.g. ObjectTagsAdded)
+func (e *eventBridgeEvent) eventName() string {
+	switch e.DetailType {
+	case "Object Created":
+		if name, ok := eventBridgeCreatedReasons[e.Detail.Reason]; ok {
+			return name
+		}
+		return "ObjectCreated:" + strings.Replace(e.Detail.Reason, " ", "", -1)
+	case "Object Deleted":
+		if e.Detail.DeletionType == "Delete Marker Created" {
+			return "ObjectRemoved:DeleteMarkerCreated"
+		}
+		return "ObjectRemoved:Delete"
+	case "Object Restore Initiated":
+		return "ObjectRestore:Post"
+	case "Object Restore Completed":
+		return "ObjectRestore:Completed"
+	}
+	return strings.Replace(e.DetailType, " ", "", -1)
+}
+
+// s3Object obtains the object of the event. Unlike S3 event notifications, keys are not URL encoded
+func (e *eventBridgeEvent) s3Object() *S3Object {
+	o := NewS3Object(e.Detail.Bucket.Name, e.Detail.Object.Key)
+	o.Size = e.Detail.Object.Size
+	o.SizeKnown = true
+	o.ETag = e.Detail.Object.ETag
+	o.EventTime = e.Time
+	o.EventName = e.eventName()
+	return o
+}
@@ -0,0 +1,104 @@
+// +build !integration
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const eventBridgeObjectCreated = `{
+	"version":"0",
+	"id":"17793124-05d4-b198-2fde-7ededc63b103",
+	"detail-type":"Object Created",
+	"source":"aws.s3",
+	"account":"123456789012",
+	"time":"2021-11-12T00:00:00Z",
+	"region":"eu-west-1",
+	"resources":["arn:aws:s3:::mybucket"],
+	"detail":{
+		"version":"0",
+		"bucket":{"name":"mybucket"},
+		"object":{"key":"AWSLogs/my file.log.gz","size":5,"etag":"b1946ac92492d2347c6235b4d2611184","sequencer":"00617F08299329D189"},
+		"request-id":"N4N7GDK58NMKJ12R",
+		"requester":"123456789012",
+		"reason":"PutObject"
+	}
+}`
+
+func extractTestObjects(t *testing.T, body string) []*S3Object {
+	var objects []*S3Object
+	c, err := NewSQSMessageS3Event(newTestSQSMessageWithBody(body)).ExtractNewObjects(func(o *S3Object) error {
+		objects = append(objects, o)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(objects)), c)
+	return objects
+}
+
+func TestEventBridgeObjectCreated(t *testing.T) {
+	eventBridge := sqsMessagesEventBridge.Get()
+	objects := extractTestObjects(t, eventBridgeObjectCreated)
+	if assert.Len(t, objects, 1) {
+		o := objects[0]
+		assert.Equal(t, "mybucket", o.Bucket)
+		assert.Equal(t, "AWSLogs/my file.log.gz", o.Key)
+		assert.Equal(t, int64(5), o.Size)
+		assert.Equal(t, "b1946ac92492d2347c6235b4d2611184", o.ETag)
+		assert.Equal(t, time.Date(2021, 11, 12, 0, 0, 0, 0, time.UTC), o.EventTime)
+		assert.Equal(t, "ObjectCreated:Put", o.EventName)
+	}
+	assert.Equal(t, eventBridge+1, sqsMessagesEventBridge.Get())
+}
+
+func TestEventBridgeEventName(t *testing.T) {
+	e := &eventBridgeEvent{DetailType: "Object Created"}
+	for reason, name := range map[string]string{
+		"PutObject":               "ObjectCreated:Put",
+		"POST Object":             "ObjectCreated:Post",
+		"CopyObject":              "ObjectCreated:Copy",
+		"CompleteMultipartUpload": "ObjectCreated:CompleteMultipartUpload",
+	} {
+		e.Detail.Reason = reason
+		assert.Equal(t, name, e.eventName())
+	}
+
+	e = &eventBridgeEvent{DetailType: "Object Deleted"}
+	assert.Equal(t, "ObjectRemoved:Delete", e.eventName())
+	e.Detail.DeletionType = "Delete Marker Created"
+	assert.Equal(t, "ObjectRemoved:DeleteMarkerCreated", e.eventName())
+
+	e = &eventBridgeEvent{DetailType: "Object Restore Completed"}
+	assert.Equal(t, "ObjectRestore:Completed", e.eventName())
+	e = &eventBridgeEvent{DetailType: "Object Tags Added"}
+	assert.Equal(t, "ObjectTagsAdded", e.eventName())
+}
+
+func TestEventBridgeUnwrappedFromSNS(t *testing.T) {
+	n := newTestSNSNotification("1")
+	n.Message = eventBridgeObjectCreated
+	objects := extractTestObjects(t, string(mustMarshal(t, n)))
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "AWSLogs/my file.log.gz", objects[0].Key)
+	}
+}
+
+func TestS3TestEventIgnored(t *testing.T) {
+	testEvents, unknown := sqsMessagesTestEvent.Get(), sqsMessagesUnknown.Get()
+	objects := extractTestObjects(t, `{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2019-05-07T10:00:00.000Z",`+
+		`"Bucket":"mybucket","RequestId":"5582815E1AEA5ADF","HostId":"8cLeGAmw098X5cv4Zkwcmo8vvZa3eH3eKxsPzbB9wrR+YstdA6Knx4Ip8EXAMPLE"}`)
+	assert.Empty(t, objects)
+	assert.Equal(t, testEvents+1, sqsMessagesTestEvent.Get())
+	assert.Equal(t, unknown, sqsMessagesUnknown.Get())
+}
+
+func TestUnknownMessageIgnored(t *testing.T) {
+	for _, body := range []string{`{"hello":"world"}`, `{"source":"aws.ec2","detail-type":"EC2 Instance State-change Notification"}`, `{"Records":[{"eventSource":"aws:dynamodb"}]}`, `not json`} {
+		unknown := sqsMessagesUnknown.Get()
+		assert.Empty(t, extractTestObjects(t, body), body)
+		assert.Equal(t, unknown+1, sqsMessagesUnknown.Get(), body)
+	}
+}
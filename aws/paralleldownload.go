@@ -0,0 +1,270 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/elastic/beats/libbeat/common/cfgtype"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+// chunkSize approximated size of the chunks of lines passed from line splitting to parsing
+const chunkSize = 1 << 20
+
+var (
+	parallelDownloads = monitoring.NewUint(nil, "s3logsbeat.s3object.parallelDownloads")
+)
+
+// ParallelDownloadConfig configures how large objects are downloaded with several ranged GETs in
+// parallel, and decompressed and split into lines on their own goroutines
+type ParallelDownloadConfig struct {
+	MinSize     cfgtype.ByteSize `config:"min_size"`
+	PartSize    cfgtype.ByteSize `config:"part_size"`
+	Concurrency int              `config:"concurrency" validate:"min=0"`
+}
+
+// Validate validates parallel download config logic
+func (c *ParallelDownloadConfig) Validate() error {
+	if c.MinSize <= 0 {
+		c.MinSize = 512 * 1024 * 1024
+	}
+	if c.PartSize <= 0 {
+		c.PartSize = 16 * 1024 * 1024
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = 4
+	}
+	return nil
+}
+
+// getParallelReadCloser downloads o (whose size and ETag are passed) with ranged GETs in parallel,
+// decompressing and splitting its content on pipelined goroutines. Order of content is preserved
+func (s *S3) getParallelReadCloser(o *S3Object, size int64, etag string, contentEncoding string) (io.ReadCloser, error) {
+	logp.Debug("s3logsbeat", "Downloading S3 object %s (%d bytes) in parallel", o.String(), size)
+	parallelDownloads.Add(1)
+
+	body := newParallelReader(s, o, size, etag)
+	br := bufio.NewReaderSize(body, peekSize)
+	codec := detectCodec(peek(br), contentEncoding)
+	dr, err := newCodecReader(br, codec, true)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	lr := newLineChunkReader(dr)
+	return &s3readcloser{
+		i: lr,
+		c: []io.Closer{body, dr, lr},
+	}, nil
+}
+
+// partResult content (or error) of a range of an object
+type partResult struct {
+	content []byte
+	err     error
+}
+
+// parallelReader reads an object downloading its parts with several ranged GETs in parallel.
+// At most concurrency parts are downloaded or kept in memory at the same time
+type parallelReader struct {
+	s       *S3
+	o       *S3Object
+	etag    string
+	parts   chan chan partResult
+	sem     chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	current *bytes.Reader
+	err     error
+}
+
+func newParallelReader(s *S3, o *S3Object, size int64, etag string) *parallelReader {
+	r := &parallelReader{
+		s:     s,
+		o:     o,
+		etag:  etag,
+		parts: make(chan chan partResult, s.parallelDownload.Concurrency),
+		sem:   make(chan struct{}, s.parallelDownload.Concurrency),
+		done:  make(chan struct{}),
+	}
+	go r.run(size, int64(s.parallelDownload.PartSize))
+	return r
+}
+
+// run launches the download of each part (in order) as soon as there is room for it
+func (r *parallelReader) run(size int64, partSize int64) {
+	defer close(r.parts)
+	for start := int64(0); start < size; start += partSize {
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		select {
+		case r.sem <- struct{}{}:
+		case <-r.done:
+			return
+		}
+		part := make(chan partResult, 1)
+		r.parts <- part
+		go func(start, end int64) {
+			content, err := r.download(start, end)
+			part <- partResult{content: content, err: err}
+		}(start, end)
+	}
+}
+
+// download obtains bytes from start to end (both included) of the object, retrying on transient errors
+func (r *parallelReader) download(start, end int64) ([]byte, error) {
+	var err error
+	for attempt := 0; attempt <= r.s.resumeRetries; attempt++ {
+		if attempt > 0 {
+			logp.Warn("Error downloading bytes %d-%d of S3 object %s. Retrying (attempt %d of %d). Error: %v", start, end, r.o.String(), attempt, r.s.resumeRetries, err)
+			time.Sleep(resumeBackoff * time.Duration(attempt))
+		}
+		var content []byte
+		content, err = r.downloadOnce(start, end)
+		if err == nil {
+			return content, nil
+		}
+		if !isTransientReadError(err) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("Could not download bytes %d-%d of S3 object %s: %v", start, end, r.o.String(), err)
+}
+
+func (r *parallelReader) downloadOnce(start, end int64) ([]byte, error) {
+	input := r.s.getObjectInput(r.o)
+	input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", start, end))
+	if r.etag != "" {
+		input.IfMatch = aws.String(r.etag)
+	}
+	output, err := r.s.client.GetObject(input)
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	content, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) != end-start+1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return content, nil
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	for r.current == nil || r.current.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.current != nil {
+			// previous part consumed: make room for a new one
+			r.current = nil
+			<-r.sem
+		}
+		part, ok := <-r.parts
+		if !ok {
+			r.err = io.EOF
+			continue
+		}
+		result := <-part
+		if result.err != nil {
+			r.err = result.err
+			continue
+		}
+		r.current = bytes.NewReader(result.content)
+	}
+	return r.current.Read(p)
+}
+
+func (r *parallelReader) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
+
+// lineChunkReader reads r on its own goroutine, splitting content into chunks of complete lines
+// which are read (in order) from Read. It pipelines decompression and line splitting with parsing
+type lineChunkReader struct {
+	chunks  chan []byte
+	errc    chan error
+	done    chan struct{}
+	once    sync.Once
+	current []byte
+}
+
+func newLineChunkReader(r io.Reader) *lineChunkReader {
+	l := &lineChunkReader{
+		chunks: make(chan []byte, 4),
+		errc:   make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	go l.run(bufio.NewReaderSize(r, chunkSize))
+	return l
+}
+
+func (l *lineChunkReader) run(r *bufio.Reader) {
+	defer close(l.chunks)
+	for {
+		chunk := make([]byte, 0, chunkSize+chunkSize/4)
+		var err error
+		for len(chunk) < chunkSize && err == nil {
+			var line []byte
+			line, err = r.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				// line longer than buffer: keep reading it
+				err = nil
+			}
+			chunk = append(chunk, line...)
+		}
+		if len(chunk) > 0 {
+			select {
+			case l.chunks <- chunk:
+			case <-l.done:
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				l.errc <- err
+			}
+			return
+		}
+	}
+}
+
+func (l *lineChunkReader) Read(p []byte) (int, error) {
+	for len(l.current) == 0 {
+		chunk, ok := <-l.chunks
+		if !ok {
+			select {
+			case err := <-l.errc:
+				return 0, err
+			default:
+				return 0, io.EOF
+			}
+		}
+		l.current = chunk
+	}
+	n := copy(p, l.current)
+	l.current = l.current[n:]
+	return n, nil
+}
+
+func (l *lineChunkReader) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
@@ -0,0 +1,138 @@
+// +build !integration
+
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/cfgtype"
+)
+
+func newParallelDownloadConfig() *ParallelDownloadConfig {
+	c := &ParallelDownloadConfig{
+		MinSize:     100,
+		PartSize:    1000,
+		Concurrency: 3,
+	}
+	c.Validate()
+	return c
+}
+
+// multiMemberGzip compresses content as several concatenated gzip members
+func multiMemberGzip(t *testing.T, content []byte, members int) []byte {
+	var buf bytes.Buffer
+	size := len(content)/members + 1
+	for i := 0; i < len(content); i += size {
+		end := i + size
+		if end > len(content) {
+			end = len(content)
+		}
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(content[i:end])
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+	return buf.Bytes()
+}
+
+func TestParallelDownload(t *testing.T) {
+	f := newFakeS3(0)
+	plain := f.content
+	f.content = multiMemberGzip(t, plain, 5)
+	s := (&S3{client: f}).WithResumeRetries(2).WithParallelDownload(newParallelDownloadConfig())
+
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.NoError(t, rc.Close())
+	assert.Equal(t, string(plain), string(content))
+
+	ranges := 0
+	for _, r := range f.requests {
+		if r.Range != nil {
+			ranges++
+			assert.Equal(t, `"etag"`, *r.IfMatch)
+		}
+	}
+	assert.Equal(t, (len(f.content)+999)/1000, ranges)
+}
+
+func TestParallelDownloadRetriesPart(t *testing.T) {
+	f := newFakeS3(1)
+	f.failAfter = 10
+	s := (&S3{client: f}).WithResumeRetries(2).WithParallelDownload(newParallelDownloadConfig())
+
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, f.content, content)
+}
+
+func TestParallelDownloadObjectChanged(t *testing.T) {
+	f := newFakeS3(0)
+	s := (&S3{client: f}).WithParallelDownload(newParallelDownloadConfig())
+
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+	f.setETag(`"new-etag"`)
+	_, err = ioutil.ReadAll(rc)
+	assert.Error(t, err)
+}
+
+func TestParallelDownloadSmallObject(t *testing.T) {
+	f := newFakeS3(0)
+	c := newParallelDownloadConfig()
+	c.MinSize = 1 << 30
+	s := (&S3{client: f}).WithParallelDownload(c)
+
+	o := NewS3Object("bucket", "key")
+	o.Size, o.SizeKnown = int64(len(f.content)), true
+	rc, err := s.GetReadCloser(o)
+	assert.NoError(t, err)
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, f.content, content)
+	assert.Len(t, f.requests, 1)
+	assert.Nil(t, f.requests[0].Range)
+}
+
+func TestLineChunkReader(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&buf, "line %d\n", i)
+	}
+	// line longer than chunks, without trailing new line
+	buf.WriteString(strings.Repeat("x", 2*chunkSize))
+	expected := buf.String()
+
+	l := newLineChunkReader(&buf)
+	defer l.Close()
+	content, err := ioutil.ReadAll(l)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+}
+
+func TestParallelDownloadConfig(t *testing.T) {
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"min_size":  "1GiB",
+		"part_size": "8MiB",
+	})
+	var c ParallelDownloadConfig
+	assert.NoError(t, cfg.Unpack(&c))
+	assert.Equal(t, cfgtype.ByteSize(1<<30), c.MinSize)
+	assert.Equal(t, cfgtype.ByteSize(8<<20), c.PartSize)
+	assert.Equal(t, 4, c.Concurrency)
+}
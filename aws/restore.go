@@ -0,0 +1,70 @@
+package aws
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// RestoreStatus status of the restore of an archived object
+type RestoreStatus int
+
+const (
+	// RestoreNotRequested no restore has been requested (or its copy has expired)
+	RestoreNotRequested RestoreStatus = iota
+	// RestoreOngoing restore has been requested but the object is not available yet
+	RestoreOngoing
+	// Restored a temporary copy of the object is available and can be read
+	Restored
+)
+
+const errCodeRestoreAlreadyInProgress = "RestoreAlreadyInProgress"
+
+// IsArchived returns whether the object is stored on an archive storage class (Glacier or
+// Glacier Deep Archive), so it can not be read until it is restored
+func (s *S3Object) IsArchived() bool {
+	return s.StorageClass == s3.ObjectStorageClassGlacier || s.StorageClass == s3.ObjectStorageClassDeepArchive
+}
+
+// RestoreStatus obtains the status of the restore of o based on its x-amz-restore header
+func (s *S3) RestoreStatus(o *S3Object) (RestoreStatus, error) {
+	head, err := s.client.HeadObject(s.headObjectInput(o))
+	if err != nil {
+		return RestoreNotRequested, err
+	}
+	return parseRestoreHeader(aws.StringValue(head.Restore)), nil
+}
+
+// RestoreObject requests a temporary copy of archived object o, available for days days and
+// restored with tier (Expedited, Standard or Bulk). Restores already in progress are not an error
+func (s *S3) RestoreObject(o *S3Object, days int, tier string) error {
+	_, err := s.client.RestoreObject(&s3.RestoreObjectInput{
+		Bucket: aws.String(o.Bucket),
+		Key:    aws.String(o.Key),
+		RestoreRequest: &s3.RestoreRequest{
+			Days: aws.Int64(int64(days)),
+			GlacierJobParameters: &s3.GlacierJobParameters{
+				Tier: aws.String(tier),
+			},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeRestoreAlreadyInProgress {
+		return nil
+	}
+	return err
+}
+
+// parseRestoreHeader parses the x-amz-restore header, which has format:
+// ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+func parseRestoreHeader(restore string) RestoreStatus {
+	switch {
+	case strings.Contains(restore, `ongoing-request="true"`):
+		return RestoreOngoing
+	case strings.Contains(restore, `ongoing-request="false"`):
+		return Restored
+	default:
+		return RestoreNotRequested
+	}
+}
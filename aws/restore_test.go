@@ -0,0 +1,77 @@
+// +build !integration
+
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+type restoreFakeS3 struct {
+	s3iface.S3API
+	restore    *string
+	restoreErr error
+	requests   []*s3.RestoreObjectInput
+}
+
+func (f *restoreFakeS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{Restore: f.restore}, nil
+}
+
+func (f *restoreFakeS3) RestoreObject(input *s3.RestoreObjectInput) (*s3.RestoreObjectOutput, error) {
+	f.requests = append(f.requests, input)
+	return &s3.RestoreObjectOutput{}, f.restoreErr
+}
+
+func TestIsArchived(t *testing.T) {
+	o := NewS3Object("mybucket", "mykey")
+	assert.False(t, o.IsArchived())
+	o.StorageClass = "STANDARD_IA"
+	assert.False(t, o.IsArchived())
+	o.StorageClass = "GLACIER"
+	assert.True(t, o.IsArchived())
+	o.StorageClass = "DEEP_ARCHIVE"
+	assert.True(t, o.IsArchived())
+}
+
+func TestRestoreStatus(t *testing.T) {
+	fake := &restoreFakeS3{}
+	s := &S3{client: fake}
+	o := NewS3Object("mybucket", "mykey")
+
+	status, err := s.RestoreStatus(o)
+	assert.NoError(t, err)
+	assert.Equal(t, RestoreNotRequested, status)
+
+	fake.restore = aws.String(`ongoing-request="true"`)
+	status, err = s.RestoreStatus(o)
+	assert.NoError(t, err)
+	assert.Equal(t, RestoreOngoing, status)
+
+	fake.restore = aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)
+	status, err = s.RestoreStatus(o)
+	assert.NoError(t, err)
+	assert.Equal(t, Restored, status)
+}
+
+func TestRestoreObject(t *testing.T) {
+	fake := &restoreFakeS3{}
+	s := &S3{client: fake}
+	o := NewS3Object("mybucket", "mykey")
+
+	assert.NoError(t, s.RestoreObject(o, 7, "Bulk"))
+	assert.Len(t, fake.requests, 1)
+	assert.Equal(t, int64(7), aws.Int64Value(fake.requests[0].RestoreRequest.Days))
+	assert.Equal(t, "Bulk", aws.StringValue(fake.requests[0].RestoreRequest.GlacierJobParameters.Tier))
+
+	fake.restoreErr = awserr.New("RestoreAlreadyInProgress", "Object restore is already in progress", nil)
+	assert.NoError(t, s.RestoreObject(o, 7, "Bulk"))
+
+	fake.restoreErr = awserr.New("AccessDenied", "Access Denied", nil)
+	assert.Error(t, s.RestoreObject(o, 7, "Bulk"))
+}
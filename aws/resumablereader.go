@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+var (
+	downloadResumes      = monitoring.NewUint(nil, "s3logsbeat.s3object.resumes")
+	downloadResumeErrors = monitoring.NewUint(nil, "s3logsbeat.s3object.resumeError")
+
+	// resumeBackoff time waited before each resume, multiplied by the number of attempt
+	resumeBackoff = time.Second
+)
+
+// resumableReader reads the body of an S3 object. When a transient error happens, the object is
+// reopened from the last byte read with a ranged GET bound to the original ETag (If-Match), so
+// readers do not notice the interruption
+type resumableReader struct {
+	s       *S3
+	o       *S3Object
+	etag    string
+	body    io.ReadCloser
+	offset  int64
+	retries int
+	attempt int
+}
+
+// newResumableReader creates a reader of body (already opened) which is resumed up to retries times
+func newResumableReader(s *S3, o *S3Object, etag string, body io.ReadCloser, retries int) *resumableReader {
+	return &resumableReader{
+		s:       s,
+		o:       o,
+		etag:    etag,
+		body:    body,
+		retries: retries,
+	}
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if err := r.reopen(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF || !r.shouldResume(err) {
+			return n, err
+		}
+		r.body.Close()
+		r.body = nil
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// shouldResume checks if the download must be resumed after err, consuming an attempt if so
+func (r *resumableReader) shouldResume(err error) bool {
+	if !isTransientReadError(err) {
+		return false
+	}
+	if r.attempt >= r.retries {
+		downloadResumeErrors.Add(1)
+		logp.Err("Could not read S3 object %s at offset %d after %d resumes. Error: %v", r.o.String(), r.offset, r.attempt, err)
+		return false
+	}
+	r.attempt++
+	logp.Warn("Error reading S3 object %s at offset %d. Resuming download (attempt %d of %d). Error: %v", r.o.String(), r.offset, r.attempt, r.retries, err)
+	return true
+}
+
+// reopen gets the object again from current offset. If object has changed since it was
+// opened (ETag does not match), an error is returned
+func (r *resumableReader) reopen() error {
+	time.Sleep(resumeBackoff * time.Duration(r.attempt))
+	input := r.s.getObjectInput(r.o)
+	input.Range = aws.String(fmt.Sprintf("bytes=%d-", r.offset))
+	if r.etag != "" {
+		input.IfMatch = aws.String(r.etag)
+	}
+	output, err := r.s.client.GetObject(input)
+	if err != nil {
+		downloadResumeErrors.Add(1)
+		return fmt.Errorf("Could not resume download of S3 object %s at offset %d: %v", r.o.String(), r.offset, err)
+	}
+	downloadResumes.Add(1)
+	r.body = output.Body
+	return nil
+}
+
+func (r *resumableReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// isTransientReadError checks if an error reading the body of an object could disappear when
+// reading it again (connection resets, timeouts, truncated responses)
+func isTransientReadError(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if request.IsErrorRetryable(err) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe")
+}
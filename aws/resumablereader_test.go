@@ -0,0 +1,167 @@
+// +build !integration
+
+package aws
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingReader returns err after reading n bytes
+type failingReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, f.err
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+// fakeS3 serves an object whose body fails after failAfter bytes on the first failures requests
+type fakeS3 struct {
+	s3iface.S3API
+	sync.Mutex
+	content   []byte
+	etag      string
+	failAfter int
+	failures  int
+	metadata  map[string]*string
+	requests  []*s3.GetObjectInput
+}
+
+func (f *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests = append(f.requests, input)
+	if input.IfMatch != nil && *input.IfMatch != f.etag {
+		return nil, awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil)
+	}
+	start, end := 0, len(f.content)-1
+	if input.Range != nil {
+		fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end)
+	}
+	var body io.Reader = bytes.NewReader(f.content[start : end+1])
+	if len(f.requests) <= f.failures {
+		body = &failingReader{r: body, n: f.failAfter, err: syscall.ECONNRESET}
+	}
+	return &s3.GetObjectOutput{
+		Body:     ioutil.NopCloser(body),
+		ETag:     aws.String(f.etag),
+		Metadata: f.metadata,
+	}, nil
+}
+
+func (f *fakeS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(f.content))),
+		ETag:          aws.String(f.etag),
+		Metadata:      f.metadata,
+	}, nil
+}
+
+func (f *fakeS3) setETag(etag string) {
+	f.Lock()
+	defer f.Unlock()
+	f.etag = etag
+}
+
+func newFakeS3(failures int) *fakeS3 {
+	var content bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	return &fakeS3{
+		content:   content.Bytes(),
+		etag:      `"etag"`,
+		failAfter: 1000,
+		failures:  failures,
+	}
+}
+
+func init() {
+	resumeBackoff = 0
+}
+
+func TestResumableReaderResumes(t *testing.T) {
+	f := newFakeS3(2)
+	s := (&S3{client: f}).WithResumeRetries(3)
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, f.content, content)
+	if assert.Len(t, f.requests, 3) {
+		assert.Nil(t, f.requests[0].Range)
+		assert.Equal(t, "bytes=1000-", aws.StringValue(f.requests[1].Range))
+		assert.Equal(t, `"etag"`, aws.StringValue(f.requests[1].IfMatch))
+		assert.Equal(t, "bytes=2000-", aws.StringValue(f.requests[2].Range))
+	}
+}
+
+func TestResumableReaderRetriesExhausted(t *testing.T) {
+	f := newFakeS3(3)
+	s := (&S3{client: f}).WithResumeRetries(2)
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	_, err = ioutil.ReadAll(rc)
+	assert.Error(t, err)
+	assert.Len(t, f.requests, 3)
+}
+
+func TestResumableReaderObjectChanged(t *testing.T) {
+	f := newFakeS3(1)
+	s := (&S3{client: f}).WithResumeRetries(2)
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	f.setETag(`"new-etag"`)
+	_, err = ioutil.ReadAll(rc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PreconditionFailed")
+}
+
+func TestResumableReaderDisabled(t *testing.T) {
+	f := newFakeS3(1)
+	s := &S3{client: f}
+	rc, err := s.GetReadCloser(NewS3Object("bucket", "key"))
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	_, err = ioutil.ReadAll(rc)
+	assert.Error(t, err)
+	assert.Len(t, f.requests, 1)
+}
+
+func TestIsTransientReadError(t *testing.T) {
+	assert.True(t, isTransientReadError(io.ErrUnexpectedEOF))
+	assert.True(t, isTransientReadError(syscall.ECONNRESET))
+	assert.False(t, isTransientReadError(errors.New("gzip: invalid header")))
+}
@@ -3,7 +3,9 @@ package aws
 import (
 	"fmt"
 	"regexp"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -15,6 +17,17 @@ var (
 type S3Object struct {
 	Bucket string
 	Key    string
+	// Optional information known before downloading the object (zero values if unknown)
+	LastModified time.Time
+	Size         int64
+	ETag         string
+	// SizeKnown is set if Size is known (e.g. objects notified without their size are not filtered by size)
+	SizeKnown    bool
+	StorageClass string
+	// EventTime is the time of the S3 event which notified this object (zero if not notified)
+	EventTime time.Time
+	// EventName is the name of the S3 event which notified this object (empty if not notified)
+	EventName string
 }
 
 // NewS3Object creates a new S3 object
@@ -40,6 +53,15 @@ func NewS3ObjectFromURI(uri string) (*S3Object, error) {
 	}, nil
 }
 
+// Time obtains the best known time of the object: last modification time if known
+// or event time otherwise
+func (s *S3Object) Time() time.Time {
+	if s.LastModified.IsZero() {
+		return s.EventTime
+	}
+	return s.LastModified
+}
+
 // String converts current object into string
 func (s *S3Object) String() string {
 	return fmt.Sprintf("S3Object{Bucket:%s, Key: %s}", s.Bucket, s.Key)
@@ -56,8 +78,13 @@ func NewS3ObjectWithOriginal(bucket string, original *s3.Object) *S3ObjectWithOr
 	return &S3ObjectWithOriginal{
 		original,
 		&S3Object{
-			Bucket: bucket,
-			Key:    *original.Key,
+			Bucket:       bucket,
+			Key:          *original.Key,
+			LastModified: aws.TimeValue(original.LastModified),
+			Size:         aws.Int64Value(original.Size),
+			SizeKnown:    original.Size != nil,
+			ETag:         aws.StringValue(original.ETag),
+			StorageClass: aws.StringValue(original.StorageClass),
 		},
 	}
 }
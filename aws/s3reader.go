@@ -1,18 +1,20 @@
 package aws
 
 import (
-	"compress/gzip"
 	"io"
-	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 )
 
 // S3 handle simple S3 methods
 type S3 struct {
-	client *s3.S3
+	client           s3iface.S3API
+	resumeRetries    int
+	parallelDownload *ParallelDownloadConfig
+	encryption       *Encryption
 }
 
 type s3readcloser struct {
@@ -21,7 +23,8 @@ type s3readcloser struct {
 	c []io.Closer
 }
 
-type s3ObjectHandler func(*S3ObjectWithOriginal) error
+// S3ObjectHandler handles each S3 object obtained when listing
+type S3ObjectHandler func(*S3ObjectWithOriginal) error
 
 // NewS3 is a construct function for creating the object
 // with session
@@ -35,20 +38,73 @@ func NewS3(session *session.Session) *S3 {
 	return s3
 }
 
+// WithResumeRetries obtains a copy of current S3 which resumes interrupted downloads up to
+// retries times per object (0 disables it)
+func (s *S3) WithResumeRetries(retries int) *S3 {
+	r := *s
+	r.resumeRetries = retries
+	return &r
+}
+
+// WithParallelDownload obtains a copy of current S3 which downloads objects larger than
+// config.MinSize in parallel (nil disables it)
+func (s *S3) WithParallelDownload(config *ParallelDownloadConfig) *S3 {
+	r := *s
+	r.parallelDownload = config
+	return &r
+}
+
+// WithEncryption obtains a copy of current S3 which reads encrypted objects using encryption
+// (nil reads them as plain objects)
+func (s *S3) WithEncryption(encryption *Encryption) *S3 {
+	r := *s
+	r.encryption = encryption
+	return &r
+}
+
 // GetReadCloser returns a io.ReadCloser to be readed (and then closed) by another method.
+// Downloads interrupted by transient errors are resumed from the last byte read. Client-side
+// encrypted objects are decrypted before being decompressed
 func (s *S3) GetReadCloser(o *S3Object) (io.ReadCloser, error) {
-	output, err := s.client.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(o.Bucket),
-		Key:    aws.String(o.Key),
-	})
+	if s.parallelDownload != nil && (!o.SizeKnown || o.Size >= int64(s.parallelDownload.MinSize)) {
+		head, err := s.client.HeadObject(s.headObjectInput(o))
+		if err != nil {
+			return nil, err
+		}
+		// Client-side encrypted objects have to be read at once to be decrypted
+		if size := aws.Int64Value(head.ContentLength); size >= int64(s.parallelDownload.MinSize) && !s.isClientSideEncrypted(head.Metadata) {
+			return s.getParallelReadCloser(o, size, aws.StringValue(head.ETag), aws.StringValue(head.ContentEncoding))
+		}
+	}
+
+	output, err := s.client.GetObject(s.getObjectInput(o))
 	if err != nil {
 		return nil, err
 	}
-	return newS3ReadCloser(output.Body, o.Key)
+	body := output.Body
+	if s.resumeRetries > 0 {
+		body = newResumableReader(s, o, aws.StringValue(output.ETag), body, s.resumeRetries)
+	}
+	if s.isClientSideEncrypted(output.Metadata) {
+		if body, err = s.decrypt(o, body, output.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	return NewS3ReadCloser(body, aws.StringValue(output.ContentEncoding))
+}
+
+// PutObject uploads body as the content of S3 object o
+func (s *S3) PutObject(o *S3Object, body io.ReadSeeker) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(o.Bucket),
+		Key:    aws.String(o.Key),
+		Body:   body,
+	})
+	return err
 }
 
 // ListObjects lists objects present on o.Bucket and prefix o.Key
-func (s *S3) ListObjects(o *S3Object, oh s3ObjectHandler) (int, error) {
+func (s *S3) ListObjects(o *S3Object, oh S3ObjectHandler) (int, error) {
 	received := 0
 	s3ListObjectsInput := &s3.ListObjectsInput{
 		Bucket: aws.String(o.Bucket),
@@ -66,19 +122,20 @@ func (s *S3) ListObjects(o *S3Object, oh s3ObjectHandler) (int, error) {
 	return received, err
 }
 
-func newS3ReadCloser(i io.ReadCloser, key string) (io.ReadCloser, error) {
+// NewS3ReadCloser wraps the content of an S3 object (read from S3 or from a local copy)
+// decompressing it if needed. Compression is detected by content, using contentEncoding
+// (Content-Encoding header, if any) as a hint
+func NewS3ReadCloser(i io.ReadCloser, contentEncoding string) (io.ReadCloser, error) {
 	s := &s3readcloser{
-		i: i,
 		c: []io.Closer{i},
 	}
-	if strings.HasSuffix(key, ".gz") {
-		var err error
-		s.i, err = gzip.NewReader(i)
-		if err != nil {
-			return nil, err
-		}
-		s.c = append(s.c, s.i)
+	var err error
+	s.i, err = newDecompressReader(i, contentEncoding)
+	if err != nil {
+		i.Close()
+		return nil, err
 	}
+	s.c = append(s.c, s.i)
 	return s, nil
 }
 
@@ -0,0 +1,166 @@
+package aws
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SNSTypeNotification type of the messages published on SNS topics
+	SNSTypeNotification = "Notification"
+
+	snsCertTimeout = 10 * time.Second
+)
+
+// snsCertHost hosts from which SNS signing certificates are downloaded
+var snsCertHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSNotification envelope in which SNS sends messages to subscribed SQS queues when raw message
+// delivery is disabled. Message contains the message published (e.g. an S3 event) as a string
+type SNSNotification struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+// ParseSNSNotification obtains the SNS envelope of body. Returns false if body is not an SNS envelope
+// (e.g. an S3 event sent directly or thru SNS with raw message delivery)
+func ParseSNSNotification(body string) (*SNSNotification, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(body), "{") {
+		return nil, false
+	}
+	var n SNSNotification
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return nil, false
+	}
+	if n.Type == "" || n.TopicArn == "" || n.MessageID == "" {
+		return nil, false
+	}
+	return &n, true
+}
+
+// String converts to String
+func (n *SNSNotification) String() string {
+	return fmt.Sprintf("%s %s from %s", n.Type, n.MessageID, n.TopicArn)
+}
+
+// stringToSign builds the string signed by SNS for notifications
+// (https://docs.aws.amazon.com/sns/latest/dg/sns-verify-signature-of-message.html)
+func (n *SNSNotification) stringToSign() string {
+	var b strings.Builder
+	add := func(k, v string) {
+		b.WriteString(k)
+		b.WriteString("\n")
+		b.WriteString(v)
+		b.WriteString("\n")
+	}
+	add("Message", n.Message)
+	add("MessageId", n.MessageID)
+	if n.Subject != "" {
+		add("Subject", n.Subject)
+	}
+	add("Timestamp", n.Timestamp)
+	add("TopicArn", n.TopicArn)
+	add("Type", n.Type)
+	return b.String()
+}
+
+// SNSVerifier verifies the signature of SNS notifications. Signing certificates are downloaded
+// from SNS and kept in memory
+type SNSVerifier struct {
+	client   *http.Client
+	certHost *regexp.Regexp
+	mutex    sync.Mutex
+	certs    map[string]*x509.Certificate
+}
+
+// NewSNSVerifier creates a new SNS signature verifier
+func NewSNSVerifier() *SNSVerifier {
+	return &SNSVerifier{
+		client:   &http.Client{Timeout: snsCertTimeout},
+		certHost: snsCertHost,
+		certs:    make(map[string]*x509.Certificate),
+	}
+}
+
+// Verify returns an error if n is not a notification signed by SNS
+func (v *SNSVerifier) Verify(n *SNSNotification) error {
+	if n.Type != SNSTypeNotification {
+		return fmt.Errorf("Unsupported SNS message type %s", n.Type)
+	}
+	var algorithm x509.SignatureAlgorithm
+	switch n.SignatureVersion {
+	case "1":
+		algorithm = x509.SHA1WithRSA
+	case "2":
+		algorithm = x509.SHA256WithRSA
+	default:
+		return fmt.Errorf("Unsupported SNS signature version %s", n.SignatureVersion)
+	}
+	signature, err := base64.StdEncoding.DecodeString(n.Signature)
+	if err != nil {
+		return fmt.Errorf("Invalid SNS signature: %v", err)
+	}
+	cert, err := v.getCert(n.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(algorithm, []byte(n.stringToSign()), signature); err != nil {
+		return fmt.Errorf("Invalid SNS signature: %v", err)
+	}
+	return nil
+}
+
+// getCert obtains the certificate of certURL, downloading it if it is not known yet. Only
+// certificates served by SNS over HTTPS are accepted
+func (v *SNSVerifier) getCert(certURL string) (*x509.Certificate, error) {
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" || !v.certHost.MatchString(u.Hostname()) || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, fmt.Errorf("Invalid SNS signing certificate URL %s", certURL)
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if cert, ok := v.certs[certURL]; ok {
+		return cert, nil
+	}
+
+	resp, err := v.client.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("Could not download SNS signing certificate %s: %v", certURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not download SNS signing certificate %s: %s", certURL, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Could not download SNS signing certificate %s: %v", certURL, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("Invalid SNS signing certificate %s: no PEM data found", certURL)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SNS signing certificate %s: %v", certURL, err)
+	}
+	v.certs[certURL] = cert
+	return cert, nil
+}
@@ -0,0 +1,197 @@
+// +build !integration
+
+package aws
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+const snsS3Event = `{"Records":[{"eventSource":"aws:s3","eventTime":"2019-05-07T10:00:00.000Z","eventName":"ObjectCreated:Put",` +
+	`"s3":{"bucket":{"name":"mybucket"},"object":{"key":"logs/a%3Db.log","size":1024,"eTag":"etag"}}}]}`
+
+// snsSigner signs SNS notifications with a self-signed certificate served thru HTTPS
+type snsSigner struct {
+	key    *rsa.PrivateKey
+	server *httptest.Server
+}
+
+func newTestSNSSigner(t *testing.T) *snsSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(certPEM)
+	}))
+	return &snsSigner{key: key, server: server}
+}
+
+// verifier obtains an SNS verifier which trusts the certificates of the signer
+func (s *snsSigner) verifier() *SNSVerifier {
+	v := NewSNSVerifier()
+	v.client = s.server.Client()
+	v.certHost = regexp.MustCompile(`^127\.0\.0\.1$`)
+	return v
+}
+
+func (s *snsSigner) sign(t *testing.T, n *SNSNotification) {
+	n.SigningCertURL = s.server.URL + "/SimpleNotificationService-test.pem"
+	var hash crypto.Hash
+	var digest []byte
+	if n.SignatureVersion == "1" {
+		h := sha1.Sum([]byte(n.stringToSign()))
+		hash, digest = crypto.SHA1, h[:]
+	} else {
+		h := sha256.Sum256([]byte(n.stringToSign()))
+		hash, digest = crypto.SHA256, h[:]
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, hash, digest)
+	assert.NoError(t, err)
+	n.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+func newTestSNSNotification(signatureVersion string) *SNSNotification {
+	return &SNSNotification{
+		Type:             SNSTypeNotification,
+		MessageID:        "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		TopicArn:         "arn:aws:sns:eu-west-1:123456789012:s3-logs",
+		Subject:          "Amazon S3 Notification",
+		Message:          snsS3Event,
+		Timestamp:        "2019-05-07T10:00:01.000Z",
+		SignatureVersion: signatureVersion,
+	}
+}
+
+func newTestSQSMessageWithBody(body string) *SQSMessage {
+	return newSQSMessage(&sqs.Message{
+		Body:          &body,
+		MessageId:     aws.String("fakeMessageId"),
+		ReceiptHandle: aws.String("fakeReceipt"),
+	})
+}
+
+func TestParseSNSNotification(t *testing.T) {
+	n, ok := ParseSNSNotification(string(mustMarshal(t, newTestSNSNotification("1"))))
+	if assert.True(t, ok) {
+		assert.Equal(t, snsS3Event, n.Message)
+		assert.Equal(t, "arn:aws:sns:eu-west-1:123456789012:s3-logs", n.TopicArn)
+	}
+
+	// Raw message delivery
+	_, ok = ParseSNSNotification(snsS3Event)
+	assert.False(t, ok)
+	_, ok = ParseSNSNotification("not json")
+	assert.False(t, ok)
+}
+
+func TestS3EventUnwrappedFromSNS(t *testing.T) {
+	for _, body := range []string{snsS3Event, string(mustMarshal(t, newTestSNSNotification("1")))} {
+		s := NewSQSMessageS3Event(newTestSQSMessageWithBody(body))
+		var keys []string
+		c, err := s.ExtractNewObjects(func(o *S3Object) error {
+			assert.Equal(t, "mybucket", o.Bucket)
+			assert.Equal(t, int64(1024), o.Size)
+			assert.Equal(t, "ObjectCreated:Put", o.EventName)
+			keys = append(keys, o.Key)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), c)
+		assert.Equal(t, []string{"logs/a=b.log"}, keys)
+	}
+
+	// Messages not received thru SNS are not signed
+	assert.Error(t, NewSQSMessageS3Event(newTestSQSMessageWithBody(snsS3Event)).VerifySNSSignature(NewSNSVerifier()))
+}
+
+func TestSNSSubscriptionConfirmationIgnored(t *testing.T) {
+	n := newTestSNSNotification("1")
+	n.Type = "SubscriptionConfirmation"
+	s := NewSQSMessageS3Event(newTestSQSMessageWithBody(string(mustMarshal(t, n))))
+	c, err := s.ExtractNewObjects(func(o *S3Object) error {
+		t.Errorf("Unexpected object %s", o.String())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), c)
+}
+
+func TestSNSVerifierSignature(t *testing.T) {
+	signer := newTestSNSSigner(t)
+	defer signer.server.Close()
+	v := signer.verifier()
+
+	for _, version := range []string{"1", "2"} {
+		n := newTestSNSNotification(version)
+		signer.sign(t, n)
+		assert.NoError(t, v.Verify(n), version)
+
+		n.Message = `{"Records":[]}`
+		assert.Error(t, v.Verify(n), version)
+	}
+
+	// Subject is optional
+	n := newTestSNSNotification("2")
+	n.Subject = ""
+	signer.sign(t, n)
+	assert.NoError(t, v.Verify(n))
+	assert.Len(t, v.certs, 1)
+
+	n.SignatureVersion = "3"
+	assert.Error(t, v.Verify(n))
+}
+
+func TestSNSVerifierCertURL(t *testing.T) {
+	signer := newTestSNSSigner(t)
+	defer signer.server.Close()
+	n := newTestSNSNotification("1")
+	signer.sign(t, n)
+
+	// Certificates are only downloaded from SNS
+	assert.Error(t, NewSNSVerifier().Verify(n))
+
+	v := NewSNSVerifier()
+	for _, certURL := range []string{
+		"http://sns.eu-west-1.amazonaws.com/SimpleNotificationService-test.pem",
+		"https://sns.eu-west-1.amazonaws.com.example.com/SimpleNotificationService-test.pem",
+		"https://example.com/SimpleNotificationService-test.pem",
+		"https://sns.eu-west-1.amazonaws.com/SimpleNotificationService-test.txt",
+	} {
+		_, err := v.getCert(certURL)
+		assert.Error(t, err, certURL)
+	}
+	assert.True(t, snsCertHost.MatchString("sns.eu-west-1.amazonaws.com"))
+	assert.True(t, snsCertHost.MatchString("sns.cn-north-1.amazonaws.com.cn"))
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return b
+}
@@ -1,21 +1,27 @@
 package aws
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 )
 
 const (
 	sqsMaxNumberOfMessages = 10
+	// SQSMaxWaitTime maximum time a receive waits for messages to arrive (long polling)
+	SQSMaxWaitTime = 20 * time.Second
 )
 
 // SQS handle simple SQS queue functions used by a consumer
 type SQS struct {
-	client *sqs.SQS
-	url    *string
+	client   sqsiface.SQSAPI
+	url      *string
+	waitTime time.Duration
 }
 
 type sqsMessageHandler func(*SQSMessage) error
@@ -29,6 +35,21 @@ func NewSQS(session *session.Session, queueURL *string) *SQS {
 	}
 }
 
+// WithURL obtains a copy of current SQS (sharing its client) which handles queue on queueURL
+func (s *SQS) WithURL(queueURL *string) *SQS {
+	r := *s
+	r.url = queueURL
+	return &r
+}
+
+// WithWaitTime obtains a copy of current SQS whose receives wait up to waitTime for messages to
+// arrive when queue is empty (long polling), reducing empty receives. 0 disables long polling
+func (s *SQS) WithWaitTime(waitTime time.Duration) *SQS {
+	r := *s
+	r.waitTime = waitTime
+	return &r
+}
+
 // ReceiveMessages receives messages from queue and executes message handler for each message
 // Returns the number of messages received and error (if any)
 // Fields present per message:
@@ -38,13 +59,18 @@ func NewSQS(session *session.Session, queueURL *string) *SQS {
 // ReceiptHandle: "base64encodedstring"
 // Returns an integer with the number of messages received, a boolean indicating that more possible
 // available messages are present on the queue, and the error (if any)
-func (s *SQS) ReceiveMessages(mh sqsMessageHandler) (int, bool, error) {
+// Cancelling ctx interrupts the receive (e.g. while waiting for messages on long polling)
+func (s *SQS) ReceiveMessages(ctx context.Context, mh sqsMessageHandler) (int, bool, error) {
 	received := 0
 	receiveMessageInput := &sqs.ReceiveMessageInput{
 		QueueUrl:            s.url,
 		MaxNumberOfMessages: aws.Int64(sqsMaxNumberOfMessages), // 1 to 10 (https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_ReceiveMessage.html)
+		AttributeNames:      []*string{aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount)},
 	}
-	resp, err := s.client.ReceiveMessage(receiveMessageInput)
+	if s.waitTime > 0 {
+		receiveMessageInput.WaitTimeSeconds = aws.Int64(int64(s.waitTime / time.Second))
+	}
+	resp, err := s.client.ReceiveMessageWithContext(ctx, receiveMessageInput)
 
 	if err != nil {
 		return 0, false, err
@@ -74,6 +100,33 @@ func (s *SQS) DeleteMessage(receiptHandle *string) error {
 	return err
 }
 
+// ChangeMessageVisibility makes a received message invisible to other consumers during timeout from now
+func (s *SQS) ChangeMessageVisibility(receiptHandle *string, timeout time.Duration) error {
+	_, err := s.client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          s.url,
+		ReceiptHandle:     receiptHandle,
+		VisibilityTimeout: aws.Int64(int64(timeout / time.Second)),
+	})
+	return err
+}
+
+// SendMessage sends a message with body and string attributes to queue
+func (s *SQS) SendMessage(body *string, attributes map[string]string) error {
+	input := &sqs.SendMessageInput{
+		QueueUrl:          s.url,
+		MessageBody:       body,
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+	}
+	for k, v := range attributes {
+		input.MessageAttributes[k] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	}
+	_, err := s.client.SendMessage(input)
+	return err
+}
+
 func (s *SQS) String() string {
 	return fmt.Sprintf("%s", *s.url)
 }
@@ -0,0 +1,141 @@
+// +build !integration
+
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQS returns batches of messages on each receive (an empty one when no batches left)
+type fakeSQS struct {
+	sqsiface.SQSAPI
+	batches           [][]*sqs.Message
+	receives          []*sqs.ReceiveMessageInput
+	visibilityChanges []*sqs.ChangeMessageVisibilityInput
+	deleteBatches     []*sqs.DeleteMessageBatchInput
+	visibilityBatches []*sqs.ChangeMessageVisibilityBatchInput
+	sent              []*sqs.SendMessageInput
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.receives = append(f.receives, input)
+	out := &sqs.ReceiveMessageOutput{}
+	if len(f.batches) > 0 {
+		out.Messages = f.batches[0]
+		f.batches = f.batches[1:]
+	}
+	return out, nil
+}
+
+func newFakeSQSMessages(n int) []*sqs.Message {
+	var messages []*sqs.Message
+	for i := 0; i < n; i++ {
+		messages = append(messages, &sqs.Message{
+			MessageId:     aws.String("id"),
+			ReceiptHandle: aws.String("receipt"),
+			Body:          aws.String("{}"),
+		})
+	}
+	return messages
+}
+
+func TestSQSReceiveMessagesLongPolling(t *testing.T) {
+	f := &fakeSQS{batches: [][]*sqs.Message{newFakeSQSMessages(10), newFakeSQSMessages(3)}}
+	s := (&SQS{client: f, url: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs")}).WithWaitTime(SQSMaxWaitTime)
+
+	n, more, err := s.ReceiveMessages(context.Background(), func(m *SQSMessage) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.True(t, more)
+	n, more, err = s.ReceiveMessages(context.Background(), func(m *SQSMessage) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.False(t, more)
+
+	if assert.Len(t, f.receives, 2) {
+		assert.Equal(t, int64(20), aws.Int64Value(f.receives[0].WaitTimeSeconds))
+		assert.Equal(t, int64(10), aws.Int64Value(f.receives[0].MaxNumberOfMessages))
+		assert.Equal(t, []string{"ApproximateReceiveCount"}, aws.StringValueSlice(f.receives[0].AttributeNames))
+	}
+}
+
+func TestSQSReceiveMessagesShortPolling(t *testing.T) {
+	f := &fakeSQS{}
+	s := (&SQS{client: f, url: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs")}).WithWaitTime(0)
+	n, more, err := s.ReceiveMessages(context.Background(), func(m *SQSMessage) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, more)
+	assert.Nil(t, f.receives[0].WaitTimeSeconds)
+}
+
+// blockingSQS waits for messages until receive is cancelled
+type blockingSQS struct {
+	sqsiface.SQSAPI
+}
+
+func (blockingSQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSQSReceiveMessagesCancelled(t *testing.T) {
+	s := (&SQS{client: blockingSQS{}, url: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs")}).WithWaitTime(SQSMaxWaitTime)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	n, more, err := s.ReceiveMessages(ctx, func(m *SQSMessage) error { return nil })
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, more)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.visibilityChanges = append(f.visibilityChanges, input)
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func TestSQSChangeMessageVisibility(t *testing.T) {
+	f := &fakeSQS{}
+	s := &SQS{client: f, url: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs")}
+	assert.NoError(t, s.ChangeMessageVisibility(aws.String("receipt"), 90*time.Second))
+	if assert.Len(t, f.visibilityChanges, 1) {
+		assert.Equal(t, "receipt", aws.StringValue(f.visibilityChanges[0].ReceiptHandle))
+		assert.Equal(t, int64(90), aws.Int64Value(f.visibilityChanges[0].VisibilityTimeout))
+	}
+}
+
+func (f *fakeSQS) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	f.sent = append(f.sent, input)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestSQSSendMessageToOtherQueue(t *testing.T) {
+	f := &fakeSQS{}
+	s := &SQS{client: f, url: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs")}
+	dlq := s.WithURL(aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs-dlq"))
+	assert.NoError(t, dlq.SendMessage(aws.String("{}"), map[string]string{"reason": "failed"}))
+	if assert.Len(t, f.sent, 1) {
+		assert.Equal(t, "https://sqs.eu-west-1.amazonaws.com/123456789012/logs-dlq", aws.StringValue(f.sent[0].QueueUrl))
+		assert.Equal(t, "{}", aws.StringValue(f.sent[0].MessageBody))
+		assert.Equal(t, "failed", aws.StringValue(f.sent[0].MessageAttributes["reason"].StringValue))
+	}
+	assert.Equal(t, "https://sqs.eu-west-1.amazonaws.com/123456789012/logs", s.String())
+}
+
+func TestSQSMessageReceiveCount(t *testing.T) {
+	m := newSQSMessage(&sqs.Message{MessageId: aws.String("id")})
+	assert.Equal(t, 1, m.ReceiveCount())
+	m.Attributes = map[string]*string{"ApproximateReceiveCount": aws.String("4")}
+	assert.Equal(t, 4, m.ReceiveCount())
+}
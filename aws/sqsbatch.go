@@ -0,0 +1,88 @@
+package aws
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SQSMaxBatchEntries maximum number of entries of a batch request
+const SQSMaxBatchEntries = 10
+
+// SQSVisibilityChange change of the visibility timeout of a received message
+type SQSVisibilityChange struct {
+	ReceiptHandle     *string
+	VisibilityTimeout time.Duration
+}
+
+// SQSBatchError error of an entry of a batch request
+type SQSBatchError struct {
+	Code        string
+	Message     string
+	SenderFault bool
+}
+
+func (e *SQSBatchError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// DeleteMessageBatch deletes up to SQSMaxBatchEntries messages on a single request
+// Returns the errors of the entries which failed indexed by their position on receiptHandles, and
+// the error of the request (if any)
+func (s *SQS) DeleteMessageBatch(receiptHandles []*string) (map[int]*SQSBatchError, error) {
+	input := &sqs.DeleteMessageBatchInput{
+		QueueUrl: s.url,
+	}
+	for i, r := range receiptHandles {
+		input.Entries = append(input.Entries, &sqs.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: r,
+		})
+	}
+	resp, err := s.client.DeleteMessageBatch(input)
+	if err != nil {
+		return nil, err
+	}
+	return batchErrors(resp.Failed), nil
+}
+
+// ChangeMessageVisibilityBatch changes the visibility timeout of up to SQSMaxBatchEntries messages
+// on a single request
+// Returns the errors of the entries which failed indexed by their position on changes, and the error
+// of the request (if any)
+func (s *SQS) ChangeMessageVisibilityBatch(changes []*SQSVisibilityChange) (map[int]*SQSBatchError, error) {
+	input := &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: s.url,
+	}
+	for i, c := range changes {
+		input.Entries = append(input.Entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			ReceiptHandle:     c.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(int64(c.VisibilityTimeout / time.Second)),
+		})
+	}
+	resp, err := s.client.ChangeMessageVisibilityBatch(input)
+	if err != nil {
+		return nil, err
+	}
+	return batchErrors(resp.Failed), nil
+}
+
+func batchErrors(failed []*sqs.BatchResultErrorEntry) map[int]*SQSBatchError {
+	errors := map[int]*SQSBatchError{}
+	for _, f := range failed {
+		i, err := strconv.Atoi(aws.StringValue(f.Id))
+		if err != nil {
+			continue
+		}
+		errors[i] = &SQSBatchError{
+			Code:        aws.StringValue(f.Code),
+			Message:     aws.StringValue(f.Message),
+			SenderFault: aws.BoolValue(f.SenderFault),
+		}
+	}
+	return errors
+}
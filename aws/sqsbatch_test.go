@@ -0,0 +1,69 @@
+// +build !integration
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func (f *fakeSQS) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	f.deleteBatches = append(f.deleteBatches, input)
+	out := &sqs.DeleteMessageBatchOutput{}
+	for _, e := range input.Entries {
+		if aws.StringValue(e.ReceiptHandle) == "invalid" {
+			out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{
+				Id:          e.Id,
+				Code:        aws.String("ReceiptHandleIsInvalid"),
+				Message:     aws.String("The receipt handle is not valid"),
+				SenderFault: aws.Bool(true),
+			})
+		} else {
+			out.Successful = append(out.Successful, &sqs.DeleteMessageBatchResultEntry{Id: e.Id})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	f.visibilityBatches = append(f.visibilityBatches, input)
+	out := &sqs.ChangeMessageVisibilityBatchOutput{}
+	for _, e := range input.Entries {
+		out.Successful = append(out.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: e.Id})
+	}
+	return out, nil
+}
+
+func TestSQSDeleteMessageBatch(t *testing.T) {
+	f := &fakeSQS{}
+	s := &SQS{client: f, url: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs")}
+	failed, err := s.DeleteMessageBatch([]*string{aws.String("r0"), aws.String("invalid"), aws.String("r2")})
+	assert.NoError(t, err)
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "ReceiptHandleIsInvalid", failed[1].Code)
+		assert.True(t, failed[1].SenderFault)
+	}
+	if assert.Len(t, f.deleteBatches, 1) {
+		assert.Len(t, f.deleteBatches[0].Entries, 3)
+		assert.Equal(t, "r2", aws.StringValue(f.deleteBatches[0].Entries[2].ReceiptHandle))
+	}
+}
+
+func TestSQSChangeMessageVisibilityBatch(t *testing.T) {
+	f := &fakeSQS{}
+	s := &SQS{client: f, url: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/logs")}
+	failed, err := s.ChangeMessageVisibilityBatch([]*SQSVisibilityChange{
+		{ReceiptHandle: aws.String("r0"), VisibilityTimeout: time.Minute},
+		{ReceiptHandle: aws.String("r1"), VisibilityTimeout: 30 * time.Second},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	if assert.Len(t, f.visibilityBatches, 1) {
+		assert.Equal(t, int64(60), aws.Int64Value(f.visibilityBatches[0].Entries[0].VisibilityTimeout))
+		assert.Equal(t, int64(30), aws.Int64Value(f.visibilityBatches[0].Entries[1].VisibilityTimeout))
+	}
+}
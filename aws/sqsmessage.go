@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"strconv"
 
 	"github.com/elastic/beats/libbeat/logp"
 
@@ -32,6 +33,16 @@ func (sm *SQSMessage) String() string {
 	return fmt.Sprintf("%+v", sm.String())
 }
 
+// ReceiveCount obtains the number of times the message has been received (1 if unknown)
+func (sm *SQSMessage) ReceiveCount() int {
+	if v, ok := sm.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]; ok && v != nil {
+		if n, err := strconv.Atoi(*v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
 // VerifyMD5Sum returns true if MD5 passed on message corresponds with the one
 // obtained from body.
 func (sm *SQSMessage) VerifyMD5Sum() bool {
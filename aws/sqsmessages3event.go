@@ -2,62 +2,186 @@ package aws
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/url"
-	"strings"
+	"time"
 
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
 )
 
-// SQSMessageS3Event SQS message providing from an S3 event
+const (
+	// s3TestEvent event sent by S3 to check notifications once they are configured
+	s3TestEvent = "s3:TestEvent"
+)
+
+var (
+	sqsMessagesEventBridge = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.eventBridge")
+	sqsMessagesCloudTrail  = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.cloudTrail")
+	sqsMessagesTestEvent   = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.testEvent")
+	sqsMessagesUnknown     = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.unknown")
+)
+
+// SQSMessageS3Event SQS message providing from an S3 event notification or an EventBridge event of S3,
+// sent directly or thru SNS (wrapped on an SNS envelope unless raw message delivery is enabled)
 type SQSMessageS3Event struct {
 	sqsMessage *SQSMessage
+	sns        *SNSNotification
 }
 
 type s3Event struct {
 	Records []struct {
-		EventSource string `json:"eventSource"`
-		AwsRegion   string `json:"awsRegion"`
-		EventName   string `json:"eventName"`
+		EventSource string    `json:"eventSource"`
+		AwsRegion   string    `json:"awsRegion"`
+		EventTime   time.Time `json:"eventTime"`
+		EventName   string    `json:"eventName"`
 		S3          struct {
 			Bucket struct {
 				Name string `json:"name"`
 			} `json:"bucket"`
 			Object struct {
 				Key  string `json:"key"`
-				Size int    `json:"size"`
+				Size int64  `json:"size"`
+				ETag string `json:"eTag"`
 			} `json:"object"`
 		} `json:"s3"`
 	} `json:"Records"`
 }
 
+// cloudTrailNotification notification sent by CloudTrail to SNS when it delivers log files to S3
+type cloudTrailNotification struct {
+	S3Bucket    string   `json:"s3Bucket"`
+	S3ObjectKey []string `json:"s3ObjectKey"`
+}
+
+// s3Notification any of the notifications of S3 objects received on SQS: S3 event notifications
+// (Records), EventBridge events of S3 (source aws.s3), CloudTrail log file deliveries and test events
+// sent by S3
+type s3Notification struct {
+	s3Event
+	eventBridgeEvent
+	cloudTrailNotification
+	Event  string `json:"Event"`
+	Bucket string `json:"Bucket"`
+}
+
 // NewSQSMessageS3Event creates a new SQS message from S3 event based on an SQS message
 func NewSQSMessageS3Event(sqsMessage *SQSMessage) *SQSMessageS3Event {
-	return &SQSMessageS3Event{
+	s := &SQSMessageS3Event{
 		sqsMessage: sqsMessage,
 	}
+	if n, ok := ParseSNSNotification(*sqsMessage.Body); ok {
+		s.sns = n
+	}
+	return s
+}
+
+// GetSNSNotification obtains the SNS envelope in which the S3 event was received (nil if not received
+// thru SNS or raw message delivery is enabled)
+func (s *SQSMessageS3Event) GetSNSNotification() *SNSNotification {
+	return s.sns
+}
+
+// VerifySNSSignature verifies the signature of the SNS envelope with verifier. Messages without SNS
+// envelope (e.g. sent directly or thru SNS with raw message delivery) are not signed, so they fail
+func (s *SQSMessageS3Event) VerifySNSSignature(verifier *SNSVerifier) error {
+	if s.sns == nil {
+		return fmt.Errorf("Not an SNS notification, so its signature can not be verified")
+	}
+	return verifier.Verify(s.sns)
+}
+
+// body obtains the S3 event, unwrapping it from its SNS envelope
+func (s *SQSMessageS3Event) body() string {
+	if s.sns != nil {
+		return s.sns.Message
+	}
+	return *s.sqsMessage.Body
 }
 
-// ExtractNewObjects extracts those new S3 objects present on an SQS message
-// Returns the number of new S3 objects extracted
+// ExtractNewObjects extracts those S3 objects present on an SQS message, whatever the event
+// which notified them (event name is kept on each object to be filtered by callers). S3 events
+// wrapped on SNS envelopes are unwrapped without verifying them (see VerifySNSSignature)
+// Returns the number of S3 objects extracted
 func (s *SQSMessageS3Event) ExtractNewObjects(mh func(*S3Object) error) (uint64, error) {
-	var s3e s3Event
-	if err := json.Unmarshal([]byte(*s.sqsMessage.Body), &s3e); err != nil {
+	if s.sns != nil && s.sns.Type != SNSTypeNotification {
+		logp.Warn("Ignoring SNS message %s", s.sns.String())
+		return 0, nil
+	}
+	var n s3Notification
+	if err := json.Unmarshal([]byte(s.body()), &n); err != nil {
+		sqsMessagesUnknown.Add(1)
 		logp.Warn("Couldn't parse json from S3. Ignoring this SQS mess. Error: %v", err)
 		return 0, nil
 	}
+	switch {
+	case n.Records != nil:
+		return s.extractRecords(&n.s3Event, mh)
+	case n.Source == EventBridgeSourceS3:
+		sqsMessagesEventBridge.Add(1)
+		if err := mh(n.eventBridgeEvent.s3Object()); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	case n.S3Bucket != "" && n.S3ObjectKey != nil:
+		sqsMessagesCloudTrail.Add(1)
+		return s.extractCloudTrailObjects(&n.cloudTrailNotification, mh)
+	case n.Event == s3TestEvent:
+		sqsMessagesTestEvent.Add(1)
+		logp.Info("Ignoring S3 test event of bucket %s on SQS message with ID %s", n.Bucket, *s.sqsMessage.MessageId)
+		return 0, nil
+	}
+	sqsMessagesUnknown.Add(1)
+	logp.Warn("Ignoring SQS message with ID %s as it is neither an S3 event notification, an EventBridge event of S3 nor a CloudTrail notification", *s.sqsMessage.MessageId)
+	return 0, nil
+}
+
+// extractRecords extracts the S3 objects present on the records of an S3 event notification
+func (s *SQSMessageS3Event) extractRecords(s3e *s3Event, mh func(*S3Object) error) (uint64, error) {
 	var c uint64
 	for _, e := range s3e.Records {
-		if e.EventSource == "aws:s3" && strings.HasPrefix(e.EventName, "ObjectCreated:") {
+		if e.EventSource == "aws:s3" {
 			if s3key, err := url.QueryUnescape(e.S3.Object.Key); err != nil {
 				logp.Warn("Could not unescape S3 object: %s", e.S3.Object.Key)
 			} else {
 				c++
-				if err := mh(NewS3Object(e.S3.Bucket.Name, s3key)); err != nil {
+				o := NewS3Object(e.S3.Bucket.Name, s3key)
+				o.Size = e.S3.Object.Size
+				o.SizeKnown = true
+				o.ETag = e.S3.Object.ETag
+				o.EventTime = e.EventTime
+				o.EventName = e.EventName
+				if err := mh(o); err != nil {
 					// Client want to cancel process, passing as an error to parent
 					return 0, err
 				}
 			}
 		}
 	}
+	if c == 0 {
+		sqsMessagesUnknown.Add(1)
+		logp.Warn("No S3 records present on SQS message with ID %s", *s.sqsMessage.MessageId)
+	}
+	return c, nil
+}
+
+// extractCloudTrailObjects extracts the log files delivered by CloudTrail. Keys are not URL encoded and
+// notifications have neither event name nor size, so objects are not filtered by them. If the
+// notification was received thru SNS, its timestamp is used as event time
+func (s *SQSMessageS3Event) extractCloudTrailObjects(n *cloudTrailNotification, mh func(*S3Object) error) (uint64, error) {
+	var eventTime time.Time
+	if s.sns != nil {
+		eventTime, _ = time.Parse(time.RFC3339, s.sns.Timestamp)
+	}
+	var c uint64
+	for _, key := range n.S3ObjectKey {
+		c++
+		o := NewS3Object(n.S3Bucket, key)
+		o.EventTime = eventTime
+		if err := mh(o); err != nil {
+			// Client want to cancel process, passing as an error to parent
+			return 0, err
+		}
+	}
 	return c, nil
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
@@ -93,6 +94,11 @@ func TestS3CreateEventCorrectSimple(t *testing.T) {
 	c, err := s.ExtractNewObjects(func(s *S3Object) error {
 		assert.Equal(t, "mybucket", s.Bucket)
 		assert.Equal(t, "app-env-3/AWSLogs/123456789012/elasticloadbalancing/eu-west-1/2018/07/07/123456789012_elasticloadbalancing_eu-west-1_app.app-env-3.ad4ceee8a897566c_20180707T0935Z_52.17.184.44_4vsrpn7y.log.gz", s.Key)
+		assert.Equal(t, int64(14313), s.Size)
+		assert.True(t, s.SizeKnown)
+		assert.Equal(t, "0f0c79b67cf091c2228c16640d75ff3b", s.ETag)
+		assert.Equal(t, time.Date(2018, 7, 7, 9, 35, 10, 990000000, time.UTC), s.EventTime)
+		assert.Equal(t, "ObjectCreated:Put", s.EventName)
 		return nil
 	})
 	assert.NoError(t, err)
@@ -277,3 +283,33 @@ func TestS3CreateEventMultiPartUpload(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(1), c)
 }
+
+const cloudTrailNotificationBody = `{"s3Bucket":"org-trail","s3ObjectKey":[` +
+	`"AWSLogs/o-abc123/123456789012/CloudTrail/eu-west-1/2019/05/07/123456789012_CloudTrail_eu-west-1_20190507T1000Z_a1.json.gz",` +
+	`"AWSLogs/o-abc123/210987654321/CloudTrail/eu-west-1/2019/05/07/210987654321_CloudTrail_eu-west-1_20190507T1000Z_b2.json.gz"]}`
+
+func TestCloudTrailNotification(t *testing.T) {
+	cloudTrail := sqsMessagesCloudTrail.Get()
+	objects := extractTestObjects(t, cloudTrailNotificationBody)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "org-trail", objects[0].Bucket)
+		assert.Equal(t, "AWSLogs/o-abc123/123456789012/CloudTrail/eu-west-1/2019/05/07/123456789012_CloudTrail_eu-west-1_20190507T1000Z_a1.json.gz", objects[0].Key)
+		assert.Equal(t, "org-trail", objects[1].Bucket)
+		assert.Equal(t, "AWSLogs/o-abc123/210987654321/CloudTrail/eu-west-1/2019/05/07/210987654321_CloudTrail_eu-west-1_20190507T1000Z_b2.json.gz", objects[1].Key)
+		assert.Equal(t, "", objects[0].EventName)
+		assert.True(t, objects[0].EventTime.IsZero())
+		assert.False(t, objects[0].SizeKnown)
+	}
+	assert.Equal(t, cloudTrail+1, sqsMessagesCloudTrail.Get())
+}
+
+func TestCloudTrailNotificationFromSNS(t *testing.T) {
+	n := newTestSNSNotification("1")
+	n.Subject = ""
+	n.Message = cloudTrailNotificationBody
+	objects := extractTestObjects(t, string(mustMarshal(t, n)))
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "org-trail", objects[0].Bucket)
+		assert.Equal(t, time.Date(2019, 5, 7, 10, 0, 1, 0, time.UTC), objects[1].EventTime)
+	}
+}
@@ -0,0 +1,168 @@
+package azure
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// storageVersion version of the storage REST API used
+const storageVersion = "2019-02-02"
+
+// Account Azure storage account whose blobs and queues are accessed through REST API, authorizing
+// requests with Shared Key or SAS token
+type Account struct {
+	name          string
+	key           []byte
+	sas           url.Values
+	blobEndpoint  string
+	queueEndpoint string
+	client        *http.Client
+}
+
+// Error error returned by Azure storage services
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Azure storage error (status %d): %s %s", e.StatusCode, e.Code, strings.TrimSpace(e.Message))
+}
+
+// do executes a request with method on u, returning an error if response is not successful
+func (a *Account) do(method string, u *url.URL, body []byte) (*http.Response, error) {
+	if a.sas != nil {
+		q := u.Query()
+		for k, v := range a.sas {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", storageVersion)
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	if a.key != nil && a.sas == nil {
+		req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", a.name, a.sign(req, len(body))))
+	}
+
+	client := a.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		e := &Error{StatusCode: resp.StatusCode}
+		content, _ := ioutil.ReadAll(resp.Body)
+		xml.Unmarshal(content, e)
+		if e.Code == "" {
+			e.Code = resp.Header.Get("x-ms-error-code")
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// doXML executes a request with method on u decoding its XML response into out
+func (a *Account) doXML(method string, u *url.URL, out interface{}) error {
+	resp, err := a.do(method, u, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
+
+// discard executes a request with method on u ignoring its response body
+func (a *Account) discard(method string, u *url.URL, body []byte) (http.Header, error) {
+	resp, err := a.do(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Header, nil
+}
+
+// sign obtains the Shared Key signature of req, whose body has contentLength bytes
+// (https://docs.microsoft.com/rest/api/storageservices/authorize-with-shared-key)
+func (a *Account) sign(req *http.Request, contentLength int) string {
+	length := ""
+	if contentLength > 0 {
+		length = strconv.Itoa(contentLength)
+	}
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date (x-ms-date is used instead)
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalizedHeaders(req.Header) + a.canonicalizedResource(req.URL),
+	}, "\n")
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// canonicalizedHeaders obtains x-ms-* headers sorted, each one on its own line
+func canonicalizedHeaders(header http.Header) string {
+	var names []string
+	for name := range header {
+		if n := strings.ToLower(name); strings.HasPrefix(n, "x-ms-") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		fmt.Fprintf(&b, "%s:%s\n", n, strings.TrimSpace(header.Get(n)))
+	}
+	return b.String()
+}
+
+// canonicalizedResource obtains the account and path of u followed by its query parameters sorted
+func (a *Account) canonicalizedResource(u *url.URL) string {
+	var b strings.Builder
+	b.WriteString("/" + a.name + u.EscapedPath())
+	query := u.Query()
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		values := query[n]
+		sort.Strings(values)
+		fmt.Fprintf(&b, "\n%s:%s", strings.ToLower(n), strings.Join(values, ","))
+	}
+	return b.String()
+}
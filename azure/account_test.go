@@ -0,0 +1,32 @@
+// +build !integration
+
+package azure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedKeySignature(t *testing.T) {
+	a, err := NewAccount(&Config{ConnectionString: "UseDevelopmentStorage=true"})
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:10001/devstoreaccount1/logs/messages?visibilitytimeout=300&numofmessages=32", nil)
+	req.Header.Set("x-ms-version", storageVersion)
+	req.Header.Set("x-ms-date", "Mon, 20 May 2019 10:00:00 GMT")
+
+	expected := "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+		"x-ms-date:Mon, 20 May 2019 10:00:00 GMT\nx-ms-version:" + storageVersion + "\n" +
+		"/devstoreaccount1/devstoreaccount1/logs/messages\nnumofmessages:32\nvisibilitytimeout:300"
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(expected))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(h.Sum(nil)), a.sign(req, 0))
+
+	// Content length is part of the signature when there is a body
+	assert.NotEqual(t, a.sign(req, 0), a.sign(req, 10))
+}
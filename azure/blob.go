@@ -0,0 +1,102 @@
+package azure
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+// Blob handle simple Blob Storage methods. Containers are represented as buckets and blobs as keys
+// of S3 objects, so Blob Storage can be used as the storage of any input
+type Blob struct {
+	account *Account
+}
+
+type enumerationResults struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			ContentLength int64  `xml:"Content-Length"`
+			LastModified  string `xml:"Last-Modified"`
+			ETag          string `xml:"Etag"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// NewBlob is a construct function for creating the object with the account as argument
+func NewBlob(account *Account) *Blob {
+	return &Blob{
+		account: account,
+	}
+}
+
+// GetReadCloser returns a io.ReadCloser to be readed (and then closed) by another method.
+// Content is decompressed if needed
+func (b *Blob) GetReadCloser(o *aws.S3Object) (io.ReadCloser, error) {
+	resp, err := b.account.do("GET", b.url(o.Bucket, o.Key), nil)
+	if err != nil {
+		return nil, err
+	}
+	return aws.NewS3ReadCloser(resp.Body, resp.Header.Get("Content-Encoding"))
+}
+
+// ListObjects lists blobs present on container o.Bucket and prefix o.Key
+func (b *Blob) ListObjects(o *aws.S3Object, oh aws.S3ObjectHandler) (int, error) {
+	received := 0
+	marker := ""
+	for {
+		u := b.url(o.Bucket, "")
+		query := url.Values{
+			"restype": {"container"},
+			"comp":    {"list"},
+			"prefix":  {o.Key},
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		u.RawQuery = query.Encode()
+		var page enumerationResults
+		if err := b.account.doXML("GET", u, &page); err != nil {
+			return received, err
+		}
+		received += len(page.Blobs)
+		for _, i := range page.Blobs {
+			lastModified, _ := time.Parse(http.TimeFormat, i.Properties.LastModified)
+			err := oh(aws.NewS3ObjectWithOriginal(o.Bucket, &s3.Object{
+				Key:          awssdk.String(i.Name),
+				Size:         awssdk.Int64(i.Properties.ContentLength),
+				ETag:         awssdk.String(i.Properties.ETag),
+				LastModified: awssdk.Time(lastModified),
+			}))
+			if err != nil {
+				return received, nil
+			}
+		}
+		if page.NextMarker == "" {
+			return received, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// url obtains the URL of blob on container (or the URL of container if blob is empty)
+func (b *Blob) url(container, blob string) *url.URL {
+	path := url.PathEscape(container)
+	if blob != "" {
+		segments := strings.Split(blob, "/")
+		for i, s := range segments {
+			segments[i] = url.PathEscape(s)
+		}
+		path += "/" + strings.Join(segments, "/")
+	}
+	u, _ := url.Parse(fmt.Sprintf("%s/%s", b.account.blobEndpoint, path))
+	return u
+}
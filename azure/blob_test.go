@@ -0,0 +1,111 @@
+// +build !integration
+
+package azure
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBlobServer serves blobs of container logs as Azurite does (two blobs per page)
+type fakeBlobServer struct {
+	blobs map[string][]byte
+	names []string
+}
+
+func (f *fakeBlobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const container = "/devstoreaccount1/logs"
+	switch {
+	case r.URL.Path == container && r.URL.Query().Get("comp") == "list":
+		start := len(r.URL.Query().Get("marker"))
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+		listed, next := 0, ""
+		for i := start; i < len(f.names); i++ {
+			if !strings.HasPrefix(f.names[i], r.URL.Query().Get("prefix")) {
+				continue
+			}
+			if listed == 2 {
+				next = strings.Repeat("x", i)
+				break
+			}
+			listed++
+			fmt.Fprintf(w, "<Blob><Name>%s</Name><Properties><Last-Modified>Mon, 20 May 2019 10:00:00 GMT</Last-Modified><Etag>0x1</Etag><Content-Length>3</Content-Length></Properties></Blob>", f.names[i])
+		}
+		fmt.Fprintf(w, "</Blobs><NextMarker>%s</NextMarker></EnumerationResults>", next)
+	case strings.HasPrefix(r.URL.Path, container+"/"):
+		content, ok := f.blobs[strings.TrimPrefix(r.URL.Path, container+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>BlobNotFound</Code><Message>The specified blob does not exist.</Message></Error>`)
+			return
+		}
+		w.Write(content)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeBlob(t *testing.T) (*Blob, func()) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte("line 1\nline 2\n"))
+	w.Close()
+
+	server := httptest.NewServer(&fakeBlobServer{
+		blobs: map[string][]byte{
+			"app/a.log":      []byte("line 1\nline 2\n"),
+			"app/dir/b.gz":   compressed.Bytes(),
+			"app/with space": []byte("line 1\nline 2\n"),
+		},
+		names: []string{"app/a.log", "app/dir/b.gz", "app/with space", "other/c.log"},
+	})
+	account, err := NewAccount(&Config{ConnectionString: "UseDevelopmentStorage=true"})
+	assert.NoError(t, err)
+	account.blobEndpoint = server.URL + "/devstoreaccount1"
+	return NewBlob(account), server.Close
+}
+
+func TestBlobGetReadCloser(t *testing.T) {
+	b, close := newFakeBlob(t)
+	defer close()
+
+	for _, key := range []string{"app/a.log", "app/dir/b.gz", "app/with space"} {
+		rc, err := b.GetReadCloser(aws.NewS3Object("logs", key))
+		if assert.NoError(t, err, key) {
+			content, err := ioutil.ReadAll(rc)
+			rc.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, "line 1\nline 2\n", string(content), key)
+		}
+	}
+
+	_, err := b.GetReadCloser(aws.NewS3Object("logs", "app/unknown.log"))
+	if assert.Error(t, err) {
+		assert.Equal(t, "BlobNotFound", err.(*Error).Code)
+	}
+}
+
+func TestBlobListObjects(t *testing.T) {
+	b, close := newFakeBlob(t)
+	defer close()
+
+	var keys []string
+	n, err := b.ListObjects(aws.NewS3Object("logs", "app/"), func(o *aws.S3ObjectWithOriginal) error {
+		keys = append(keys, o.S3Object.Key)
+		assert.Equal(t, int64(3), o.S3Object.Size)
+		assert.Equal(t, 2019, o.S3Object.LastModified.Year())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"app/a.log", "app/dir/b.gz", "app/with space"}, keys)
+}
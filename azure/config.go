@@ -0,0 +1,137 @@
+package azure
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	connectionStringEnv   = "AZURE_STORAGE_CONNECTION_STRING"
+	defaultEndpointSuffix = "core.windows.net"
+
+	// Well-known account of Azurite (and the storage emulator), used by UseDevelopmentStorage=true
+	devStoreAccountName   = "devstoreaccount1"
+	devStoreAccountKey    = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	devStoreBlobEndpoint  = "http://127.0.0.1:10000/devstoreaccount1"
+	devStoreQueueEndpoint = "http://127.0.0.1:10001/devstoreaccount1"
+)
+
+// Config configures the access to an Azure storage account, using either a connection string or
+// an account name with its key (Shared Key) or a SAS token. If nothing is set, connection string is
+// obtained from environment variable AZURE_STORAGE_CONNECTION_STRING
+type Config struct {
+	ConnectionString string `config:"connection_string"`
+	AccountName      string `config:"account_name"`
+	AccountKey       string `config:"account_key"`
+	SASToken         string `config:"sas_token"`
+	BlobEndpoint     string `config:"blob_endpoint"`
+	QueueEndpoint    string `config:"queue_endpoint"`
+}
+
+// Validate validates Azure config logic
+func (c *Config) Validate() error {
+	if c.ConnectionString != "" && c.AccountName != "" {
+		return fmt.Errorf("Set either connection_string or account_name (but not both)")
+	}
+	if c.AccountName != "" && c.AccountKey == "" && c.SASToken == "" {
+		return fmt.Errorf("account_name requires account_key or sas_token")
+	}
+	if c.AccountKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(c.AccountKey); err != nil {
+			return fmt.Errorf("Could not decode base64 account_key: %v", err)
+		}
+	}
+	return nil
+}
+
+// NewAccount creates the storage account configured
+func NewAccount(c *Config) (*Account, error) {
+	connectionString := c.ConnectionString
+	if connectionString == "" && c.AccountName == "" {
+		connectionString = os.Getenv(connectionStringEnv)
+		if connectionString == "" {
+			return nil, fmt.Errorf("No Azure storage account configured (set connection_string or account_name)")
+		}
+	}
+	settings := map[string]string{
+		"AccountName":           c.AccountName,
+		"AccountKey":            c.AccountKey,
+		"SharedAccessSignature": c.SASToken,
+		"BlobEndpoint":          c.BlobEndpoint,
+		"QueueEndpoint":         c.QueueEndpoint,
+	}
+	if connectionString != "" {
+		var err error
+		if settings, err = parseConnectionString(connectionString); err != nil {
+			return nil, err
+		}
+	}
+	return newAccountFromSettings(settings)
+}
+
+// parseConnectionString parses a connection string with format key1=value1;key2=value2
+func parseConnectionString(connectionString string) (map[string]string, error) {
+	settings := map[string]string{}
+	for _, part := range strings.Split(connectionString, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid Azure storage connection string (setting %q)", kv[0])
+		}
+		settings[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	if strings.EqualFold(settings["UseDevelopmentStorage"], "true") {
+		settings["AccountName"] = devStoreAccountName
+		settings["AccountKey"] = devStoreAccountKey
+		settings["BlobEndpoint"] = devStoreBlobEndpoint
+		settings["QueueEndpoint"] = devStoreQueueEndpoint
+	}
+	return settings, nil
+}
+
+func newAccountFromSettings(settings map[string]string) (*Account, error) {
+	a := &Account{
+		name:          settings["AccountName"],
+		blobEndpoint:  strings.TrimSuffix(settings["BlobEndpoint"], "/"),
+		queueEndpoint: strings.TrimSuffix(settings["QueueEndpoint"], "/"),
+	}
+	if a.name == "" {
+		return nil, fmt.Errorf("No Azure storage account name configured")
+	}
+	if key := settings["AccountKey"]; key != "" {
+		var err error
+		if a.key, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return nil, fmt.Errorf("Could not decode base64 account key: %v", err)
+		}
+	}
+	if sas := strings.TrimPrefix(settings["SharedAccessSignature"], "?"); sas != "" {
+		var err error
+		if a.sas, err = url.ParseQuery(sas); err != nil {
+			return nil, fmt.Errorf("Invalid SAS token: %v", err)
+		}
+	}
+	if a.key == nil && a.sas == nil {
+		return nil, fmt.Errorf("No account key or SAS token configured for Azure storage account %s", a.name)
+	}
+
+	protocol := settings["DefaultEndpointsProtocol"]
+	if protocol == "" {
+		protocol = "https"
+	}
+	suffix := settings["EndpointSuffix"]
+	if suffix == "" {
+		suffix = defaultEndpointSuffix
+	}
+	if a.blobEndpoint == "" {
+		a.blobEndpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, a.name, suffix)
+	}
+	if a.queueEndpoint == "" {
+		a.queueEndpoint = fmt.Sprintf("%s://%s.queue.%s", protocol, a.name, suffix)
+	}
+	return a, nil
+}
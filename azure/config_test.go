@@ -0,0 +1,59 @@
+// +build !integration
+
+package azure
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, (&Config{}).Validate())
+	assert.NoError(t, (&Config{AccountName: "logs", AccountKey: devStoreAccountKey}).Validate())
+	assert.NoError(t, (&Config{AccountName: "logs", SASToken: "sv=2019-02-02&sig=abc"}).Validate())
+	assert.Error(t, (&Config{AccountName: "logs"}).Validate())
+	assert.Error(t, (&Config{AccountName: "logs", AccountKey: "not base64!"}).Validate())
+	assert.Error(t, (&Config{AccountName: "logs", AccountKey: devStoreAccountKey, ConnectionString: "UseDevelopmentStorage=true"}).Validate())
+}
+
+func TestNewAccountFromDevelopmentStorage(t *testing.T) {
+	a, err := NewAccount(&Config{ConnectionString: "UseDevelopmentStorage=true"})
+	assert.NoError(t, err)
+	assert.Equal(t, devStoreAccountName, a.name)
+	assert.Equal(t, devStoreBlobEndpoint, a.blobEndpoint)
+	assert.Equal(t, devStoreQueueEndpoint, a.queueEndpoint)
+	assert.NotEmpty(t, a.key)
+}
+
+func TestNewAccountFromConnectionString(t *testing.T) {
+	a, err := NewAccount(&Config{ConnectionString: "DefaultEndpointsProtocol=https;AccountName=logs;AccountKey=" + devStoreAccountKey + ";EndpointSuffix=core.chinacloudapi.cn"})
+	assert.NoError(t, err)
+	assert.Equal(t, "logs", a.name)
+	assert.Equal(t, "https://logs.blob.core.chinacloudapi.cn", a.blobEndpoint)
+	assert.Equal(t, "https://logs.queue.core.chinacloudapi.cn", a.queueEndpoint)
+
+	a, err = NewAccount(&Config{ConnectionString: "AccountName=logs;SharedAccessSignature=?sv=2019-02-02&sig=abc;QueueEndpoint=http://localhost:10001/logs/"})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:10001/logs", a.queueEndpoint)
+	assert.Equal(t, "abc", a.sas.Get("sig"))
+	assert.Nil(t, a.key)
+
+	_, err = NewAccount(&Config{ConnectionString: "AccountName=logs"})
+	assert.Error(t, err)
+	_, err = NewAccount(&Config{ConnectionString: "AccountName"})
+	assert.Error(t, err)
+}
+
+func TestNewAccountFromEnvironment(t *testing.T) {
+	os.Unsetenv(connectionStringEnv)
+	_, err := NewAccount(&Config{})
+	assert.Error(t, err)
+
+	os.Setenv(connectionStringEnv, "UseDevelopmentStorage=true")
+	defer os.Unsetenv(connectionStringEnv)
+	a, err := NewAccount(&Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, devStoreAccountName, a.name)
+}
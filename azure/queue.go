@@ -0,0 +1,93 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	queueMaxNumberOfMessages = 32
+)
+
+// Queue handles simple Storage Queue functions used by a consumer
+type Queue struct {
+	account           *Account
+	name              string
+	visibilityTimeout time.Duration
+}
+
+type queueMessageHandler func(*QueueMessage) error
+
+type queueMessagesList struct {
+	Messages []*QueueMessage `xml:"QueueMessage"`
+}
+
+// NewQueue is a construct function for creating the object with the account and the name of the
+// queue as arguments. Messages received are invisible to other consumers during visibilityTimeout
+func NewQueue(account *Account, name string, visibilityTimeout time.Duration) *Queue {
+	return &Queue{
+		account:           account,
+		name:              name,
+		visibilityTimeout: visibilityTimeout,
+	}
+}
+
+// ReceiveMessages receives messages from queue and executes message handler for each message
+// Returns an integer with the number of messages received, a boolean indicating that more possible
+// available messages are present on the queue, and the error (if any)
+func (q *Queue) ReceiveMessages(mh queueMessageHandler) (int, bool, error) {
+	u := q.url("messages")
+	u.RawQuery = url.Values{
+		"numofmessages":     {strconv.Itoa(queueMaxNumberOfMessages)},
+		"visibilitytimeout": {strconv.Itoa(int(q.visibilityTimeout / time.Second))},
+	}.Encode()
+	var list queueMessagesList
+	if err := q.account.doXML("GET", u, &list); err != nil {
+		return 0, false, err
+	}
+	for _, m := range list.Messages {
+		if err := mh(m); err != nil {
+			return 0, false, err
+		}
+	}
+	return len(list.Messages), len(list.Messages) == queueMaxNumberOfMessages, nil
+}
+
+// DeleteMessage deletes a message from queue using its last pop receipt
+func (q *Queue) DeleteMessage(messageID, popReceipt string) error {
+	u := q.url("messages/" + url.PathEscape(messageID))
+	u.RawQuery = url.Values{"popreceipt": {popReceipt}}.Encode()
+	_, err := q.account.discard("DELETE", u, nil)
+	return err
+}
+
+// ExtendVisibility keeps a message invisible to other consumers during visibility timeout from now.
+// Returns the new pop receipt of the message, which has to be used on next operations
+func (q *Queue) ExtendVisibility(messageID, popReceipt string) (string, error) {
+	u := q.url("messages/" + url.PathEscape(messageID))
+	u.RawQuery = url.Values{
+		"popreceipt":        {popReceipt},
+		"visibilitytimeout": {strconv.Itoa(int(q.visibilityTimeout / time.Second))},
+	}.Encode()
+	header, err := q.account.discard("PUT", u, nil)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("x-ms-popreceipt"), nil
+}
+
+// VisibilityTimeout obtains the time messages received are invisible to other consumers
+func (q *Queue) VisibilityTimeout() time.Duration {
+	return q.visibilityTimeout
+}
+
+func (q *Queue) url(path string) *url.URL {
+	u, _ := url.Parse(fmt.Sprintf("%s/%s/%s", q.account.queueEndpoint, url.PathEscape(q.name), path))
+	return u
+}
+
+func (q *Queue) String() string {
+	return fmt.Sprintf("%s/%s", q.account.queueEndpoint, q.name)
+}
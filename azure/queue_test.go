@@ -0,0 +1,130 @@
+// +build !integration
+
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQueueServer serves queue logs of account devstoreaccount1 as Azurite does
+type fakeQueueServer struct {
+	mutex    sync.Mutex
+	messages []string
+	requests []*http.Request
+	receipts int
+	deleted  []string
+}
+
+func (f *fakeQueueServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests = append(f.requests, r)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey devstoreaccount1:") && r.URL.Query().Get("sig") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>AuthorizationFailure</Code><Message>Not authorized</Message></Error>`)
+		return
+	}
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/devstoreaccount1/logs/messages":
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><QueueMessagesList>`)
+		for i, text := range f.messages {
+			fmt.Fprintf(w, "<QueueMessage><MessageId>m%d</MessageId><PopReceipt>r%d</PopReceipt><DequeueCount>1</DequeueCount><MessageText>%s</MessageText></QueueMessage>", i, i, text)
+		}
+		fmt.Fprint(w, `</QueueMessagesList>`)
+		f.messages = nil
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/devstoreaccount1/logs/messages/"):
+		f.receipts++
+		w.Header().Set("x-ms-popreceipt", fmt.Sprintf("renewed%d", f.receipts))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/devstoreaccount1/logs/messages/"):
+		f.deleted = append(f.deleted, strings.TrimPrefix(r.URL.Path, "/devstoreaccount1/logs/messages/")+":"+r.URL.Query().Get("popreceipt"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>QueueNotFound</Code><Message>The specified queue does not exist.</Message></Error>`)
+	}
+}
+
+func newFakeQueue(t *testing.T, f *fakeQueueServer, name string) (*Queue, func()) {
+	server := httptest.NewServer(f)
+	account, err := NewAccount(&Config{ConnectionString: "UseDevelopmentStorage=true"})
+	assert.NoError(t, err)
+	account.queueEndpoint = server.URL + "/devstoreaccount1"
+	return NewQueue(account, name, 5*time.Minute), server.Close
+}
+
+func TestQueueReceiveMessages(t *testing.T) {
+	f := &fakeQueueServer{messages: []string{"first", "second"}}
+	q, close := newFakeQueue(t, f, "logs")
+	defer close()
+
+	var received []*QueueMessage
+	n, more, err := q.ReceiveMessages(func(m *QueueMessage) error {
+		received = append(received, m)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.False(t, more)
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, "m1", received[1].MessageID)
+		assert.Equal(t, "r1", received[1].PopReceipt)
+		assert.Equal(t, "second", received[1].MessageText)
+	}
+	assert.Equal(t, "300", f.requests[0].URL.Query().Get("visibilitytimeout"))
+	assert.Equal(t, "32", f.requests[0].URL.Query().Get("numofmessages"))
+	assert.Equal(t, storageVersion, f.requests[0].Header.Get("x-ms-version"))
+}
+
+func TestQueueExtendVisibilityAndDelete(t *testing.T) {
+	f := &fakeQueueServer{}
+	q, close := newFakeQueue(t, f, "logs")
+	defer close()
+
+	popReceipt, err := q.ExtendVisibility("m0", "r0")
+	assert.NoError(t, err)
+	assert.Equal(t, "renewed1", popReceipt)
+	assert.NoError(t, q.DeleteMessage("m0", popReceipt))
+	assert.Equal(t, []string{"m0:renewed1"}, f.deleted)
+}
+
+func TestQueueErrors(t *testing.T) {
+	f := &fakeQueueServer{}
+	q, close := newFakeQueue(t, f, "unknown")
+	defer close()
+
+	_, _, err := q.ReceiveMessages(func(m *QueueMessage) error { return nil })
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusNotFound, err.(*Error).StatusCode)
+		assert.Equal(t, "QueueNotFound", err.(*Error).Code)
+	}
+
+	// Requests are not authorized without key
+	q.account.key = nil
+	_, _, err = q.ReceiveMessages(func(m *QueueMessage) error { return nil })
+	if assert.Error(t, err) {
+		assert.Equal(t, "AuthorizationFailure", err.(*Error).Code)
+	}
+}
+
+func TestQueueWithSASToken(t *testing.T) {
+	f := &fakeQueueServer{messages: []string{"first"}}
+	server := httptest.NewServer(f)
+	defer server.Close()
+	account, err := NewAccount(&Config{AccountName: "devstoreaccount1", SASToken: "?sv=2019-02-02&sig=abc", QueueEndpoint: server.URL + "/devstoreaccount1"})
+	assert.NoError(t, err)
+
+	n, _, err := NewQueue(account, "logs", time.Minute).ReceiveMessages(func(m *QueueMessage) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, f.requests[0].Header.Get("Authorization"))
+	assert.Equal(t, "60", f.requests[0].URL.Query().Get("visibilitytimeout"))
+}
@@ -0,0 +1,109 @@
+package azure
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+const (
+	// EventTypeBlobCreated Event Grid event sent when a blob is created (or replaced)
+	EventTypeBlobCreated = "Microsoft.Storage.BlobCreated"
+
+	blobSubjectPrefix = "/blobServices/default/containers/"
+)
+
+// QueueMessage Storage Queue message
+type QueueMessage struct {
+	MessageID    string `xml:"MessageId"`
+	PopReceipt   string `xml:"PopReceipt"`
+	DequeueCount int    `xml:"DequeueCount"`
+	MessageText  string `xml:"MessageText"`
+}
+
+// eventGridEvent Event Grid event (Event Grid schema) about a blob
+type eventGridEvent struct {
+	Subject   string    `json:"subject"`
+	EventType string    `json:"eventType"`
+	EventTime time.Time `json:"eventTime"`
+	Data      struct {
+		ContentLength int64  `json:"contentLength"`
+		ETag          string `json:"eTag"`
+	} `json:"data"`
+}
+
+// ExtractNewObjects extracts the blobs created notified by Event Grid events (BlobCreated) present on
+// the message, ignoring other event types. Message text can contain a single event or an array of
+// them, base64 encoded (as Event Grid delivers them) or not. Container is used as bucket and blob
+// name as key
+// Returns the number of objects extracted
+func (m *QueueMessage) ExtractNewObjects(mh func(*aws.S3Object) error) (uint64, error) {
+	events, err := m.events()
+	if err != nil {
+		logp.Warn("Couldn't parse Event Grid events from queue message with ID %s. Ignoring it. Error: %v", m.MessageID, err)
+		return 0, nil
+	}
+	var c uint64
+	for _, e := range events {
+		if e.EventType != EventTypeBlobCreated {
+			logp.Debug("s3logsbeat", "Ignoring event of type %s on queue message with ID %s", e.EventType, m.MessageID)
+			continue
+		}
+		container, blob, ok := parseBlobSubject(e.Subject)
+		if !ok {
+			logp.Warn("Unexpected subject %s on queue message with ID %s", e.Subject, m.MessageID)
+			continue
+		}
+		c++
+		o := aws.NewS3Object(container, blob)
+		o.Size = e.Data.ContentLength
+		o.SizeKnown = true
+		o.ETag = e.Data.ETag
+		o.EventTime = e.EventTime
+		if err := mh(o); err != nil {
+			// Client want to cancel process, passing as an error to parent
+			return 0, err
+		}
+	}
+	return c, nil
+}
+
+// events obtains the Event Grid events present on the message text
+func (m *QueueMessage) events() ([]eventGridEvent, error) {
+	text := []byte(strings.TrimSpace(m.MessageText))
+	if len(text) > 0 && text[0] != '{' && text[0] != '[' {
+		decoded, err := base64.StdEncoding.DecodeString(string(text))
+		if err != nil {
+			return nil, err
+		}
+		text = bytes.TrimSpace(decoded)
+	}
+	if len(text) > 0 && text[0] == '[' {
+		var events []eventGridEvent
+		err := json.Unmarshal(text, &events)
+		return events, err
+	}
+	var e eventGridEvent
+	if err := json.Unmarshal(text, &e); err != nil {
+		return nil, err
+	}
+	return []eventGridEvent{e}, nil
+}
+
+// parseBlobSubject obtains container and blob name from a subject with format
+// /blobServices/default/containers/{container}/blobs/{blob}
+func parseBlobSubject(subject string) (string, string, bool) {
+	if !strings.HasPrefix(subject, blobSubjectPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(subject, blobSubjectPrefix), "/blobs/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
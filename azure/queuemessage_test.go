@@ -0,0 +1,65 @@
+// +build !integration
+
+package azure
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+const blobCreatedEvent = `{
+  "topic": "/subscriptions/id/resourceGroups/logs/providers/Microsoft.Storage/storageAccounts/logs",
+  "subject": "/blobServices/default/containers/insights-logs/blobs/resourceId=/app/y=2019/m=05/PT1H.json",
+  "eventType": "Microsoft.Storage.BlobCreated",
+  "eventTime": "2019-05-20T10:00:00.1234567Z",
+  "id": "831e1650-001e-001b-66ab-eeb76e069631",
+  "data": {
+    "api": "PutBlockList",
+    "contentType": "application/json",
+    "contentLength": 524288,
+    "blobType": "BlockBlob",
+    "eTag": "0x8D4BCC2E4835CD0",
+    "url": "https://logs.blob.core.windows.net/insights-logs/resourceId=/app/y=2019/m=05/PT1H.json"
+  }
+}`
+
+func extractObjects(t *testing.T, text string) []*aws.S3Object {
+	var objects []*aws.S3Object
+	c, err := (&QueueMessage{MessageID: "1", MessageText: text}).ExtractNewObjects(func(o *aws.S3Object) error {
+		objects = append(objects, o)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(objects)), c)
+	return objects
+}
+
+func TestExtractBlobCreated(t *testing.T) {
+	// Event Grid delivers events base64 encoded to Storage Queues
+	for _, text := range []string{
+		base64.StdEncoding.EncodeToString([]byte(blobCreatedEvent)),
+		blobCreatedEvent,
+		"[" + blobCreatedEvent + "]",
+	} {
+		objects := extractObjects(t, text)
+		if assert.Len(t, objects, 1) {
+			o := objects[0]
+			assert.Equal(t, "insights-logs", o.Bucket)
+			assert.Equal(t, "resourceId=/app/y=2019/m=05/PT1H.json", o.Key)
+			assert.Equal(t, int64(524288), o.Size)
+			assert.Equal(t, "0x8D4BCC2E4835CD0", o.ETag)
+			assert.Equal(t, time.Date(2019, 5, 20, 10, 0, 0, 123456700, time.UTC), o.EventTime)
+		}
+	}
+}
+
+func TestExtractIgnoredEvents(t *testing.T) {
+	assert.Empty(t, extractObjects(t, `{"subject":"/blobServices/default/containers/logs/blobs/a.log","eventType":"Microsoft.Storage.BlobDeleted"}`))
+	assert.Empty(t, extractObjects(t, `{"subject":"/blobServices/default/containers/logs","eventType":"Microsoft.Storage.BlobCreated"}`))
+	assert.Empty(t, extractObjects(t, "not an event"))
+	assert.Empty(t, extractObjects(t, ""))
+}
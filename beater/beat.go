@@ -4,5 +4,5 @@ import "flag"
 
 var (
 	once            = flag.Bool("once", false, "Run s3logsbeat only once until all inputs will be read")
-	keepSQSMessages = flag.Bool("keepsqsmessages", false, "Do not delete SQS messages when processed (set for testing)")
+	keepSQSMessages = flag.Bool("keepsqsmessages", false, "Do not delete SQS messages (nor ack Pub/Sub messages) when processed (set for testing)")
 )
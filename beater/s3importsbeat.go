@@ -18,7 +18,6 @@ import (
 type S3importsbeat struct {
 	done   chan struct{}
 	config config.Config
-	client beat.Client
 }
 
 // NewS3importsbeat creates beater
@@ -28,6 +27,10 @@ func NewS3importsbeat(b *beat.Beat, cfg *common.Config) (beat.Beater, error) {
 		return nil, fmt.Errorf("Error reading config file: %v", err)
 	}
 
+	if err := setupIndexTemplates(b, config); err != nil {
+		return nil, err
+	}
+
 	bt := &S3importsbeat{
 		done:   make(chan struct{}),
 		config: config,
@@ -75,21 +78,18 @@ func (bt *S3importsbeat) Run(b *beat.Beat) error {
 		return err
 	}
 
-	bt.client, err = b.Publisher.Connect()
-	if err != nil {
-		return err
-	}
-
 	pipelineChannels := pipeline.NewS3ImportsChannels()
 
 	crawler, err := crawler.New(
 		bt.config.Inputs,
 		b.Info.Version,
+		b.Publisher,
+		bt.config.Formats,
 		bt.done,
 		true,
 		nil,
 		pipelineChannels.GetS3ListChannel(),
-		[]string{"s3"},
+		[]string{"s3", "dead_letter", "file"},
 	)
 	if err != nil {
 		logp.Err("Could not init crawler: %v", err)
@@ -106,7 +106,7 @@ func (bt *S3importsbeat) Run(b *beat.Beat) error {
 	}
 
 	// Start the pipeline workers
-	s3readerWorker := pipeline.NewS3ReaderWorker(pipelineChannels.GetS3Channel(), bt.client, wgEvents, wgS3Objects)
+	s3readerWorker := pipeline.NewS3ReaderWorker(pipelineChannels.GetS3Channel(), wgEvents, wgS3Objects)
 	s3listerWorker := pipeline.NewS3ListerWorker(pipelineChannels.GetS3ListChannel(), pipelineChannels.GetS3Channel(), wgS3Objects)
 	s3readerWorker.Start()
 	s3listerWorker.Start()
@@ -153,7 +153,7 @@ func (bt *S3importsbeat) Run(b *beat.Beat) error {
 	logp.Debug("s3logsbeat", "Waiting for all events to be processed or timeout")
 	waitEvents.Wait()
 
-	bt.client.Close() // unlock publish events (if locked)
+	crawler.CloseClients() // unlock publish events (if locked)
 	s3readerWorker.Stop()
 
 	// Close registrar
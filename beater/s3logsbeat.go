@@ -18,7 +18,6 @@ import (
 type S3logsbeat struct {
 	done   chan struct{}
 	config config.Config
-	client beat.Client
 }
 
 // New creates beater
@@ -28,6 +27,10 @@ func NewS3logsbeat(b *beat.Beat, cfg *common.Config) (beat.Beater, error) {
 		return nil, fmt.Errorf("Error reading config file: %v", err)
 	}
 
+	if err := setupIndexTemplates(b, config); err != nil {
+		return nil, err
+	}
+
 	bt := &S3logsbeat{
 		done:   make(chan struct{}),
 		config: config,
@@ -44,7 +47,7 @@ func (bt *S3logsbeat) Run(b *beat.Beat) error {
 	waitFinished := newSignalWait()
 	waitEvents := newSignalWait()
 
-	// count SQS messages for monitoring purposes
+	// count SQS and Pub/Sub messages for monitoring purposes
 	wgSQSMessages := &eventCounter{
 		count: monitoring.NewInt(nil, "s3logsbeat.sqsMessages.active"),
 		added: monitoring.NewUint(nil, "s3logsbeat.sqsMessages.added"),
@@ -83,21 +86,18 @@ func (bt *S3logsbeat) Run(b *beat.Beat) error {
 		return err
 	}
 
-	bt.client, err = b.Publisher.Connect()
-	if err != nil {
-		return err
-	}
-
 	pipelineChannels := pipeline.NewChannels()
 
 	crawler, err := crawler.New(
 		bt.config.Inputs,
 		b.Info.Version,
+		b.Publisher,
+		bt.config.Formats,
 		bt.done,
 		*once,
-		pipelineChannels.GetSQSChannel(),
+		pipelineChannels.GetQueueChannel(),
 		nil,
-		[]string{"sqs"},
+		[]string{"sqs", "gcs_pubsub", "azure_queue"},
 	)
 	if err != nil {
 		logp.Err("Could not init crawler: %v", err)
@@ -114,18 +114,18 @@ func (bt *S3logsbeat) Run(b *beat.Beat) error {
 	}
 
 	// Start the pipeline workers
-	s3readerWorker := pipeline.NewS3ReaderWorker(pipelineChannels.GetS3Channel(), bt.client, wgEvents, wgS3Objects)
-	sqsConsumerWorker := pipeline.NewSQSConsumerWorker(pipelineChannels.GetSQSChannel(), pipelineChannels.GetS3Channel(), wgSQSMessages, wgS3Objects, *keepSQSMessages)
+	s3readerWorker := pipeline.NewS3ReaderWorker(pipelineChannels.GetS3Channel(), wgEvents, wgS3Objects)
+	queueConsumerWorker := pipeline.NewQueueConsumerWorker(pipelineChannels.GetQueueChannel(), pipelineChannels.GetS3Channel(), wgSQSMessages, wgS3Objects, *keepSQSMessages)
 	s3readerWorker.Start()
-	sqsConsumerWorker.Start()
+	queueConsumerWorker.Start()
 
 	// If run once, add crawler completion check as alternative to done signal
 	if *once {
 		runOnce := func() {
 			logp.Info("Running s3logsbeat once. Waiting for completion ...")
 			crawler.WaitForCompletion()
-			pipelineChannels.CloseSQSChannel()
-			sqsConsumerWorker.Wait()
+			pipelineChannels.CloseQueueChannel()
+			queueConsumerWorker.Wait()
 			pipelineChannels.CloseS3Channel()
 			s3readerWorker.Wait()
 			wgEvents.Wait()
@@ -139,7 +139,7 @@ func (bt *S3logsbeat) Run(b *beat.Beat) error {
 	waitFinished.Wait()
 
 	crawler.Stop()
-	sqsConsumerWorker.StopAcceptingMessages()
+	queueConsumerWorker.StopAcceptingMessages()
 
 	timeout := bt.config.ShutdownTimeout
 	// Checks if on shutdown it should wait for all events to be published
@@ -147,7 +147,7 @@ func (bt *S3logsbeat) Run(b *beat.Beat) error {
 	if waitPublished {
 		// Wait until all will be done + all events published
 		waitEvents.Add(withLog(func() {
-			sqsConsumerWorker.Wait()
+			queueConsumerWorker.Wait()
 			pipelineChannels.CloseS3Channel()
 			s3readerWorker.Wait()
 			wgEvents.Wait()
@@ -167,8 +167,8 @@ func (bt *S3logsbeat) Run(b *beat.Beat) error {
 	logp.Debug("s3logsbeat", "Waiting for all events to be processed or timeout")
 	waitEvents.Wait()
 
-	sqsConsumerWorker.Stop()
-	bt.client.Close() // unlock publish events (if locked)
+	queueConsumerWorker.Stop()
+	crawler.CloseClients() // unlock publish events (if locked)
 	s3readerWorker.Stop()
 
 	// Close registrar
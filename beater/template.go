@@ -0,0 +1,31 @@
+package beater
+
+import (
+	"fmt"
+
+	"github.com/sequra/s3logsbeat/config"
+	"github.com/sequra/s3logsbeat/input"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// SetupIndexTemplates loads the index templates (mapping properties per index) built from inputs.
+// It is set on cmd package, as it depends on Elasticsearch output
+var SetupIndexTemplates func(b *beat.Beat, templates map[string]common.MapStr) error
+
+// setupIndexTemplates loads an index template for each index configured per input or log format
+func setupIndexTemplates(b *beat.Beat, config config.Config) error {
+	if SetupIndexTemplates == nil {
+		return nil
+	}
+
+	templates, err := input.IndexTemplates(config.Inputs, config.Formats)
+	if err != nil {
+		return fmt.Errorf("Error building index templates: %v", err)
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+	return SetupIndexTemplates(b, templates)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/sequra/s3logsbeat/beater"
+	"github.com/sequra/s3logsbeat/indextemplate"
 
 	cmd "github.com/elastic/beats/libbeat/cmd"
 )
@@ -27,6 +28,8 @@ func init() {
 	runFlags.AddGoFlag(flag.CommandLine.Lookup("once"))
 	runFlags.AddGoFlag(flag.CommandLine.Lookup("keepsqsmessages"))
 
+	beater.SetupIndexTemplates = indextemplate.Setup
+
 	RootCmd = &BeatsRootCmd{
 		BeatsRootCmd: cmd.GenRootCmdWithRunFlags(Name, "", beater.NewS3logsbeat, runFlags),
 		S3ExportsCmd: genS3ImportsCmd(Name, "", beater.NewS3importsbeat, nil),
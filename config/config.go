@@ -14,8 +14,15 @@ const (
 )
 
 type Config struct {
-	Inputs          []*common.Config `config:"inputs" validate:"required"`
-	ShutdownTimeout time.Duration    `config:"shutdown_timeout"`
+	Inputs          []*common.Config        `config:"inputs" validate:"required"`
+	ShutdownTimeout time.Duration           `config:"shutdown_timeout"`
+	Formats         map[string]FormatConfig `config:"formats"`
+}
+
+// FormatConfig contains the defaults applied to inputs based on their log format
+type FormatConfig struct {
+	Index    string `config:"index"`
+	Pipeline string `config:"pipeline"`
 }
 
 var DefaultConfig = Config{
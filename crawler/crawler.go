@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"sync"
 
+	cfg "github.com/sequra/s3logsbeat/config"
 	"github.com/sequra/s3logsbeat/input"
 	"github.com/sequra/s3logsbeat/pipeline"
 
+	"github.com/elastic/beats/libbeat/beat"
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/logp"
 
@@ -22,20 +24,24 @@ type Crawler struct {
 	once         bool
 	beatVersion  string
 	beatDone     chan struct{}
-	outSQS       chan *pipeline.SQS
+	publisher    beat.Pipeline
+	formats      map[string]cfg.FormatConfig
+	outQueue     chan pipeline.Queue
 	outS3List    chan *pipeline.S3List
 	allowedTypes []string
 }
 
 // New creates a new crawler
-func New(inputConfigs []*common.Config, beatVersion string, beatDone chan struct{}, once bool, outSQS chan *pipeline.SQS, outS3List chan *pipeline.S3List, allowedTypes []string) (*Crawler, error) {
+func New(inputConfigs []*common.Config, beatVersion string, publisher beat.Pipeline, formats map[string]cfg.FormatConfig, beatDone chan struct{}, once bool, outQueue chan pipeline.Queue, outS3List chan *pipeline.S3List, allowedTypes []string) (*Crawler, error) {
 	return &Crawler{
 		inputs:       map[uint64]*input.Runner{},
 		inputConfigs: inputConfigs,
 		once:         once,
 		beatVersion:  beatVersion,
 		beatDone:     beatDone,
-		outSQS:       outSQS,
+		publisher:    publisher,
+		formats:      formats,
+		outQueue:     outQueue,
 		outS3List:    outS3List,
 		allowedTypes: allowedTypes,
 	}, nil
@@ -64,7 +70,7 @@ func (c *Crawler) startInput(
 		return nil
 	}
 
-	p, err := input.New(config, c.beatDone, c.outSQS, c.outS3List)
+	p, err := input.New(config, c.publisher, c.formats, c.beatDone, c.outQueue, c.outS3List)
 	if err != nil {
 		return fmt.Errorf("Error in initing input: %s", err)
 	}
@@ -73,6 +79,7 @@ func (c *Crawler) startInput(
 		p.Once = c.once
 
 		if _, ok := c.inputs[p.ID]; ok {
+			p.CloseClient()
 			return fmt.Errorf("Input with same ID already exists: %d", p.ID)
 		}
 
@@ -81,6 +88,7 @@ func (c *Crawler) startInput(
 		p.Start()
 	} else {
 		logp.Info("Ignoring not allowed type %s", p.Type())
+		p.CloseClient()
 	}
 
 	return nil
@@ -104,6 +112,14 @@ func (c *Crawler) Stop() {
 	logp.Info("Crawler stopped")
 }
 
+// CloseClients closes the publisher clients of all inputs. It must be called once all events
+// have been published (or shutdown timeout reached) to unlock pending publications
+func (c *Crawler) CloseClients() {
+	for _, i := range c.inputs {
+		i.CloseClient()
+	}
+}
+
 // WaitForCompletion waits untill all inputs will be stopped
 func (c *Crawler) WaitForCompletion() {
 	c.wg.Wait()
@@ -0,0 +1,44 @@
+package deadletter
+
+import (
+	"fmt"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+const (
+	// DefaultMaxRecordsPerFile records written per dead-letter file if not configured
+	DefaultMaxRecordsPerFile = 10000
+	// DefaultMaxRecordsPerObject records written per S3 object if not configured
+	DefaultMaxRecordsPerObject = 100000
+)
+
+// Config dead-letter target configuration. Only one target can be set.
+// Records of an S3 object are written on files of up to MaxRecordsPerFile records, and only the
+// first MaxRecordsPerObject records of each object are written (so a wrong log format on a huge
+// object does not fill the sink)
+type Config struct {
+	Path                string `config:"path"`
+	S3Prefix            string `config:"s3_prefix"`
+	MaxRecordsPerFile   int    `config:"max_records_per_file" validate:"min=0"`
+	MaxRecordsPerObject int    `config:"max_records_per_object" validate:"min=0"`
+}
+
+// Validate validates dead-letter config logic
+func (c *Config) Validate() error {
+	if (c.Path == "") == (c.S3Prefix == "") {
+		return fmt.Errorf("Dead-letter requires either path or s3_prefix (but not both)")
+	}
+	if c.S3Prefix != "" {
+		if _, err := aws.NewS3ObjectFromURI(c.S3Prefix); err != nil {
+			return err
+		}
+	}
+	if c.MaxRecordsPerFile == 0 {
+		c.MaxRecordsPerFile = DefaultMaxRecordsPerFile
+	}
+	if c.MaxRecordsPerObject == 0 {
+		c.MaxRecordsPerObject = DefaultMaxRecordsPerObject
+	}
+	return nil
+}
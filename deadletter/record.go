@@ -0,0 +1,45 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Record types
+const (
+	// RecordTypeLine record containing a line that could not be parsed
+	RecordTypeLine = "line"
+	// RecordTypeObject record referencing an object that could not be read
+	RecordTypeObject = "object"
+)
+
+// Record element written on dead-letter files (one JSON per line)
+type Record struct {
+	Timestamp  time.Time `json:"@timestamp"`
+	Type       string    `json:"type"`
+	Reason     string    `json:"reason"`
+	Bucket     string    `json:"bucket"`
+	Key        string    `json:"key"`
+	ObjectTime time.Time `json:"object_time"`
+	Format     string    `json:"format,omitempty"`
+	Line       uint64    `json:"line,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+// ReadRecords reads records written on a dead-letter file (already decompressed)
+// and executes rh for each one
+func ReadRecords(r io.Reader, rh func(*Record) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		var record Record
+		if err := dec.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := rh(&record); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package deadletter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/sequra/s3logsbeat/aws"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+var (
+	recordsWritten = monitoring.NewUint(nil, "s3logsbeat.deadletter.records")
+	filesWritten   = monitoring.NewUint(nil, "s3logsbeat.deadletter.files")
+	writeErrors    = monitoring.NewUint(nil, "s3logsbeat.deadletter.writeError")
+	recordsDropped = monitoring.NewUint(nil, "s3logsbeat.deadletter.dropped")
+)
+
+type target interface {
+	write(name string, data []byte) error
+	String() string
+}
+
+// Sink writes failed lines and objects to a local directory or an S3 prefix as
+// compressed NDJSON files. Records of each failed S3 object are written on their own
+// files of up to maxRecordsPerFile records
+type Sink struct {
+	target              target
+	maxRecordsPerFile   int
+	maxRecordsPerObject int
+}
+
+// New creates a new dead-letter sink. session is only used when target is an S3 prefix
+func New(config *Config, session *session.Session) (*Sink, error) {
+	s := &Sink{
+		maxRecordsPerFile:   config.MaxRecordsPerFile,
+		maxRecordsPerObject: config.MaxRecordsPerObject,
+	}
+	if s.maxRecordsPerFile == 0 {
+		s.maxRecordsPerFile = DefaultMaxRecordsPerFile
+	}
+	if s.maxRecordsPerObject == 0 {
+		s.maxRecordsPerObject = DefaultMaxRecordsPerObject
+	}
+	if config.Path != "" {
+		s.target = &localTarget{path: config.Path}
+		return s, nil
+	}
+	prefix, err := aws.NewS3ObjectFromURI(config.S3Prefix)
+	if err != nil {
+		return nil, err
+	}
+	s.target = &s3Target{
+		s3:     aws.NewS3(session),
+		prefix: prefix,
+	}
+	return s, nil
+}
+
+// NewBatch creates a batch of records related to the S3 object o. Batch is
+// nil (and ignores all records) when sink is nil
+func (s *Sink) NewBatch(o *aws.S3Object, format string) *Batch {
+	if s == nil {
+		return nil
+	}
+	return &Batch{
+		sink:   s,
+		object: o,
+		format: format,
+	}
+}
+
+// Batch records related to the same S3 object. Records are compressed as they are added and
+// written once maxRecordsPerFile are pending or on Flush, so memory used is bounded
+type Batch struct {
+	sink    *Sink
+	object  *aws.S3Object
+	format  string
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	enc     *json.Encoder
+	pending int
+	added   int
+	dropped int
+}
+
+// AddLine adds a line that could not be parsed
+func (b *Batch) AddLine(line string, number uint64, reason error) {
+	if b == nil {
+		return
+	}
+	r := b.newRecord(RecordTypeLine, reason)
+	r.Line = number
+	r.Message = strings.TrimRight(line, "\r\n")
+	b.add(r)
+}
+
+// AddObject adds the S3 object as it could not be read
+func (b *Batch) AddObject(reason error) {
+	if b == nil {
+		return
+	}
+	b.add(b.newRecord(RecordTypeObject, reason))
+}
+
+func (b *Batch) newRecord(recordType string, reason error) *Record {
+	return &Record{
+		Timestamp:  time.Now().UTC(),
+		Type:       recordType,
+		Reason:     reason.Error(),
+		Bucket:     b.object.Bucket,
+		Key:        b.object.Key,
+		ObjectTime: b.object.Time(),
+		Format:     b.format,
+	}
+}
+
+// add compresses r, writing pending records once maxRecordsPerFile are reached. Records beyond
+// maxRecordsPerObject are dropped
+func (b *Batch) add(r *Record) {
+	if b.added >= b.sink.maxRecordsPerObject {
+		b.dropped++
+		recordsDropped.Inc()
+		return
+	}
+	if b.gz == nil {
+		b.gz = gzip.NewWriter(&b.buf)
+		b.enc = json.NewEncoder(b.gz)
+	}
+	if err := b.enc.Encode(r); err != nil {
+		logp.Err("Could not encode dead-letter record of %s. Error: %v", b.object.String(), err)
+		return
+	}
+	b.added++
+	b.pending++
+	if b.pending >= b.sink.maxRecordsPerFile {
+		if err := b.write(); err != nil {
+			logp.Err("%v", err)
+		}
+	}
+}
+
+// Flush writes all records pending (if any) to the sink
+func (b *Batch) Flush() error {
+	if b == nil {
+		return nil
+	}
+	if b.dropped > 0 {
+		logp.Warn("Dropped %d dead-letter records of %s as it exceeded %d records", b.dropped, b.object.String(), b.sink.maxRecordsPerObject)
+		b.dropped = 0
+	}
+	return b.write()
+}
+
+// write writes pending records on a new file of the sink
+func (b *Batch) write() error {
+	if b.pending == 0 {
+		return nil
+	}
+	records := b.pending
+	b.pending = 0
+	defer func() {
+		b.buf.Reset()
+		b.gz = nil
+	}()
+	if err := b.gz.Close(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s/%s.%d.ndjson.gz", b.object.Bucket, b.object.Key, time.Now().UnixNano())
+	if err := b.sink.target.write(name, b.buf.Bytes()); err != nil {
+		writeErrors.Inc()
+		return fmt.Errorf("Could not write dead-letter file %s on %s. Error: %v", name, b.sink.target.String(), err)
+	}
+	logp.Debug("s3logsbeat", "Written %d records on dead-letter file %s on %s", records, name, b.sink.target.String())
+	filesWritten.Inc()
+	recordsWritten.Add(uint64(records))
+	return nil
+}
+
+type localTarget struct {
+	path string
+}
+
+func (t *localTarget) write(name string, data []byte) error {
+	base := filepath.Clean(t.path)
+	p := filepath.Join(base, filepath.FromSlash(name))
+	if !strings.HasPrefix(p, base+string(filepath.Separator)) {
+		return fmt.Errorf("Name %s is outside dead-letter path", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first to avoid reading incomplete files on replay
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (t *localTarget) String() string {
+	return t.path
+}
+
+type s3Target struct {
+	s3     *aws.S3
+	prefix *aws.S3Object
+}
+
+func (t *s3Target) write(name string, data []byte) error {
+	o := aws.NewS3Object(t.prefix.Bucket, path.Join(t.prefix.Key, name))
+	return t.s3.PutObject(o, bytes.NewReader(data))
+}
+
+func (t *s3Target) String() string {
+	return fmt.Sprintf("s3://%s/%s", t.prefix.Bucket, t.prefix.Key)
+}
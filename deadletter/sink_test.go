@@ -0,0 +1,113 @@
+// +build !integration
+
+package deadletter
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func TestSinkLocalWriteAndRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink, err := New(&Config{Path: dir}, nil)
+	assert.NoError(t, err)
+
+	b := sink.NewBatch(aws.NewS3Object("mybucket", "path/to/object.log.gz"), "alb")
+	b.AddLine("invalid line\n", 3, fmt.Errorf("Line does not match expected format"))
+	b.AddObject(fmt.Errorf("unexpected EOF"))
+	assert.NoError(t, b.Flush())
+
+	files, err := filepath.Glob(filepath.Join(dir, "mybucket", "path", "to", "object.log.gz.*.ndjson.gz"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	f, err := os.Open(files[0])
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+
+	var records []*Record
+	err = ReadRecords(gz, func(r *Record) error {
+		records = append(records, r)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, RecordTypeLine, records[0].Type)
+	assert.Equal(t, "invalid line", records[0].Message)
+	assert.Equal(t, uint64(3), records[0].Line)
+	assert.Equal(t, "alb", records[0].Format)
+	assert.Equal(t, "mybucket", records[0].Bucket)
+	assert.Equal(t, "path/to/object.log.gz", records[0].Key)
+	assert.Equal(t, RecordTypeObject, records[1].Type)
+	assert.Equal(t, "unexpected EOF", records[1].Reason)
+}
+
+func TestSinkNilIgnoresRecords(t *testing.T) {
+	var sink *Sink
+	b := sink.NewBatch(aws.NewS3Object("mybucket", "mykey"), "alb")
+	b.AddLine("line", 1, fmt.Errorf("error"))
+	assert.NoError(t, b.Flush())
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.Error(t, (&Config{}).Validate())
+	assert.Error(t, (&Config{Path: "/tmp", S3Prefix: "s3://mybucket/prefix"}).Validate())
+	assert.Error(t, (&Config{S3Prefix: "s3://"}).Validate())
+	assert.NoError(t, (&Config{S3Prefix: "s3://mybucket/prefix"}).Validate())
+
+	c := &Config{Path: "/tmp"}
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, DefaultMaxRecordsPerFile, c.MaxRecordsPerFile)
+	assert.Equal(t, DefaultMaxRecordsPerObject, c.MaxRecordsPerObject)
+}
+
+func TestSinkLocalWritesBoundedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink, err := New(&Config{Path: dir, MaxRecordsPerFile: 3, MaxRecordsPerObject: 7}, nil)
+	assert.NoError(t, err)
+
+	dropped := recordsDropped.Get()
+	b := sink.NewBatch(aws.NewS3Object("mybucket", "object.log"), "alb")
+	for i := 1; i <= 10; i++ {
+		b.AddLine("invalid line", uint64(i), fmt.Errorf("Line does not match expected format"))
+	}
+	assert.NoError(t, b.Flush())
+	assert.NoError(t, b.Flush())
+	assert.Equal(t, dropped+3, recordsDropped.Get())
+
+	files, err := filepath.Glob(filepath.Join(dir, "mybucket", "object.log.*.ndjson.gz"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	var lines []uint64
+	for _, file := range files {
+		f, err := os.Open(file)
+		assert.NoError(t, err)
+		gz, err := gzip.NewReader(f)
+		assert.NoError(t, err)
+		assert.NoError(t, ReadRecords(gz, func(r *Record) error {
+			lines = append(lines, r.Line)
+			return nil
+		}))
+		f.Close()
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i] < lines[j] })
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7}, lines)
+}
@@ -0,0 +1,106 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	defaultPubSubEndpoint  = "https://pubsub.googleapis.com"
+	defaultStorageEndpoint = "https://storage.googleapis.com"
+
+	// Environment variables set to use the Pub/Sub emulator and fake-gcs-server (host:port)
+	pubSubEmulatorHostEnv  = "PUBSUB_EMULATOR_HOST"
+	storageEmulatorHostEnv = "STORAGE_EMULATOR_HOST"
+
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// Config configures the access to Google Cloud. Credentials are obtained from credentials_file
+// (service account key) or from Application Default Credentials. Requests to emulators are not
+// authenticated
+type Config struct {
+	CredentialsFile       string `config:"credentials_file"`
+	PubSubEndpoint        string `config:"pubsub_endpoint"`
+	StorageEndpoint       string `config:"storage_endpoint"`
+	WithoutAuthentication bool   `config:"without_authentication"`
+}
+
+// Clients HTTP clients and endpoints used to access Google Cloud services
+type Clients struct {
+	PubSubEndpoint  string
+	PubSubClient    *http.Client
+	StorageEndpoint string
+	StorageClient   *http.Client
+}
+
+// NewClients creates the clients used to access Pub/Sub and Cloud Storage from config. Emulators
+// set on environment (PUBSUB_EMULATOR_HOST and STORAGE_EMULATOR_HOST) take precedence
+func NewClients(c *Config) (*Clients, error) {
+	pubSubEndpoint, pubSubEmulator := endpoint(c.PubSubEndpoint, defaultPubSubEndpoint, pubSubEmulatorHostEnv)
+	storageEndpoint, storageEmulator := endpoint(c.StorageEndpoint, defaultStorageEndpoint, storageEmulatorHostEnv)
+
+	var authenticated *http.Client
+	if !c.WithoutAuthentication && (!pubSubEmulator || !storageEmulator) {
+		var err error
+		if authenticated, err = c.authenticatedClient(); err != nil {
+			return nil, err
+		}
+	}
+	clientFor := func(emulator bool) *http.Client {
+		if emulator || authenticated == nil {
+			return http.DefaultClient
+		}
+		return authenticated
+	}
+	return &Clients{
+		PubSubEndpoint:  pubSubEndpoint,
+		PubSubClient:    clientFor(pubSubEmulator),
+		StorageEndpoint: storageEndpoint,
+		StorageClient:   clientFor(storageEmulator),
+	}, nil
+}
+
+// authenticatedClient creates an HTTP client which authenticates requests with OAuth2 tokens
+// obtained from credentials (refreshed when they expire)
+func (c *Config) authenticatedClient() (*http.Client, error) {
+	ctx := context.Background()
+	if c.CredentialsFile == "" {
+		client, err := google.DefaultClient(ctx, cloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("Could not find Google Cloud default credentials: %v", err)
+		}
+		return client, nil
+	}
+	content, err := ioutil.ReadFile(c.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read Google Cloud credentials file %s: %v", c.CredentialsFile, err)
+	}
+	creds, err := google.CredentialsFromJSON(ctx, content, cloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse Google Cloud credentials file %s: %v", c.CredentialsFile, err)
+	}
+	return oauth2.NewClient(ctx, creds.TokenSource), nil
+}
+
+// endpoint obtains the endpoint of a service (without trailing slash) and whether it is an
+// emulator set on environment variable emulatorEnv
+func endpoint(configured, defaultEndpoint, emulatorEnv string) (string, bool) {
+	if host := os.Getenv(emulatorEnv); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		return strings.TrimSuffix(host, "/"), true
+	}
+	if configured != "" {
+		return strings.TrimSuffix(configured, "/"), false
+	}
+	return defaultEndpoint, false
+}
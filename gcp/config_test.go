@@ -0,0 +1,39 @@
+// +build !integration
+
+package gcp
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientsWithEmulators(t *testing.T) {
+	os.Setenv(pubSubEmulatorHostEnv, "localhost:8085")
+	os.Setenv(storageEmulatorHostEnv, "http://localhost:4443/")
+	defer os.Unsetenv(pubSubEmulatorHostEnv)
+	defer os.Unsetenv(storageEmulatorHostEnv)
+
+	// Emulators take precedence and their requests are not authenticated
+	c, err := NewClients(&Config{PubSubEndpoint: "https://pubsub.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8085", c.PubSubEndpoint)
+	assert.Equal(t, "http://localhost:4443", c.StorageEndpoint)
+	assert.Equal(t, http.DefaultClient, c.PubSubClient)
+	assert.Equal(t, http.DefaultClient, c.StorageClient)
+}
+
+func TestNewClientsWithoutAuthentication(t *testing.T) {
+	c, err := NewClients(&Config{StorageEndpoint: "https://storage.example.com/", WithoutAuthentication: true})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultPubSubEndpoint, c.PubSubEndpoint)
+	assert.Equal(t, "https://storage.example.com", c.StorageEndpoint)
+	assert.Equal(t, http.DefaultClient, c.StorageClient)
+}
+
+func TestNewClientsWithInvalidCredentialsFile(t *testing.T) {
+	_, err := NewClients(&Config{CredentialsFile: "/nonexistent/credentials.json"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	pubSubMaxMessages = 10
+)
+
+var (
+	subscriptionRE = regexp.MustCompile(`^projects/[^/]+/subscriptions/[^/]+$`)
+)
+
+// PubSub handles simple Pub/Sub subscription functions used by a consumer (REST API)
+type PubSub struct {
+	client       *http.Client
+	endpoint     string
+	subscription string
+	ackDeadline  time.Duration
+}
+
+type pubSubMessageHandler func(*PubSubMessage) error
+
+type pullRequest struct {
+	MaxMessages int `json:"maxMessages"`
+}
+
+type pullResponse struct {
+	ReceivedMessages []struct {
+		AckID   string        `json:"ackId"`
+		Message PubSubMessage `json:"message"`
+	} `json:"receivedMessages"`
+}
+
+type acknowledgeRequest struct {
+	AckIDs []string `json:"ackIds"`
+}
+
+type modifyAckDeadlineRequest struct {
+	AckIDs             []string `json:"ackIds"`
+	AckDeadlineSeconds int      `json:"ackDeadlineSeconds"`
+}
+
+// ValidateSubscription validates that subscription has format projects/{project}/subscriptions/{name}
+func ValidateSubscription(subscription string) error {
+	if !subscriptionRE.MatchString(subscription) {
+		return fmt.Errorf("Incorrect Pub/Sub subscription %s (expected projects/{project}/subscriptions/{name})", subscription)
+	}
+	return nil
+}
+
+// NewPubSub is a construct function for creating the object with the clients and the
+// subscription (projects/{project}/subscriptions/{name}) as arguments. Ack deadline of messages
+// received is extended to ackDeadline (see ModifyAckDeadline)
+func NewPubSub(clients *Clients, subscription string, ackDeadline time.Duration) *PubSub {
+	return &PubSub{
+		client:       clients.PubSubClient,
+		endpoint:     clients.PubSubEndpoint,
+		subscription: subscription,
+		ackDeadline:  ackDeadline,
+	}
+}
+
+// ReceiveMessages pulls messages from subscription and executes message handler for each message
+// Returns an integer with the number of messages received, a boolean indicating that more possible
+// available messages are present on the subscription, and the error (if any)
+func (p *PubSub) ReceiveMessages(mh pubSubMessageHandler) (int, bool, error) {
+	var resp pullResponse
+	if err := p.post("pull", &pullRequest{MaxMessages: pubSubMaxMessages}, &resp); err != nil {
+		return 0, false, err
+	}
+	for _, r := range resp.ReceivedMessages {
+		m := r.Message
+		m.AckID = r.AckID
+		if err := mh(&m); err != nil {
+			return 0, false, err
+		}
+	}
+	return len(resp.ReceivedMessages), len(resp.ReceivedMessages) == pubSubMaxMessages, nil
+}
+
+// Acknowledge acknowledges a message, so it is not delivered again
+func (p *PubSub) Acknowledge(ackID string) error {
+	return p.post("acknowledge", &acknowledgeRequest{AckIDs: []string{ackID}}, nil)
+}
+
+// ModifyAckDeadline keeps a message from being delivered again during ack deadline from now
+func (p *PubSub) ModifyAckDeadline(ackID string) error {
+	return p.post("modifyAckDeadline", &modifyAckDeadlineRequest{
+		AckIDs:             []string{ackID},
+		AckDeadlineSeconds: int(p.ackDeadline / time.Second),
+	}, nil)
+}
+
+// AckDeadline obtains the time messages received are not delivered again once their deadline is modified
+func (p *PubSub) AckDeadline() time.Duration {
+	return p.ackDeadline
+}
+
+func (p *PubSub) String() string {
+	return p.subscription
+}
+
+// post executes method of subscription sending in and decoding response into out (if not nil)
+func (p *PubSub) post(method string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s:%s", p.endpoint, p.subscription, method)
+	resp, err := p.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkResponse returns an error with the status and body of resp if it is not successful
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	return &Error{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+}
+
+// Error error returned by Google Cloud APIs
+type Error struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Google Cloud API error (status %d): %s", e.StatusCode, e.Body)
+}
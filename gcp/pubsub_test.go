@@ -0,0 +1,129 @@
+// +build !integration
+
+package gcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePubSubServer serves pull and acknowledge requests of a subscription as the Pub/Sub emulator does
+type fakePubSubServer struct {
+	mutex     sync.Mutex
+	messages  []map[string]interface{}
+	acked     []string
+	deadlines []int
+}
+
+func (f *fakePubSubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.URL.Path {
+	case "/v1/projects/myproject/subscriptions/logs:pull":
+		var req pullRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received := []map[string]interface{}{}
+		for len(f.messages) > 0 && len(received) < req.MaxMessages {
+			received = append(received, f.messages[0])
+			f.messages = f.messages[1:]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"receivedMessages": received})
+	case "/v1/projects/myproject/subscriptions/logs:acknowledge":
+		var req acknowledgeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.acked = append(f.acked, req.AckIDs...)
+		w.Write([]byte("{}"))
+	case "/v1/projects/myproject/subscriptions/logs:modifyAckDeadline":
+		var req modifyAckDeadlineRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.deadlines = append(f.deadlines, req.AckDeadlineSeconds)
+		w.Write([]byte("{}"))
+	default:
+		http.Error(w, `{"error":{"code":404,"message":"Subscription does not exist"}}`, http.StatusNotFound)
+	}
+}
+
+func (f *fakePubSubServer) add(ackID string, attributes map[string]string, data string) {
+	f.messages = append(f.messages, map[string]interface{}{
+		"ackId": ackID,
+		"message": map[string]interface{}{
+			"messageId":   "id-" + ackID,
+			"data":        base64.StdEncoding.EncodeToString([]byte(data)),
+			"attributes":  attributes,
+			"publishTime": "2019-05-20T10:00:00.123Z",
+		},
+	})
+}
+
+func newFinalizeAttributes(bucket, name string) map[string]string {
+	return map[string]string{
+		"eventType":     EventTypeObjectFinalize,
+		"bucketId":      bucket,
+		"objectId":      name,
+		"payloadFormat": payloadFormatJSON,
+		"eventTime":     "2019-05-20T10:00:00.000Z",
+	}
+}
+
+func TestValidateSubscription(t *testing.T) {
+	assert.NoError(t, ValidateSubscription("projects/myproject/subscriptions/logs"))
+	assert.Error(t, ValidateSubscription("logs"))
+	assert.Error(t, ValidateSubscription("projects/myproject/topics/logs"))
+}
+
+func TestPubSubReceiveAndAcknowledge(t *testing.T) {
+	f := &fakePubSubServer{}
+	for _, id := range []string{"a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8", "a9", "a10", "a11"} {
+		f.add(id, newFinalizeAttributes("mybucket", "logs/"+id+".log"), `{"name":"logs/`+id+`.log","size":"10"}`)
+	}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	p := NewPubSub(&Clients{PubSubEndpoint: server.URL, PubSubClient: server.Client()}, "projects/myproject/subscriptions/logs", time.Minute)
+	var keys []string
+	n, more, err := p.ReceiveMessages(func(m *PubSubMessage) error {
+		_, err := m.ExtractNewObjects(func(o *aws.S3Object) error {
+			keys = append(keys, o.Key)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, p.ModifyAckDeadline(m.AckID))
+		return p.Acknowledge(m.AckID)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.True(t, more)
+	assert.Len(t, keys, 10)
+	assert.Equal(t, "logs/a1.log", keys[0])
+
+	n, more, err = p.ReceiveMessages(func(m *PubSubMessage) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, more)
+	assert.Len(t, f.acked, 10)
+	assert.Equal(t, "a1", f.acked[0])
+	assert.Len(t, f.deadlines, 10)
+	assert.Equal(t, 60, f.deadlines[0])
+}
+
+func TestPubSubError(t *testing.T) {
+	server := httptest.NewServer(&fakePubSubServer{})
+	defer server.Close()
+
+	p := NewPubSub(&Clients{PubSubEndpoint: server.URL, PubSubClient: server.Client()}, "projects/myproject/subscriptions/unknown", time.Minute)
+	_, more, err := p.ReceiveMessages(func(m *PubSubMessage) error { return nil })
+	assert.False(t, more)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusNotFound, err.(*Error).StatusCode)
+		assert.True(t, strings.Contains(err.Error(), "Subscription does not exist"))
+	}
+}
@@ -0,0 +1,77 @@
+package gcp
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+const (
+	// EventTypeObjectFinalize notification sent when an object is created (or overwritten)
+	EventTypeObjectFinalize = "OBJECT_FINALIZE"
+
+	payloadFormatJSON = "JSON_API_V1"
+)
+
+// PubSubMessage Pub/Sub message. Data is base64 decoded when unmarshalling from JSON
+type PubSubMessage struct {
+	AckID       string            `json:"-"`
+	MessageID   string            `json:"messageId"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	PublishTime time.Time         `json:"publishTime"`
+}
+
+// gcsObject object resource sent as payload of Cloud Storage notifications with format JSON_API_V1
+type gcsObject struct {
+	Bucket       string    `json:"bucket"`
+	Name         string    `json:"name"`
+	Size         string    `json:"size"`
+	ETag         string    `json:"etag"`
+	Updated      time.Time `json:"updated"`
+	StorageClass string    `json:"storageClass"`
+}
+
+// ExtractNewObjects extracts the object created notified by a Cloud Storage notification
+// (OBJECT_FINALIZE), ignoring other event types. Bucket and object name are obtained from
+// attributes and the rest of information from payload (if present)
+// Returns the number of objects extracted
+func (m *PubSubMessage) ExtractNewObjects(mh func(*aws.S3Object) error) (uint64, error) {
+	if m.Attributes["eventType"] != EventTypeObjectFinalize {
+		logp.Debug("s3logsbeat", "Ignoring Pub/Sub message with ID %s and event type %q", m.MessageID, m.Attributes["eventType"])
+		return 0, nil
+	}
+	bucket, name := m.Attributes["bucketId"], m.Attributes["objectId"]
+	if bucket == "" || name == "" {
+		logp.Warn("Pub/Sub message with ID %s has no bucketId or objectId attributes. Ignoring it", m.MessageID)
+		return 0, nil
+	}
+
+	o := aws.NewS3Object(bucket, name)
+	if t, err := time.Parse(time.RFC3339Nano, m.Attributes["eventTime"]); err == nil {
+		o.EventTime = t
+	} else {
+		o.EventTime = m.PublishTime
+	}
+	if m.Attributes["payloadFormat"] == payloadFormatJSON && len(m.Data) > 0 {
+		var g gcsObject
+		if err := json.Unmarshal(m.Data, &g); err != nil {
+			logp.Warn("Couldn't parse object resource from Pub/Sub message with ID %s. Error: %v", m.MessageID, err)
+		} else {
+			if size, err := strconv.ParseInt(g.Size, 10, 64); err == nil {
+				o.Size, o.SizeKnown = size, true
+			}
+			o.ETag = g.ETag
+			o.LastModified = g.Updated
+			o.StorageClass = g.StorageClass
+		}
+	}
+	if err := mh(o); err != nil {
+		// Client want to cancel process, passing as an error to parent
+		return 0, err
+	}
+	return 1, nil
+}
@@ -0,0 +1,75 @@
+// +build !integration
+
+package gcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func extractObjects(t *testing.T, m *PubSubMessage) []*aws.S3Object {
+	var objects []*aws.S3Object
+	c, err := m.ExtractNewObjects(func(o *aws.S3Object) error {
+		objects = append(objects, o)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(objects)), c)
+	return objects
+}
+
+func TestExtractObjectFinalize(t *testing.T) {
+	m := &PubSubMessage{
+		MessageID:  "1",
+		Attributes: newFinalizeAttributes("mybucket", "logs/2019/05/20/lb.log.gz"),
+		Data:       []byte(`{"kind":"storage#object","name":"logs/2019/05/20/lb.log.gz","bucket":"mybucket","size":"12345","etag":"CJOn","updated":"2019-05-20T09:59:59.500Z","storageClass":"STANDARD"}`),
+	}
+	objects := extractObjects(t, m)
+	if assert.Len(t, objects, 1) {
+		o := objects[0]
+		assert.Equal(t, "mybucket", o.Bucket)
+		assert.Equal(t, "logs/2019/05/20/lb.log.gz", o.Key)
+		assert.Equal(t, int64(12345), o.Size)
+		assert.True(t, o.SizeKnown)
+		assert.Equal(t, "CJOn", o.ETag)
+		assert.Equal(t, time.Date(2019, 5, 20, 9, 59, 59, 500000000, time.UTC), o.LastModified)
+		assert.Equal(t, time.Date(2019, 5, 20, 10, 0, 0, 0, time.UTC), o.EventTime)
+		// Event name is only set on S3 events, so event_names filter does not apply
+		assert.Empty(t, o.EventName)
+	}
+}
+
+func TestExtractObjectFinalizeWithoutPayload(t *testing.T) {
+	publishTime := time.Date(2019, 5, 20, 10, 0, 1, 0, time.UTC)
+	m := &PubSubMessage{
+		MessageID: "1",
+		Attributes: map[string]string{
+			"eventType":     EventTypeObjectFinalize,
+			"bucketId":      "mybucket",
+			"objectId":      "logs/audit log.json",
+			"payloadFormat": "NONE",
+		},
+		PublishTime: publishTime,
+	}
+	objects := extractObjects(t, m)
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "logs/audit log.json", objects[0].Key)
+		assert.Equal(t, int64(0), objects[0].Size)
+		assert.False(t, objects[0].SizeKnown)
+		assert.Equal(t, publishTime, objects[0].EventTime)
+	}
+}
+
+func TestExtractIgnoredEvents(t *testing.T) {
+	for _, attributes := range []map[string]string{
+		{"eventType": "OBJECT_DELETE", "bucketId": "mybucket", "objectId": "key"},
+		{"eventType": "OBJECT_METADATA_UPDATE", "bucketId": "mybucket", "objectId": "key"},
+		{"eventType": EventTypeObjectFinalize, "bucketId": "mybucket"},
+		{},
+	} {
+		assert.Empty(t, extractObjects(t, &PubSubMessage{MessageID: "1", Attributes: attributes}), attributes)
+	}
+}
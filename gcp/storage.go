@@ -0,0 +1,96 @@
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+// GCS handle simple Cloud Storage methods (JSON API). Objects are represented as S3 objects,
+// so GCS can be used as the storage of any input
+type GCS struct {
+	client   *http.Client
+	endpoint string
+}
+
+type listResponse struct {
+	Items         []gcsObject `json:"items"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+// NewGCS is a construct function for creating the object with the clients as argument
+func NewGCS(clients *Clients) *GCS {
+	return &GCS{
+		client:   clients.StorageClient,
+		endpoint: clients.StorageEndpoint,
+	}
+}
+
+// GetReadCloser returns a io.ReadCloser to be readed (and then closed) by another method.
+// Content is decompressed if needed
+func (g *GCS) GetReadCloser(o *aws.S3Object) (io.ReadCloser, error) {
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", g.endpoint, url.PathEscape(o.Bucket), url.PathEscape(o.Key))
+	resp, err := g.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return aws.NewS3ReadCloser(resp.Body, resp.Header.Get("Content-Encoding"))
+}
+
+// ListObjects lists objects present on o.Bucket and prefix o.Key
+func (g *GCS) ListObjects(o *aws.S3Object, oh aws.S3ObjectHandler) (int, error) {
+	received := 0
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {o.Key}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		u := fmt.Sprintf("%s/storage/v1/b/%s/o?%s", g.endpoint, url.PathEscape(o.Bucket), query.Encode())
+		var page listResponse
+		if err := g.getJSON(u, &page); err != nil {
+			return received, err
+		}
+		received += len(page.Items)
+		for _, i := range page.Items {
+			size, _ := strconv.ParseInt(i.Size, 10, 64)
+			err := oh(aws.NewS3ObjectWithOriginal(o.Bucket, &s3.Object{
+				Key:          awssdk.String(i.Name),
+				Size:         awssdk.Int64(size),
+				ETag:         awssdk.String(i.ETag),
+				LastModified: awssdk.Time(i.Updated),
+			}))
+			if err != nil {
+				return received, nil
+			}
+		}
+		if page.NextPageToken == "" {
+			return received, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// getJSON obtains u decoding its response into out
+func (g *GCS) getJSON(u string, out interface{}) error {
+	resp, err := g.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
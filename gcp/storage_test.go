@@ -0,0 +1,106 @@
+// +build !integration
+
+package gcp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGCSServer serves objects of bucket mybucket as fake-gcs-server does (two objects per page)
+type fakeGCSServer struct {
+	objects map[string][]byte
+	names   []string
+}
+
+func (f *fakeGCSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/storage/v1/b/mybucket/o"
+	switch {
+	case r.URL.Path == prefix:
+		items := []map[string]string{}
+		start := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			start = len(token)
+		}
+		next := ""
+		for i := start; i < len(f.names); i++ {
+			if !strings.HasPrefix(f.names[i], r.URL.Query().Get("prefix")) {
+				continue
+			}
+			if len(items) == 2 {
+				next = strings.Repeat("x", i)
+				break
+			}
+			items = append(items, map[string]string{"name": f.names[i], "size": "3", "updated": "2019-05-20T10:00:00Z"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "nextPageToken": next})
+	case strings.HasPrefix(r.URL.Path, prefix+"/") && r.URL.Query().Get("alt") == "media":
+		content, ok := f.objects[strings.TrimPrefix(r.URL.Path, prefix+"/")]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"No such object"}}`, http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func newFakeGCS(t *testing.T) (*GCS, func()) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte("line 1\nline 2\n"))
+	w.Close()
+
+	f := &fakeGCSServer{
+		objects: map[string][]byte{
+			"logs/a.log":        []byte("line 1\nline 2\n"),
+			"logs/dir/b.log.gz": compressed.Bytes(),
+		},
+		names: []string{"logs/a.log", "logs/dir/b.log.gz", "logs/dir/c.log", "other/d.log"},
+	}
+	server := httptest.NewServer(f)
+	return NewGCS(&Clients{StorageEndpoint: server.URL, StorageClient: server.Client()}), server.Close
+}
+
+func TestGCSGetReadCloser(t *testing.T) {
+	g, close := newFakeGCS(t)
+	defer close()
+
+	for _, key := range []string{"logs/a.log", "logs/dir/b.log.gz"} {
+		rc, err := g.GetReadCloser(aws.NewS3Object("mybucket", key))
+		if assert.NoError(t, err, key) {
+			content, err := ioutil.ReadAll(rc)
+			rc.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, "line 1\nline 2\n", string(content), key)
+		}
+	}
+
+	_, err := g.GetReadCloser(aws.NewS3Object("mybucket", "logs/unknown.log"))
+	assert.Error(t, err)
+}
+
+func TestGCSListObjects(t *testing.T) {
+	g, close := newFakeGCS(t)
+	defer close()
+
+	var keys []string
+	n, err := g.ListObjects(aws.NewS3Object("mybucket", "logs/"), func(o *aws.S3ObjectWithOriginal) error {
+		keys = append(keys, o.S3Object.Key)
+		assert.Equal(t, int64(3), o.S3Object.Size)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"logs/a.log", "logs/dir/b.log.gz", "logs/dir/c.log"}, keys)
+}
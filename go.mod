@@ -2,11 +2,16 @@ module github.com/sequra/s3logsbeat
 
 require (
 	github.com/aws/aws-sdk-go v1.19.28
+	github.com/dustin/go-humanize v1.0.0 // indirect
 	github.com/elastic/beats v7.0.1+incompatible
 	github.com/elastic/go-ucfg v0.7.0 // indirect
 	github.com/gofrs/uuid v3.2.0+incompatible // indirect
+	github.com/golang/snappy v0.0.4
 	github.com/joeshaw/multierror v0.0.0-20140124173710-69b34d4ec901 // indirect
+	github.com/klauspost/compress v1.15.14
+	github.com/klauspost/pgzip v1.2.6
 	github.com/mitchellh/hashstructure v1.0.0
+	github.com/pierrec/lz4/v4 v4.1.17
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/stretchr/testify v1.3.0
@@ -15,6 +20,7 @@ require (
 	go.uber.org/zap v1.10.0 // indirect
 	golang.org/x/crypto v0.0.0-20190510104115-cbcb75029529 // indirect
 	golang.org/x/net v0.0.0-20190509222800-a4d6f7feada5 // indirect
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 	golang.org/x/sys v0.0.0-20190509141414-a5b02f93d862 // indirect
 	golang.org/x/text v0.3.2 // indirect
 	golang.org/x/tools v0.0.0-20190511041617-99f201b6807e // indirect
@@ -8,6 +8,10 @@ package include
 
 import (
 	// This list is automatically generated by `make imports`
+	_ "github.com/sequra/s3logsbeat/input/azurequeue"
+	_ "github.com/sequra/s3logsbeat/input/deadletter"
+	_ "github.com/sequra/s3logsbeat/input/file"
+	_ "github.com/sequra/s3logsbeat/input/gcspubsub"
 	_ "github.com/sequra/s3logsbeat/input/s3"
 	_ "github.com/sequra/s3logsbeat/input/sqs"
 )
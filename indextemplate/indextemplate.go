@@ -0,0 +1,62 @@
+// Package indextemplate loads index templates per log format on Elasticsearch
+package indextemplate
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs/elasticsearch"
+)
+
+// order of index templates per log format. It is higher than the one of the beat template
+// in order to override its mappings
+const order = 2
+
+// Setup loads templates (mapping properties per index) when Elasticsearch output is used. On
+// setup command templates are loaded directly; otherwise they are loaded each time the output
+// connects to Elasticsearch
+func Setup(b *beat.Beat, templates map[string]common.MapStr) error {
+	if b.Config == nil || b.Config.Output.Name() != "elasticsearch" {
+		return nil
+	}
+
+	if b.InSetupCmd {
+		client, err := elasticsearch.NewConnectedClient(b.Config.Output.Config())
+		if err != nil {
+			return err
+		}
+		return load(client, templates)
+	}
+
+	_, err := elasticsearch.RegisterConnectCallback(func(client *elasticsearch.Client) error {
+		return load(client, templates)
+	})
+	return err
+}
+
+// load loads templates on Elasticsearch. Each template applies to the daily indices created
+// from its index
+func load(client *elasticsearch.Client, templates map[string]common.MapStr) error {
+	for index, properties := range templates {
+		mappings := common.MapStr{
+			"properties": properties,
+		}
+		if client.GetVersion().Major < 7 {
+			mappings = common.MapStr{
+				"doc": mappings,
+			}
+		}
+		body := map[string]interface{}{
+			"index_patterns": []string{index + "-*"},
+			"order":          order,
+			"mappings":       mappings,
+		}
+		if _, err := client.LoadJSON("_template/"+index, body); err != nil {
+			return fmt.Errorf("Error loading index template %s: %v", index, err)
+		}
+		logp.Info("Index template %s loaded", index)
+	}
+	return nil
+}
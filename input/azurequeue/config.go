@@ -0,0 +1,33 @@
+package azurequeue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sequra/s3logsbeat/azure"
+	"github.com/sequra/s3logsbeat/input"
+)
+
+var (
+	defaultConfig = config{
+		VisibilityTimeout: 5 * time.Minute,
+	}
+)
+
+type config struct {
+	input.GlobalConfig `config:",inline"`
+	Queues             []string      `config:"queues"`
+	VisibilityTimeout  time.Duration `config:"visibility_timeout" validate:"min=1s, max=168h"`
+	Azure              azure.Config  `config:"azure"`
+}
+
+func (c *config) Validate() error {
+	if err := c.GlobalConfig.Validate(); err != nil {
+		return err
+	}
+
+	if len(c.Queues) == 0 {
+		return fmt.Errorf("No queues defined for azure_queue input")
+	}
+	return nil
+}
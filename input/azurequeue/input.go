@@ -0,0 +1,83 @@
+package azurequeue
+
+import (
+	"github.com/sequra/s3logsbeat/azure"
+	"github.com/sequra/s3logsbeat/input"
+	"github.com/sequra/s3logsbeat/pipeline"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+func init() {
+	err := input.Register("azure_queue", NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input reads blobs from Azure Blob Storage notified by Event Grid on Storage Queues
+type Input struct {
+	cfg     *common.Config
+	config  config
+	done    chan struct{}
+	out     chan pipeline.Queue
+	ri      *pipeline.S3ReaderInformation
+	account *azure.Account
+}
+
+// NewInput instantiates a new Azure Blob Storage input
+func NewInput(
+	cfg *common.Config,
+	context input.Context,
+) (input.Input, error) {
+	p := &Input{
+		config: defaultConfig,
+		cfg:    cfg,
+		done:   context.Done,
+		out:    context.OutQueue,
+	}
+
+	if err := cfg.Unpack(&p.config); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.account, err = azure.NewAccount(&p.config.Azure); err != nil {
+		return nil, err
+	}
+	p.ri, err = p.config.NewS3ReaderInformation(context)
+	if err != nil {
+		return nil, err
+	}
+	p.ri.WithStorage(azure.NewBlob(p.account))
+
+	return p, nil
+}
+
+// Run runs the input
+func (p *Input) Run() {
+	logp.Debug("s3logsbeat", "Start next scan")
+
+	for _, name := range p.config.Queues {
+		queue := pipeline.NewAzureQueue(azure.NewQueue(p.account, name, p.config.VisibilityTimeout), p.ri)
+
+		select {
+		case p.out <- queue:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Wait stops the input
+// Once the app is goning to stop, we will not accept more queue messages, so we can stop
+// this input directly
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Stop stops the input
+func (p *Input) Stop() {
+	// Nothing to do, as we don't control done channel and it should already be closed
+}
@@ -2,30 +2,163 @@
 package input
 
 import (
+	"fmt"
 	"regexp"
 	"time"
 
 	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+	"github.com/sequra/s3logsbeat/aws"
 	cfg "github.com/sequra/s3logsbeat/config"
+	"github.com/sequra/s3logsbeat/deadletter"
+	"github.com/sequra/s3logsbeat/logparser"
+	"github.com/sequra/s3logsbeat/pipeline"
+)
+
+// Options for on_parse_error
+const (
+	// OnParseErrorDrop drops lines that could not be parsed (only logged)
+	OnParseErrorDrop = "drop"
+	// OnParseErrorPublish publishes lines that could not be parsed as error events
+	OnParseErrorPublish = "publish"
 )
 
 // GlobalConfig global config for all kind of inputs
 type GlobalConfig struct {
-	Type             string            `config:"type" validate:"required"`
-	PollFrequency    time.Duration     `config:"poll_frequency" validate:"min=0,nonzero"`
-	LogFormat        string            `config:"log_format" validate:"required"`
-	LogFormatOptions *common.Config    `config:"log_format_options"`
-	KeyRegexFields   *regexp.Regexp    `config:"key_regex_fields"`
-	Fields           map[string]string `config:"fields"`
+	Type              string                      `config:"type" validate:"required"`
+	PollFrequency     time.Duration               `config:"poll_frequency" validate:"min=0,nonzero"`
+	LogFormat         string                      `config:"log_format" validate:"required"`
+	LogFormatOptions  *common.Config              `config:"log_format_options"`
+	KeyRegexFields    *regexp.Regexp              `config:"key_regex_fields"`
+	Processors        processors.PluginConfig     `config:"processors"`
+	Index             string                      `config:"index"`
+	DownloadRetries   int                         `config:"download_retries" validate:"min=0"`
+	ParallelDownload  *aws.ParallelDownloadConfig `config:"parallel_download"`
+	Encryption        *aws.EncryptionConfig       `config:"encryption"`
+	AWS               *aws.SessionConfig          `config:"aws"`
+	Pipeline          string                      `config:"pipeline"`
+	OnParseError      string                      `config:"on_parse_error"`
+	DeadLetter        *deadletter.Config          `config:"dead_letter"`
+	IncludeRawMessage *logparser.RawMessageConfig `config:"include_raw_message"`
+	Provenance        *ProvenanceConfig           `config:"provenance"`
+
+	// Objects with too many lines which could not be parsed are considered failed
+	ParseErrorThreshold *pipeline.ParseErrorThresholdConfig `config:"parse_error_threshold"`
+
+	// Filters of S3 objects: include_keys, exclude_keys, min_size, max_size and event_names
+	pipeline.ObjectFilterConfig `config:",inline"`
+
+	// Fields, fields_under_root and tags added to each event published by this input
+	common.EventMetadata `config:",inline"`
+}
+
+// ProvenanceConfig configures information about where events come from
+type ProvenanceConfig struct {
+	Target string `config:"target"`
 }
 
 var (
 	defaultConfig = GlobalConfig{
-		Type: cfg.DefaultType,
+		Type:            cfg.DefaultType,
+		OnParseError:    OnParseErrorDrop,
+		DownloadRetries: 3,
 	}
 )
 
 // Validate validates global config logic
 func (c *GlobalConfig) Validate() error {
+	switch c.OnParseError {
+	case "":
+		c.OnParseError = OnParseErrorDrop
+	case OnParseErrorDrop, OnParseErrorPublish:
+	default:
+		return fmt.Errorf("Invalid on_parse_error value %s. Options: %s, %s", c.OnParseError, OnParseErrorDrop, OnParseErrorPublish)
+	}
 	return nil
 }
+
+// Validate validates provenance config logic
+func (c *ProvenanceConfig) Validate() error {
+	switch c.Target {
+	case "":
+		c.Target = pipeline.ProvenanceTargetFields
+	case pipeline.ProvenanceTargetFields, pipeline.ProvenanceTargetMetadata:
+	default:
+		return fmt.Errorf("Invalid provenance target %s. Options: %s, %s", c.Target, pipeline.ProvenanceTargetFields, pipeline.ProvenanceTargetMetadata)
+	}
+	return nil
+}
+
+// Routing obtains the index and the ingest pipeline to which events of this input are sent.
+// Values not set on the input are obtained from the defaults of its log format (if any)
+func (c *GlobalConfig) Routing(formats map[string]cfg.FormatConfig) (index, pipeline string) {
+	index, pipeline = c.Index, c.Pipeline
+	if f, ok := formats[c.LogFormat]; ok {
+		if index == "" {
+			index = f.Index
+		}
+		if pipeline == "" {
+			pipeline = f.Pipeline
+		}
+	}
+	return
+}
+
+// NewS3ReaderInformation creates the information needed on S3 reader stage from current config.
+// Events are published through the client of the input context
+func (c *GlobalConfig) NewS3ReaderInformation(context Context) (*pipeline.S3ReaderInformation, error) {
+	logParser, err := logparser.GetPredefinedParser(c.LogFormat, c.LogFormatOptions)
+	if err != nil {
+		return nil, err
+	}
+	if c.IncludeRawMessage != nil {
+		logParser, err = logparser.WithRawMessage(logParser, c.IncludeRawMessage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	awsSession := aws.NewSession()
+	clientSession := awsSession
+	if c.AWS != nil {
+		awsSession, err = aws.NewSessionFromConfig(c.AWS)
+		if err != nil {
+			return nil, err
+		}
+		clientSession = c.AWS.ClientSession(awsSession)
+	}
+
+	var deadLetter *deadletter.Sink
+	if c.DeadLetter != nil {
+		deadLetter, err = deadletter.New(c.DeadLetter, awsSession)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var encryption *aws.Encryption
+	if c.Encryption != nil {
+		encryption, err = aws.NewEncryption(c.Encryption, awsSession)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ri := pipeline.NewS3ReaderInformation(logParser, c.KeyRegexFields, c.LogFormat).
+		WithInputName(context.Name).
+		WithClient(context.Client).
+		WithSession(clientSession).
+		WithDownloadRetries(c.DownloadRetries).
+		WithParallelDownload(c.ParallelDownload).
+		WithEncryption(encryption).
+		WithPublishParseErrors(c.OnParseError == OnParseErrorPublish).
+		WithDeadLetter(deadLetter).
+		WithObjectFilter(c.ObjectFilterConfig)
+	if c.Provenance != nil {
+		ri.WithProvenance(c.Provenance.Target)
+	}
+	if c.ParseErrorThreshold != nil {
+		ri.WithParseErrorThreshold(c.ParseErrorThreshold)
+	}
+	return ri, nil
+}
@@ -0,0 +1,22 @@
+package deadletter
+
+import (
+	"github.com/sequra/s3logsbeat/deadletter"
+	"github.com/sequra/s3logsbeat/input"
+)
+
+var (
+	defaultConfig = config{}
+)
+
+type config struct {
+	input.GlobalConfig `config:",inline"`
+	deadletter.Config  `config:",inline"`
+}
+
+func (c *config) Validate() error {
+	if err := c.GlobalConfig.Validate(); err != nil {
+		return err
+	}
+	return c.Config.Validate()
+}
@@ -0,0 +1,90 @@
+package deadletter
+
+import (
+	"time"
+
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/sequra/s3logsbeat/input"
+	"github.com/sequra/s3logsbeat/pipeline"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+func init() {
+	err := input.Register("dead_letter", NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input replays dead-letter files present on a local directory or on an S3 prefix
+type Input struct {
+	cfg    *common.Config
+	config config
+	done   chan struct{}
+	out    chan *pipeline.S3List
+	ri     *pipeline.S3ReaderInformation
+}
+
+// NewInput instantiates a new dead-letter input
+func NewInput(
+	cfg *common.Config,
+	context input.Context,
+) (input.Input, error) {
+	p := &Input{
+		config: defaultConfig,
+		cfg:    cfg,
+		done:   context.Done,
+		out:    context.OutS3List,
+	}
+
+	if err := cfg.Unpack(&p.config); err != nil {
+		return nil, err
+	}
+
+	var err error
+	p.ri, err = p.config.NewS3ReaderInformation(context)
+	if err != nil {
+		return nil, err
+	}
+	p.ri.WithDeadLetterReplay()
+	if p.config.Path != "" {
+		p.ri.WithStorage(pipeline.NewLocalStorage())
+	}
+
+	return p, nil
+}
+
+// Run runs the input
+func (p *Input) Run() {
+	logp.Debug("s3logsbeat", "Start next scan")
+
+	var s3list *pipeline.S3List
+	since, to := time.Time{}, time.Unix(1<<63-62135596801, 999999999)
+	if p.config.Path != "" {
+		s3list = pipeline.NewS3ListFromStorage(pipeline.NewLocalStorage(), aws.NewS3Object(p.config.Path, ""), p.ri, since, to)
+	} else {
+		s3prefix, err := aws.NewS3ObjectFromURI(p.config.S3Prefix)
+		if err != nil {
+			logp.Critical("Couldn't parse S3 URI %s", p.config.S3Prefix)
+			return
+		}
+		s3list = pipeline.NewS3List(p.ri.GetSession(), s3prefix, p.ri, since, to)
+	}
+
+	select {
+	case p.out <- s3list:
+	case <-p.done:
+	}
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Stop stops the input
+func (p *Input) Stop() {
+	// Nothing to do, as we don't control done channel and it should already be closed
+}
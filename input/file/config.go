@@ -0,0 +1,34 @@
+package file
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sequra/s3logsbeat/input"
+)
+
+var (
+	defaultConfig = config{}
+)
+
+type config struct {
+	input.GlobalConfig `config:",inline"`
+	Paths              []string `config:"paths"`
+	RegistryFile       string   `config:"registry_file"`
+}
+
+func (c *config) Validate() error {
+	if err := c.GlobalConfig.Validate(); err != nil {
+		return err
+	}
+
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("No path defined for file input")
+	}
+	for _, p := range c.Paths {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("Invalid path pattern %s: %v", p, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/sequra/s3logsbeat/input"
+	"github.com/sequra/s3logsbeat/pipeline"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
+)
+
+func init() {
+	err := input.Register("file", NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input reads log files present on local filesystem
+type Input struct {
+	cfg      *common.Config
+	config   config
+	done     chan struct{}
+	out      chan *pipeline.S3List
+	ri       *pipeline.S3ReaderInformation
+	registry *registry
+}
+
+// NewInput instantiates a new file input
+func NewInput(
+	cfg *common.Config,
+	context input.Context,
+) (input.Input, error) {
+	p := &Input{
+		config: defaultConfig,
+		cfg:    cfg,
+		done:   context.Done,
+		out:    context.OutS3List,
+	}
+
+	if err := cfg.Unpack(&p.config); err != nil {
+		return nil, err
+	}
+
+	var err error
+	p.ri, err = p.config.NewS3ReaderInformation(context)
+	if err != nil {
+		return nil, err
+	}
+	p.ri.WithStorage(pipeline.NewLocalStorage())
+
+	if p.config.RegistryFile != "" {
+		p.registry, err = newRegistry(paths.Resolve(paths.Data, p.config.RegistryFile))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Run runs the input
+func (p *Input) Run() {
+	logp.Debug("s3logsbeat", "Start next scan")
+	since, to := time.Time{}, time.Unix(1<<63-62135596801, 999999999)
+
+	for _, pattern := range p.config.Paths {
+		// Keys (used on key_regex_fields) are paths relative to the base directory of the pattern
+		base := baseDir(pattern)
+		s3list := pipeline.NewS3ListFromStorage(pipeline.NewLocalGlobStorage(pattern), aws.NewS3Object(base, ""), p.ri, since, to)
+		if p.registry != nil {
+			s3list.WithTracker(p.registry)
+		}
+
+		select {
+		case p.out <- s3list:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// baseDir obtains the longest leading directory of pattern without glob meta characters.
+// Patterns without meta characters are a directory (its own base) or a file
+func baseDir(pattern string) string {
+	dir := filepath.Clean(pattern)
+	if !hasMeta(dir) {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		return filepath.Dir(dir)
+	}
+	for hasMeta(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Stop stops the input
+func (p *Input) Stop() {
+	// Nothing to do, as we don't control done channel and it should already be closed
+}
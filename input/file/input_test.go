@@ -0,0 +1,26 @@
+// +build !integration
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-file")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.log")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("a\n"), 0600))
+
+	assert.Equal(t, dir, baseDir(dir))
+	assert.Equal(t, dir, baseDir(file))
+	assert.Equal(t, dir, baseDir(filepath.Join(dir, "*.log")))
+	assert.Equal(t, dir, baseDir(filepath.Join(dir, "prod-*", "2019", "*.gz")))
+	assert.Equal(t, "logs", baseDir("logs/[ab]/*.log"))
+}
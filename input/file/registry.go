@@ -0,0 +1,166 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/sequra/s3logsbeat/pipeline"
+)
+
+// registry records files completely processed (all their events ACKed), persisting them on a file
+// in order to not read them again unless they change (size or modification time)
+type registry struct {
+	mutex sync.Mutex
+	path  string
+	files map[string]*registryEntry
+}
+
+type registryEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// newRegistry loads the registry persisted on path (if exists)
+func newRegistry(path string) (*registry, error) {
+	r := &registry{
+		path:  path,
+		files: map[string]*registryEntry{},
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*registryEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("Could not parse file registry %s: %v", path, err)
+	}
+	for _, e := range entries {
+		r.files[e.Path] = e
+	}
+	logp.Info("Loaded %d processed files from registry %s", len(entries), path)
+	return r, nil
+}
+
+// filePath obtains the absolute path of the file represented by o
+func filePath(o *aws.S3Object) string {
+	p := filepath.Join(o.Bucket, filepath.FromSlash(o.Key))
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// Processed returns whether o has already been processed and has not changed since then
+func (r *registry) Processed(o *aws.S3Object) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	e, ok := r.files[filePath(o)]
+	return ok && e.Size == o.Size && e.ModTime.Equal(o.LastModified)
+}
+
+// Track obtains the notifications of the process of o, which record it once completed
+func (r *registry) Track(o *aws.S3Object) pipeline.S3ObjectProcessNotifications {
+	return &fileNotifications{
+		registry: r,
+		o:        o,
+	}
+}
+
+// record records o as processed and persists the registry
+func (r *registry) record(o *aws.S3Object) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	p := filePath(o)
+	r.files[p] = &registryEntry{
+		Path:    p,
+		Size:    o.Size,
+		ModTime: o.LastModified,
+	}
+	if err := r.save(); err != nil {
+		logp.Err("Could not save file registry %s. Error: %v", r.path, err)
+	}
+}
+
+// save persists the registry (atomically, writing a temporary file first)
+func (r *registry) save() error {
+	entries := make([]*registryEntry, 0, len(r.files))
+	for _, e := range r.files {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0750); err != nil {
+		return err
+	}
+	tmp := r.path + ".new"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// fileNotifications records a file on the registry when it has been completely read
+// and all its events have been ACKed. Files which could not be read are not recorded
+type fileNotifications struct {
+	registry *registry
+	o        *aws.S3Object
+
+	mutex     sync.Mutex
+	events    uint64
+	processed bool
+	failed    bool
+	recorded  bool
+}
+
+// EventACKed reduces the number of events pending to ACK, recording the file if completed
+func (n *fileNotifications) EventACKed() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.events--
+	n.recordOnCompleted()
+}
+
+// EventSent adds the number of events pending to ACK
+func (n *fileNotifications) EventSent() {
+	n.mutex.Lock()
+	n.events++
+	n.mutex.Unlock()
+}
+
+// S3ObjectProcessed marks the file as read, recording it if completed
+func (n *fileNotifications) S3ObjectProcessed() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.processed = true
+	n.recordOnCompleted()
+}
+
+// S3ObjectFailed marks the file as failed, so it is not recorded
+func (n *fileNotifications) S3ObjectFailed(err error) {
+	n.mutex.Lock()
+	n.failed = true
+	n.mutex.Unlock()
+}
+
+func (n *fileNotifications) recordOnCompleted() {
+	if n.processed && n.events == 0 && !n.failed && !n.recorded {
+		n.recorded = true
+		logp.Debug("s3logsbeat", "Recording file %s as processed", filePath(n.o))
+		n.registry.record(n.o)
+	}
+}
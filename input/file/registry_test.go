@@ -0,0 +1,72 @@
+// +build !integration
+
+package file
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func newTestFileObject(dir, key string, size int64, modTime time.Time) *aws.S3Object {
+	o := aws.NewS3Object(dir, key)
+	o.Size = size
+	o.LastModified = modTime
+	return o
+}
+
+func TestRegistryRecordsCompletedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "registry.json")
+
+	r, err := newRegistry(path)
+	assert.NoError(t, err)
+	modTime := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	o := newTestFileObject(dir, "logs/a.log", 10, modTime)
+	assert.False(t, r.Processed(o))
+
+	// Recorded once read and all its events ACKed
+	n := r.Track(o)
+	n.EventSent()
+	n.EventSent()
+	n.EventACKed()
+	n.S3ObjectProcessed()
+	assert.False(t, r.Processed(o))
+	n.EventACKed()
+	assert.True(t, r.Processed(o))
+
+	// Registry is persisted
+	r, err = newRegistry(path)
+	assert.NoError(t, err)
+	assert.True(t, r.Processed(o))
+
+	// Modified files are read again
+	assert.False(t, r.Processed(newTestFileObject(dir, "logs/a.log", 20, modTime)))
+	assert.False(t, r.Processed(newTestFileObject(dir, "logs/a.log", 10, modTime.Add(time.Second))))
+}
+
+func TestRegistryDoesNotRecordFailedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r, err := newRegistry(filepath.Join(dir, "registry.json"))
+	assert.NoError(t, err)
+	o := newTestFileObject(dir, "logs/a.log", 10, time.Now())
+
+	n := r.Track(o)
+	n.(*fileNotifications).S3ObjectFailed(errors.New("access denied"))
+	n.S3ObjectProcessed()
+	assert.False(t, r.Processed(o))
+	_, err = os.Stat(filepath.Join(dir, "registry.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,38 @@
+package gcspubsub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sequra/s3logsbeat/gcp"
+	"github.com/sequra/s3logsbeat/input"
+)
+
+var (
+	defaultConfig = config{
+		AckDeadline: time.Minute,
+	}
+)
+
+type config struct {
+	input.GlobalConfig `config:",inline"`
+	Subscriptions      []string      `config:"subscriptions"`
+	AckDeadline        time.Duration `config:"ack_deadline" validate:"min=10s, max=10m"`
+	GCP                gcp.Config    `config:"gcp"`
+}
+
+func (c *config) Validate() error {
+	if err := c.GlobalConfig.Validate(); err != nil {
+		return err
+	}
+
+	if len(c.Subscriptions) == 0 {
+		return fmt.Errorf("No subscriptions defined for gcs_pubsub input")
+	}
+	for _, s := range c.Subscriptions {
+		if err := gcp.ValidateSubscription(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package gcspubsub
+
+import (
+	"github.com/sequra/s3logsbeat/gcp"
+	"github.com/sequra/s3logsbeat/input"
+	"github.com/sequra/s3logsbeat/pipeline"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+func init() {
+	err := input.Register("gcs_pubsub", NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input reads objects from Google Cloud Storage notified on Pub/Sub subscriptions
+type Input struct {
+	cfg     *common.Config
+	config  config
+	done    chan struct{}
+	out     chan pipeline.Queue
+	ri      *pipeline.S3ReaderInformation
+	clients *gcp.Clients
+}
+
+// NewInput instantiates a new Google Cloud Storage input
+func NewInput(
+	cfg *common.Config,
+	context input.Context,
+) (input.Input, error) {
+	p := &Input{
+		config: defaultConfig,
+		cfg:    cfg,
+		done:   context.Done,
+		out:    context.OutQueue,
+	}
+
+	if err := cfg.Unpack(&p.config); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.clients, err = gcp.NewClients(&p.config.GCP); err != nil {
+		return nil, err
+	}
+	p.ri, err = p.config.NewS3ReaderInformation(context)
+	if err != nil {
+		return nil, err
+	}
+	p.ri.WithStorage(gcp.NewGCS(p.clients))
+
+	return p, nil
+}
+
+// Run runs the input
+func (p *Input) Run() {
+	logp.Debug("s3logsbeat", "Start next scan")
+
+	for _, subscription := range p.config.Subscriptions {
+		pubSub := pipeline.NewPubSub(gcp.NewPubSub(p.clients, subscription, p.config.AckDeadline), p.ri)
+
+		select {
+		case p.out <- pubSub:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Wait stops the input
+// Once the app is goning to stop, we will not accept more Pub/Sub messages, so we can stop
+// this input directly
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Stop stops the input
+func (p *Input) Stop() {
+	// Nothing to do, as we don't control done channel and it should already be closed
+}
@@ -5,10 +5,13 @@ import (
 	"sync"
 	"time"
 
+	cfg "github.com/sequra/s3logsbeat/config"
 	"github.com/sequra/s3logsbeat/pipeline"
 
+	"github.com/elastic/beats/libbeat/beat"
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/processors"
 
 	"github.com/mitchellh/hashstructure"
 )
@@ -29,15 +32,19 @@ type Runner struct {
 	ID        uint64
 	Once      bool
 	beatDone  chan struct{}
-	outSQS    chan *pipeline.SQS
+	outQueue  chan pipeline.Queue
 	outS3List chan *pipeline.S3List
+	client    beat.Client
 }
 
-// New instantiates a new Runner
+// New instantiates a new Runner. A new client is connected to publisher in order to publish
+// the events of this input with its own processors, fields and tags
 func New(
 	conf *common.Config,
+	publisher beat.Pipeline,
+	formats map[string]cfg.FormatConfig,
 	beatDone chan struct{},
-	outSQS chan *pipeline.SQS,
+	outQueue chan pipeline.Queue,
 	outS3List chan *pipeline.S3List,
 ) (*Runner, error) {
 	input := &Runner{
@@ -46,7 +53,7 @@ func New(
 		done:      make(chan struct{}),
 		Once:      false,
 		beatDone:  beatDone,
-		outSQS:    outSQS,
+		outQueue:  outQueue,
 		outS3List: outS3List,
 	}
 
@@ -68,15 +75,23 @@ func New(
 		return input, err
 	}
 
+	input.client, err = connect(publisher, &input.config, formats)
+	if err != nil {
+		return input, err
+	}
+
 	context := Context{
+		Name:      input.String(),
 		Done:      input.done,
 		BeatDone:  input.beatDone,
-		OutSQS:    input.outSQS,
+		OutQueue:  input.outQueue,
 		OutS3List: input.outS3List,
+		Client:    input.client,
 	}
 	var ipt Input
 	ipt, err = f(conf, context)
 	if err != nil {
+		input.CloseClient()
 		return input, err
 	}
 	input.input = ipt
@@ -84,6 +99,32 @@ func New(
 	return input, nil
 }
 
+// connect connects a new client to publisher configured with processors, fields and tags of the input.
+// Index and ingest pipeline are set on events metadata, so they are used by Elasticsearch and Logstash outputs
+func connect(publisher beat.Pipeline, config *GlobalConfig, formats map[string]cfg.FormatConfig) (beat.Client, error) {
+	procs, err := processors.New(config.Processors)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading processors: %v", err)
+	}
+
+	meta := common.MapStr{}
+	index, pipeline := config.Routing(formats)
+	if index != "" {
+		meta["index"] = index
+	}
+	if pipeline != "" {
+		meta["pipeline"] = pipeline
+	}
+
+	return publisher.ConnectWith(beat.ClientConfig{
+		Processing: beat.ProcessingConfig{
+			EventMetadata: config.EventMetadata,
+			Meta:          meta,
+			Processor:     procs,
+		},
+	})
+}
+
 // Start starts the input
 func (p *Runner) Start() {
 	p.wg.Add(1)
@@ -150,6 +191,14 @@ func (p *Runner) stop() {
 	}
 }
 
+// CloseClient closes the client used to publish events of this input. It must be called once all
+// events of the input have been published, as pending events are dropped
+func (p *Runner) CloseClient() {
+	if p.client != nil {
+		p.client.Close()
+	}
+}
+
 func (p *Runner) String() string {
 	return fmt.Sprintf("input [type=%s, ID=%d]", p.config.Type, p.ID)
 }
@@ -5,16 +5,21 @@ import (
 
 	"github.com/sequra/s3logsbeat/pipeline"
 
+	"github.com/elastic/beats/libbeat/beat"
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/logp"
 )
 
 // Context input context
 type Context struct {
+	// Name identifies the input on logs
+	Name      string
 	Done      chan struct{}
 	BeatDone  chan struct{}
-	OutSQS    chan *pipeline.SQS
+	OutQueue  chan pipeline.Queue
 	OutS3List chan *pipeline.S3List
+	// Client publishes events of the input applying its processors, fields and tags
+	Client beat.Client
 }
 
 // Factory is used to register functions creating new Input instances.
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/sequra/s3logsbeat/input"
+	"github.com/sequra/s3logsbeat/pipeline"
 )
 
 var (
@@ -13,11 +14,12 @@ var (
 
 type config struct {
 	input.GlobalConfig `config:",inline"`
-	Buckets            []string  `config:"buckets"`
-	SinceStr           string    `config:"since"`
-	ToStr              string    `config:"to"`
-	Since              time.Time `config:",ignore"`
-	To                 time.Time `config:",ignore"`
+	Buckets            []string                        `config:"buckets"`
+	SinceStr           string                          `config:"since"`
+	ToStr              string                          `config:"to"`
+	Since              time.Time                       `config:",ignore"`
+	To                 time.Time                       `config:",ignore"`
+	ArchivedObjects    *pipeline.ArchivedObjectsConfig `config:"archived_objects"`
 }
 
 func (c *config) Validate() error {
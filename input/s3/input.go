@@ -3,7 +3,6 @@ package s3
 import (
 	"github.com/sequra/s3logsbeat/aws"
 	"github.com/sequra/s3logsbeat/input"
-	"github.com/sequra/s3logsbeat/logparser"
 	"github.com/sequra/s3logsbeat/pipeline"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -19,11 +18,11 @@ func init() {
 
 // Input contains the input and its config
 type Input struct {
-	cfg       *common.Config
-	config    config
-	done      chan struct{}
-	out       chan *pipeline.S3List
-	logParser logparser.LogParser
+	cfg    *common.Config
+	config config
+	done   chan struct{}
+	out    chan *pipeline.S3List
+	ri     *pipeline.S3ReaderInformation
 }
 
 // NewInput instantiates a new Log
@@ -43,26 +42,33 @@ func NewInput(
 	}
 
 	var err error
-	p.logParser, err = logparser.GetPredefinedParser(p.config.LogFormat, p.config.LogFormatOptions)
+	p.ri, err = p.config.NewS3ReaderInformation(context)
 	if err != nil {
 		return nil, err
 	}
 
+	if p.config.ArchivedObjects != nil {
+		archivedObjects, err := pipeline.NewArchivedObjects(p.config.ArchivedObjects)
+		if err != nil {
+			return nil, err
+		}
+		p.ri.WithArchivedObjects(archivedObjects)
+	}
+
 	return p, nil
 }
 
 // Run runs the input
 func (p *Input) Run() {
 	logp.Debug("s3logsbeat", "Start next scan")
-	awsSession := aws.NewSession()
+	awsSession := p.ri.GetSession()
 
 	for _, s3uri := range p.config.Buckets {
 		s3prefix, err := aws.NewS3ObjectFromURI(s3uri)
 		if err != nil {
 			logp.Critical("Couldn't parse S3 URI %s", s3uri)
 		}
-		ri := pipeline.NewS3ReaderInformation(p.logParser, p.config.KeyRegexFields, p.config.LogFormat)
-		s3list := pipeline.NewS3List(awsSession, s3prefix, ri, p.config.Since, p.config.To)
+		s3list := pipeline.NewS3List(awsSession, s3prefix, p.ri, p.config.Since, p.config.To)
 
 		select {
 		case p.out <- s3list:
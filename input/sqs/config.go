@@ -2,17 +2,43 @@ package sqs
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/sequra/s3logsbeat/input"
+	"github.com/sequra/s3logsbeat/pipeline"
 )
 
 var (
-	defaultConfig = config{}
+	defaultConfig = config{
+		WaitTime:   20 * time.Second,
+		Backoff:    1 * time.Second,
+		MaxBackoff: 10 * time.Second,
+		VisibilityExtension: pipeline.VisibilityExtensionConfig{
+			Step: 1 * time.Minute,
+			Max:  pipeline.SQSMaxVisibility,
+		},
+		Batch: pipeline.DefaultSQSBatchConfig,
+		Retry: pipeline.DefaultSQSRetryConfig,
+	}
 )
 
 type config struct {
 	input.GlobalConfig `config:",inline"`
-	QueuesURL          []string `config:"queues_url"`
+	QueuesURL          []string      `config:"queues_url"`
+	WaitTime           time.Duration `config:"wait_time" validate:"min=0, max=20s"`
+	Backoff            time.Duration `config:"backoff" validate:"min=0"`
+	MaxBackoff         time.Duration `config:"max_backoff" validate:"min=0"`
+
+	VisibilityExtension pipeline.VisibilityExtensionConfig `config:"visibility_extension"`
+	Batch               pipeline.SQSBatchConfig            `config:"batch"`
+	Retry               pipeline.SQSRetryConfig            `config:"retry"`
+	SNS                 snsConfig                          `config:"sns"`
+}
+
+// snsConfig configures S3 events received thru SNS. Envelopes are always unwrapped, but their
+// signature is only verified if VerifySignature is set
+type snsConfig struct {
+	VerifySignature bool `config:"verify_signature"`
 }
 
 func (c *config) Validate() error {
@@ -23,5 +49,11 @@ func (c *config) Validate() error {
 	if len(c.QueuesURL) == 0 {
 		return fmt.Errorf("No queues_url defined for sqs input")
 	}
+	if c.MaxBackoff < c.Backoff {
+		return fmt.Errorf("max_backoff (%v) must be greater than or equal to backoff (%v)", c.MaxBackoff, c.Backoff)
+	}
+	if c.WaitTime == 0 && c.Backoff == 0 {
+		return fmt.Errorf("Either wait_time or backoff must be greater than 0 to avoid polling empty queues continuously")
+	}
 	return nil
 }
@@ -3,7 +3,6 @@ package sqs
 import (
 	"github.com/sequra/s3logsbeat/aws"
 	"github.com/sequra/s3logsbeat/input"
-	"github.com/sequra/s3logsbeat/logparser"
 	"github.com/sequra/s3logsbeat/pipeline"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -19,11 +18,13 @@ func init() {
 
 // Input contains the input and its config
 type Input struct {
-	cfg       *common.Config
-	config    config
-	done      chan struct{}
-	out       chan *pipeline.SQS
-	logParser logparser.LogParser
+	cfg    *common.Config
+	config config
+	done   chan struct{}
+	out    chan pipeline.Queue
+	ri     *pipeline.S3ReaderInformation
+	// started is true once queues have been sent to their receive loops
+	started bool
 }
 
 // NewInput instantiates a new Log
@@ -35,7 +36,7 @@ func NewInput(
 		config: defaultConfig,
 		cfg:    cfg,
 		done:   context.Done,
-		out:    context.OutSQS,
+		out:    context.OutQueue,
 	}
 
 	if err := cfg.Unpack(&p.config); err != nil {
@@ -43,7 +44,7 @@ func NewInput(
 	}
 
 	var err error
-	p.logParser, err = logparser.GetPredefinedParser(p.config.LogFormat, p.config.LogFormatOptions)
+	p.ri, err = p.config.NewS3ReaderInformation(context)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +53,34 @@ func NewInput(
 }
 
 // Run runs the input
+// Each queue is sent only once, as it is polled continuously by its own receive loop (poll_frequency
+// ticks are ignored)
 func (p *Input) Run() {
-	logp.Debug("s3logsbeat", "Start next scan")
-	awsSession := aws.NewSession()
+	if p.started {
+		return
+	}
+	logp.Debug("s3logsbeat", "Starting receive loops of sqs input")
+	awsSession := p.ri.GetSession()
+	receiveLoop := &pipeline.ReceiveLoop{
+		Backoff:    p.config.Backoff,
+		MaxBackoff: p.config.MaxBackoff,
+	}
+
+	var snsVerifier *aws.SNSVerifier
+	if p.config.SNS.VerifySignature {
+		snsVerifier = aws.NewSNSVerifier()
+	}
 
+	p.started = true
 	for _, queue := range p.config.QueuesURL {
-		ri := pipeline.NewS3ReaderInformation(p.logParser, p.config.KeyRegexFields, p.config.LogFormat)
-		sqs := pipeline.NewSQS(awsSession, &queue, ri)
+		queueURL := queue
+		sqs := pipeline.NewSQS(awsSession, &queueURL, p.ri).
+			WithWaitTime(p.config.WaitTime).
+			WithReceiveLoop(receiveLoop).
+			WithVisibilityExtension(&p.config.VisibilityExtension).
+			WithBatch(&p.config.Batch).
+			WithRetry(&p.config.Retry).
+			WithSNSVerifier(snsVerifier)
 
 		select {
 		case p.out <- sqs:
@@ -0,0 +1,55 @@
+package input
+
+import (
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	cfg "github.com/sequra/s3logsbeat/config"
+	"github.com/sequra/s3logsbeat/logparser"
+)
+
+// IndexTemplates obtains the mapping properties of each index to which inputs send events, based
+// on the fields generated by the parser of their log format. Inputs without index or whose
+// parser does not know its fields are ignored
+func IndexTemplates(inputConfigs []*common.Config, formats map[string]cfg.FormatConfig) (map[string]common.MapStr, error) {
+	templates := map[string]common.MapStr{}
+	for _, inputConfig := range inputConfigs {
+		if !inputConfig.Enabled() {
+			continue
+		}
+		config := defaultConfig
+		if err := inputConfig.Unpack(&config); err != nil {
+			return nil, err
+		}
+		index, _ := config.Routing(formats)
+		if index == "" {
+			continue
+		}
+
+		logParser, err := logparser.GetPredefinedParser(config.LogFormat, config.LogFormatOptions)
+		if err != nil {
+			return nil, err
+		}
+		if config.IncludeRawMessage != nil {
+			logParser, err = logparser.WithRawMessage(logParser, config.IncludeRawMessage)
+			if err != nil {
+				return nil, err
+			}
+		}
+		mapper, ok := logParser.(logparser.Mapper)
+		if !ok {
+			continue
+		}
+		properties := mapper.Mappings()
+		if len(properties) == 0 {
+			continue
+		}
+
+		if t, ok := templates[index]; ok {
+			logp.Debug("s3logsbeat", "Merging mappings of log format %s on index template %s", config.LogFormat, index)
+			t.DeepUpdate(properties)
+		} else {
+			templates[index] = properties
+		}
+	}
+	return templates, nil
+}
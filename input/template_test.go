@@ -0,0 +1,65 @@
+// +build !integration
+
+package input
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	cfg "github.com/sequra/s3logsbeat/config"
+)
+
+func TestRouting(t *testing.T) {
+	formats := map[string]cfg.FormatConfig{
+		"alb": cfg.FormatConfig{Index: "s3logsbeat-alb", Pipeline: "alb"},
+	}
+
+	c := GlobalConfig{LogFormat: "alb"}
+	index, pipeline := c.Routing(formats)
+	assert.Equal(t, "s3logsbeat-alb", index)
+	assert.Equal(t, "alb", pipeline)
+
+	c = GlobalConfig{LogFormat: "alb", Index: "myindex"}
+	index, pipeline = c.Routing(formats)
+	assert.Equal(t, "myindex", index)
+	assert.Equal(t, "alb", pipeline)
+
+	c = GlobalConfig{LogFormat: "elb"}
+	index, pipeline = c.Routing(formats)
+	assert.Empty(t, index)
+	assert.Empty(t, pipeline)
+}
+
+func TestIndexTemplates(t *testing.T) {
+	inputs := []*common.Config{
+		common.MustNewConfigFrom(map[string]interface{}{
+			"type":       "sqs",
+			"log_format": "alb",
+		}),
+		common.MustNewConfigFrom(map[string]interface{}{
+			"type":       "sqs",
+			"log_format": "cloudfront",
+			"index":      "s3logsbeat-cdn",
+		}),
+		common.MustNewConfigFrom(map[string]interface{}{
+			"type":       "sqs",
+			"log_format": "elb",
+		}),
+		common.MustNewConfigFrom(map[string]interface{}{
+			"type":       "sqs",
+			"log_format": "waf",
+			"index":      "s3logsbeat-waf",
+		}),
+	}
+	formats := map[string]cfg.FormatConfig{
+		"alb": cfg.FormatConfig{Index: "s3logsbeat-alb"},
+	}
+
+	templates, err := IndexTemplates(inputs, formats)
+	assert.NoError(t, err)
+	assert.Len(t, templates, 2)
+	assert.Equal(t, common.MapStr{"type": "short"}, templates["s3logsbeat-alb"]["elb_status_code"])
+	assert.Equal(t, common.MapStr{"type": "short"}, templates["s3logsbeat-cdn"]["sc_status"])
+}
@@ -1,7 +1,6 @@
 package logparser
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"regexp"
@@ -20,6 +19,7 @@ type CustomLogParser struct {
 	reNames        []string
 	reKindMap      map[string]kindElement
 	emptyValues    map[string]string
+	rawMessage     *rawMessage
 }
 
 // NewCustomLogParser creates a new custom log parser based on regular expression
@@ -35,10 +35,15 @@ func NewCustomLogParser(timestampField string, re *regexp.Regexp) *CustomLogPars
 // Copy generates a new CustomLogParser from current one
 func (c *CustomLogParser) Copy() *CustomLogParser {
 	r := &CustomLogParser{
-		re:          c.re.Copy(),
-		reIgnore:    c.re.Copy(),
-		reKindMap:   make(map[string]kindElement),
-		emptyValues: make(map[string]string),
+		timestampField: c.timestampField,
+		re:             c.re.Copy(),
+		reNames:        make([]string, len(c.reNames)),
+		reKindMap:      make(map[string]kindElement),
+		emptyValues:    make(map[string]string),
+		rawMessage:     c.rawMessage,
+	}
+	if c.reIgnore != nil {
+		r.reIgnore = c.reIgnore.Copy()
 	}
 	copy(r.reNames, c.reNames)
 	for k, v := range c.reKindMap {
@@ -76,9 +81,15 @@ func (c *CustomLogParser) WithEmptyValues(emptyValues map[string]string) *Custom
 	return c
 }
 
+// WithRawMessage configures current log parser to keep original lines on events
+func (c *CustomLogParser) WithRawMessage(config *RawMessageConfig) *CustomLogParser {
+	c.rawMessage = newRawMessage(config)
+	return c
+}
+
 // Parse parses a reader and sends errors and parsed elements to handlers
 func (c *CustomLogParser) Parse(reader io.Reader, mh func(*beat.Event), eh func(string, error)) error {
-	r := bufio.NewReader(reader)
+	r := NewLineReader(reader)
 	re := c.re.Copy()
 	var reIgnore *regexp.Regexp
 	if c.reIgnore != nil {
@@ -86,7 +97,7 @@ func (c *CustomLogParser) Parse(reader io.Reader, mh func(*beat.Event), eh func(
 	}
 LINE_READER:
 	for {
-		line, err := r.ReadString('\n')
+		line, err := r.ReadLine()
 		if err != nil && err != io.EOF {
 			return err
 		}
@@ -97,6 +108,7 @@ LINE_READER:
 				eh(line, fmt.Errorf("Line does not match expected format"))
 			} else {
 				fields := common.MapStr{}
+				var failedFields []string
 				for i, name := range c.reNames {
 					// Ignore the whole regexp match, unnamed groups, and empty values
 					if i == 0 || name == "" || match[i] == "" {
@@ -106,6 +118,10 @@ LINE_READER:
 					if emptyValue, ok := c.emptyValues[name]; !ok || emptyValue != match[i] {
 						if k, ok := c.reKindMap[name]; ok {
 							if v, err := parseToKind(k, match[i]); err != nil {
+								if c.rawMessage.isConversionTolerated(name) {
+									failedFields = append(failedFields, name)
+									continue
+								}
 								eh(line, fmt.Errorf("Couldn't parse field (%s) to type (%s). Error: %+v", name, k.name, err))
 								continue LINE_READER
 							} else {
@@ -122,6 +138,7 @@ LINE_READER:
 					continue LINE_READER
 				}
 				fields.Delete(c.timestampField)
+				c.rawMessage.apply(fields, line, failedFields)
 
 				event := CreateEvent(&line, timestamp, fields)
 				mh(event)
@@ -1,7 +1,6 @@
 package logparser
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -23,6 +22,7 @@ type JSONLogParserConfig struct {
 type JSONLogParser struct {
 	timestampField string
 	timestampKind  kindElement
+	rawMessage     *rawMessage
 }
 
 // NewJSONLogParserConfig creates a new JSON log parser based on a map os strins
@@ -48,12 +48,24 @@ func NewJSONLogParser(timestampField string, timestampKind kindElement) *JSONLog
 	}
 }
 
+// Copy generates a new JSONLogParser from current one
+func (j *JSONLogParser) Copy() *JSONLogParser {
+	r := *j
+	return &r
+}
+
+// WithRawMessage configures current log parser to keep original lines on events
+func (j *JSONLogParser) WithRawMessage(config *RawMessageConfig) *JSONLogParser {
+	j.rawMessage = newRawMessage(config)
+	return j
+}
+
 // Parse parses a reader and sends errors and parsed elements to handlers
 func (j *JSONLogParser) Parse(reader io.Reader, mh func(*beat.Event), eh func(string, error)) error {
-	r := bufio.NewReader(reader)
+	r := NewLineReader(reader)
 LINE_READER:
 	for {
-		line, errReadString := r.ReadString('\n')
+		line, errReadString := r.ReadLine()
 		if errReadString != nil && errReadString != io.EOF {
 			return errReadString
 		}
@@ -71,6 +83,7 @@ LINE_READER:
 				continue LINE_READER
 			}
 			delete(fields, j.timestampField)
+			j.rawMessage.apply(fields, line, nil)
 
 			event := CreateEvent(&line, timestamp, fields)
 			mh(event)
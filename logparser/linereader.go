@@ -0,0 +1,56 @@
+package logparser
+
+import (
+	"bufio"
+	"io"
+)
+
+// LineReader reads lines from a reader keeping track of the position of the
+// last line returned. Parsers use it internally, but it can also be passed
+// to Parse in order to know, from handlers, which line is being processed.
+type LineReader struct {
+	r          *bufio.Reader
+	number     uint64
+	offset     int64
+	nextOffset int64
+}
+
+// NewLineReader creates a new LineReader from reader. If reader is already a
+// LineReader, it is returned as is
+func NewLineReader(reader io.Reader) *LineReader {
+	if lr, ok := reader.(*LineReader); ok {
+		return lr
+	}
+	return &LineReader{
+		r: bufio.NewReader(reader),
+	}
+}
+
+// ReadLine reads until the first occurrence of '\n', returning a string
+// containing the data up to and including the delimiter. Errors are the
+// same as the ones returned by bufio.Reader.ReadString
+func (l *LineReader) ReadLine() (string, error) {
+	line, err := l.r.ReadString('\n')
+	if line != "" {
+		l.number++
+		l.offset = l.nextOffset
+		l.nextOffset += int64(len(line))
+	}
+	return line, err
+}
+
+// Read implements io.Reader. Data read this way is not taken into account
+// on line positions
+func (l *LineReader) Read(p []byte) (int, error) {
+	return l.r.Read(p)
+}
+
+// Line returns the number (starting on 1) of the last line read
+func (l *LineReader) Line() uint64 {
+	return l.number
+}
+
+// Offset returns the byte offset where the last line read starts
+func (l *LineReader) Offset() int64 {
+	return l.offset
+}
@@ -0,0 +1,41 @@
+// +build !integration
+
+package logparser
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineReaderPositions(t *testing.T) {
+	lr := NewLineReader(strings.NewReader("first\nsecond line\n\nlast"))
+	expected := []struct {
+		line   string
+		number uint64
+		offset int64
+	}{
+		{"first\n", 1, 0},
+		{"second line\n", 2, 6},
+		{"\n", 3, 18},
+		{"last", 4, 19},
+	}
+	for _, e := range expected {
+		line, err := lr.ReadLine()
+		if e.number == 4 {
+			assert.Equal(t, io.EOF, err)
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, e.line, line)
+		assert.Equal(t, e.number, lr.Line())
+		assert.Equal(t, e.offset, lr.Offset())
+	}
+}
+
+func TestLineReaderReused(t *testing.T) {
+	lr := NewLineReader(strings.NewReader("a\n"))
+	assert.True(t, lr == NewLineReader(lr))
+}
@@ -0,0 +1,75 @@
+package logparser
+
+import (
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// Mapper is implemented by log parsers which know the fields they generate. It is used
+// to build index templates per log format
+type Mapper interface {
+	// Mappings obtains the Elasticsearch mapping properties of the fields generated by the parser
+	Mappings() common.MapStr
+}
+
+// esType obtains the Elasticsearch type in which a kind is stored
+func (e kindElement) esType() string {
+	switch e.kind {
+	case kindBool:
+		return "boolean"
+	case kindInt8:
+		return "byte"
+	case kindInt16, kindUint8:
+		return "short"
+	case kindInt, kindInt32, kindUint16:
+		return "integer"
+	case kindInt64, kindUint, kindUint32, kindUint64:
+		return "long"
+	case kindFloat32:
+		return "float"
+	case kindFloat64:
+		return "double"
+	case kindTimeISO8601, kindTimeUnixMilliseconds, kindTimeLayout:
+		return "date"
+	default:
+		return "keyword"
+	}
+}
+
+// Mappings obtains the Elasticsearch mapping properties of the fields generated by the parser.
+// Fields without kind are stored as keywords. Timestamp field is not included as it is stored
+// on @timestamp
+func (c *CustomLogParser) Mappings() common.MapStr {
+	m := common.MapStr{}
+	for _, name := range c.reNames {
+		if name == "" || name == c.timestampField {
+			continue
+		}
+		t := "keyword"
+		if k, ok := c.reKindMap[name]; ok {
+			t = k.esType()
+		}
+		m[name] = common.MapStr{"type": t}
+	}
+	c.rawMessage.addMapping(m)
+	return m
+}
+
+// Mappings obtains the Elasticsearch mapping properties of the fields generated by the parser.
+// As JSON fields are unknown, only the original line (if configured) is included
+func (j *JSONLogParser) Mappings() common.MapStr {
+	m := common.MapStr{}
+	j.rawMessage.addMapping(m)
+	return m
+}
+
+// addMapping adds the mapping of the field in which the original line is stored (if configured)
+func (r *rawMessage) addMapping(m common.MapStr) {
+	if r == nil {
+		return
+	}
+	m[r.field] = common.MapStr{
+		"type":       "keyword",
+		"index":      false,
+		"doc_values": false,
+	}
+}
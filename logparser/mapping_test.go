@@ -0,0 +1,49 @@
+// +build !integration
+
+package logparser
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestCustomLogParserMappings(t *testing.T) {
+	p := NewCustomLogParser("timestamp", regexp.MustCompile(`^(?P<timestamp>[^ ]*) (?P<status>[^ ]*) (?P<bytes>[^ ]*) (?P<time>[^ ]*) (?P<url>[^ ]*) (?P<name>.*)$`)).
+		WithKindMap(map[string]string{
+			"timestamp": "timeISO8601",
+			"status":    "int16",
+			"bytes":     "uint64",
+			"time":      "float64",
+			"url":       "urlencoded",
+		})
+	expected := common.MapStr{
+		"status": common.MapStr{"type": "short"},
+		"bytes":  common.MapStr{"type": "long"},
+		"time":   common.MapStr{"type": "double"},
+		"url":    common.MapStr{"type": "keyword"},
+		"name":   common.MapStr{"type": "keyword"},
+	}
+	assert.Equal(t, expected, p.Mappings())
+}
+
+func TestMappingsWithRawMessage(t *testing.T) {
+	p, err := WithRawMessage(S3WAFLogParser, &RawMessageConfig{Field: "event.original"})
+	assert.NoError(t, err)
+	expected := common.MapStr{
+		"event.original": common.MapStr{"type": "keyword", "index": false, "doc_values": false},
+	}
+	assert.Equal(t, expected, p.(Mapper).Mappings())
+	assert.Empty(t, S3WAFLogParser.Mappings())
+}
+
+func TestPredefinedParsersMappings(t *testing.T) {
+	m := S3ALBLogParser.Mappings()
+	assert.Equal(t, common.MapStr{"type": "integer"}, m["client_port"])
+	assert.Equal(t, common.MapStr{"type": "short"}, m["elb_status_code"])
+	assert.Equal(t, common.MapStr{"type": "keyword"}, m["user_agent"])
+	assert.NotContains(t, m, "timestamp")
+}
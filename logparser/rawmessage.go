@@ -0,0 +1,89 @@
+package logparser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	defaultRawMessageField = "event.original"
+)
+
+// RawMessageConfig configures how original lines are kept on events
+type RawMessageConfig struct {
+	// Field in which original line is stored
+	Field string `config:"field"`
+	// MaxSize maximum number of bytes stored (0 means no limit)
+	MaxSize int `config:"max_size" validate:"min=0"`
+	// OnFailedFields if set, original line is only stored when any of these fields couldn't be
+	// converted to its kind. In this case, line is not considered as error and field is not set
+	OnFailedFields []string `config:"on_failed_fields"`
+}
+
+// Validate validates raw message config logic
+func (c *RawMessageConfig) Validate() error {
+	if c.Field == "" {
+		c.Field = defaultRawMessageField
+	}
+	return nil
+}
+
+type rawMessage struct {
+	field          string
+	maxSize        int
+	onFailedFields map[string]bool
+}
+
+func newRawMessage(c *RawMessageConfig) *rawMessage {
+	r := &rawMessage{
+		field:          c.Field,
+		maxSize:        c.MaxSize,
+		onFailedFields: make(map[string]bool),
+	}
+	if r.field == "" {
+		r.field = defaultRawMessageField
+	}
+	for _, f := range c.OnFailedFields {
+		r.onFailedFields[f] = true
+	}
+	return r
+}
+
+// isConversionTolerated returns true if a conversion failure on field should not discard the line
+func (r *rawMessage) isConversionTolerated(field string) bool {
+	return r != nil && r.onFailedFields[field]
+}
+
+// apply stores the original line on fields (if needed based on fields that failed)
+func (r *rawMessage) apply(fields common.MapStr, line string, failedFields []string) {
+	if r == nil {
+		return
+	}
+	if len(r.onFailedFields) > 0 && len(failedFields) == 0 {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if r.maxSize > 0 && len(line) > r.maxSize {
+		// Avoid cutting a multibyte character (invalid bytes before the cut are kept)
+		i := r.maxSize
+		for i > 0 && r.maxSize-i < utf8.UTFMax-1 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		line = line[:i]
+	}
+	fields.Put(r.field, line)
+}
+
+// WithRawMessage obtains a copy of log parser p which keeps original lines on events
+func WithRawMessage(p LogParser, config *RawMessageConfig) (LogParser, error) {
+	switch lp := p.(type) {
+	case *CustomLogParser:
+		return lp.Copy().WithRawMessage(config), nil
+	case *JSONLogParser:
+		return lp.Copy().WithRawMessage(config), nil
+	}
+	return nil, fmt.Errorf("Log parser %T does not support keeping raw messages", p)
+}
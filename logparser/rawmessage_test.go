@@ -0,0 +1,90 @@
+// +build !integration
+
+package logparser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseAll(t *testing.T, p LogParser, logs string) ([]*beat.Event, []error) {
+	var events []*beat.Event
+	var errors []error
+	err := p.Parse(strings.NewReader(logs), func(event *beat.Event) {
+		events = append(events, event)
+	}, func(errLine string, err error) {
+		errors = append(errors, err)
+	})
+	assert.NoError(t, err)
+	return events, errors
+}
+
+func TestRawMessageAlwaysStored(t *testing.T) {
+	logs := "str1 2016-08-10T22:08:42.945958Z 35325 120 30123 true str2 0.325 0.0318353\n"
+	base := NewCustomLogParser("time", regexTest).WithKindMap(regexKind)
+	p, err := WithRawMessage(base, &RawMessageConfig{Field: "raw"})
+	assert.NoError(t, err)
+
+	events, errors := parseAll(t, p, logs)
+	assert.Len(t, errors, 0)
+	assert.Len(t, events, 1)
+	assert.Equal(t, strings.TrimRight(logs, "\n"), events[0].Fields["raw"])
+
+	// Original parser is not modified
+	events, _ = parseAll(t, base, logs)
+	assert.Len(t, events, 1)
+	assert.NotContains(t, events[0].Fields, "raw")
+}
+
+func TestRawMessageTruncated(t *testing.T) {
+	logs := `{"timestamp":1553360693208,"message":"ñandú"}`
+	config := &RawMessageConfig{MaxSize: 44}
+	assert.NoError(t, config.Validate())
+	p, err := WithRawMessage(S3WAFLogParser, config)
+	assert.NoError(t, err)
+
+	events, _ := parseAll(t, p, logs)
+	assert.Len(t, events, 1)
+	raw, err := events[0].Fields.GetValue("event.original")
+	assert.NoError(t, err)
+	// byte 44 is in the middle of a multibyte character
+	assert.Equal(t, `{"timestamp":1553360693208,"message":"ñand`, raw)
+}
+
+func TestRawMessageTruncatedWithInvalidBytes(t *testing.T) {
+	r := newRawMessage(&RawMessageConfig{Field: "raw", MaxSize: 10})
+	fields := common.MapStr{}
+	// Latin-1 encoded line
+	r.apply(fields, "caf\xe9 con leche\n", nil)
+	assert.Equal(t, "caf\xe9 con l", fields["raw"])
+
+	fields = common.MapStr{}
+	r.apply(fields, "caf\xe9 con \xf1and\xfa\n", nil)
+	assert.Equal(t, "caf\xe9 con \xf1", fields["raw"])
+}
+
+func TestRawMessageOnFailedFields(t *testing.T) {
+	logs := `str1 2016-08-10T22:08:42.945958Z 35325 120 30123 true str2 0.325 0.0318353
+str1 2016-08-10T22:08:42.945958Z 35325 300 30123 true str2 0.325 0.0318353
+str1 2016-08-10T22:08:42.945958Z 35325 120 30123 notbool str2 0.325 0.0318353
+`
+	p, err := WithRawMessage(NewCustomLogParser("time", regexTest).WithKindMap(regexKind), &RawMessageConfig{
+		Field:          "raw",
+		OnFailedFields: []string{"int8"},
+	})
+	assert.NoError(t, err)
+
+	events, errors := parseAll(t, p, logs)
+	// Line 3 fails on a field not tolerated
+	assert.Len(t, errors, 1)
+	assert.Len(t, events, 2)
+	assert.NotContains(t, events[0].Fields, "raw")
+	assert.Equal(t, int8(120), events[0].Fields["int8"])
+	assert.Equal(t, "str1 2016-08-10T22:08:42.945958Z 35325 300 30123 true str2 0.325 0.0318353", events[1].Fields["raw"])
+	assert.NotContains(t, events[1].Fields, "int8")
+}
@@ -0,0 +1,407 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+	"github.com/elastic/beats/libbeat/paths"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+var (
+	archivedS3Objects = monitoring.NewUint(nil, "s3logsbeat.s3objects.archived")
+	restoreRequests   = monitoring.NewUint(nil, "s3logsbeat.s3objects.restoreRequested")
+	restoredS3Objects = monitoring.NewUint(nil, "s3logsbeat.s3objects.restored")
+)
+
+// Options for archived objects action
+const (
+	// ArchivedSkip skips archived objects (only reported)
+	ArchivedSkip = "skip"
+	// ArchivedRestore requests the restore of archived objects and processes them once restored
+	ArchivedRestore = "restore"
+)
+
+// ArchivedObjectsConfig configures what to do with objects stored on Glacier or Glacier Deep Archive
+type ArchivedObjectsConfig struct {
+	Action        string        `config:"action"`
+	Tier          string        `config:"tier"`
+	Days          int           `config:"days" validate:"min=0"`
+	StateFile     string        `config:"state_file"`
+	Wait          bool          `config:"wait"`
+	CheckInterval time.Duration `config:"check_interval" validate:"min=0"`
+}
+
+// Validate validates archived objects config logic
+func (c *ArchivedObjectsConfig) Validate() error {
+	switch c.Action {
+	case "":
+		c.Action = ArchivedSkip
+	case ArchivedSkip, ArchivedRestore:
+	default:
+		return fmt.Errorf("Invalid archived objects action %s. Options: %s, %s", c.Action, ArchivedSkip, ArchivedRestore)
+	}
+	switch c.Tier {
+	case "":
+		c.Tier = "Bulk"
+	case "Bulk", "Standard", "Expedited":
+	default:
+		return fmt.Errorf("Invalid restore tier %s. Options: Bulk, Standard, Expedited", c.Tier)
+	}
+	if c.Days == 0 {
+		c.Days = 7
+	}
+	if c.StateFile == "" {
+		c.StateFile = "restores.json"
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = 15 * time.Minute
+	}
+	return nil
+}
+
+// ArchiveStorage storage whose objects can be archived and restored. aws.S3 implements it
+type ArchiveStorage interface {
+	// RestoreStatus obtains the status of the restore of o
+	RestoreStatus(o *aws.S3Object) (aws.RestoreStatus, error)
+
+	// RestoreObject requests a temporary copy of archived object o
+	RestoreObject(o *aws.S3Object, days int, tier string) error
+}
+
+// ArchivedObjects handles objects stored on an archive storage class found when listing.
+// A nil value skips them
+type ArchivedObjects struct {
+	config *ArchivedObjectsConfig
+	state  *restoreState
+}
+
+// NewArchivedObjects creates the handler of archived objects. When objects are restored,
+// pending restores are loaded from (and persisted on) config.StateFile, relative to data path
+func NewArchivedObjects(config *ArchivedObjectsConfig) (*ArchivedObjects, error) {
+	a := &ArchivedObjects{
+		config: config,
+	}
+	if config.Action == ArchivedRestore {
+		var err error
+		a.state, err = getRestoreState(paths.Resolve(paths.Data, config.StateFile))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func (a *ArchivedObjects) restoring() bool {
+	return a != nil && a.state != nil
+}
+
+// onArchived handles archived object o found when listing. Returns whether o can be read
+// (its restored copy is available)
+func (a *ArchivedObjects) onArchived(storage ArchiveStorage, o *aws.S3Object) bool {
+	archivedS3Objects.Add(1)
+	if !a.restoring() || storage == nil {
+		logp.Warn("Skipping archived S3 object %s (storage class %s)", o.String(), o.StorageClass)
+		return false
+	}
+	if a.state.has(o) {
+		// Pending restores are checked before listing
+		return false
+	}
+
+	status, err := storage.RestoreStatus(o)
+	if err != nil {
+		logp.Err("Could not obtain restore status of S3 object %s. Error: %v", o.String(), err)
+		return false
+	}
+	switch status {
+	case aws.Restored:
+		restoredS3Objects.Add(1)
+		return true
+	case aws.RestoreNotRequested:
+		tier := a.tier(o)
+		if err := storage.RestoreObject(o, a.config.Days, tier); err != nil {
+			logp.Err("Could not restore S3 object %s. Error: %v", o.String(), err)
+			return false
+		}
+		logp.Debug("s3logsbeat", "Requested restore of S3 object %s with tier %s", o.String(), tier)
+		restoreRequests.Add(1)
+	}
+	a.state.add(o)
+	return false
+}
+
+// tier obtains the restore tier of o. Glacier Deep Archive does not support Expedited restores,
+// so Standard is used instead
+func (a *ArchivedObjects) tier(o *aws.S3Object) string {
+	if a.config.Tier == "Expedited" && o.StorageClass == "DEEP_ARCHIVE" {
+		return "Standard"
+	}
+	return a.config.Tier
+}
+
+// processRestored passes to oh those pending restores present on prefix which have already been
+// restored and are not being processed yet. They are kept on pending restores until they are processed
+// (see restoredNotifications). Returns the number of restores still pending
+func (a *ArchivedObjects) processRestored(storage ArchiveStorage, prefix *aws.S3Object, oh func(o *aws.S3Object) error) (int, error) {
+	pending := 0
+	for _, o := range a.state.under(prefix) {
+		if a.state.processing(o) {
+			continue
+		}
+		status, err := storage.RestoreStatus(o)
+		if err != nil {
+			logp.Err("Could not obtain restore status of S3 object %s. Error: %v", o.String(), err)
+			pending++
+			continue
+		}
+		switch status {
+		case aws.Restored:
+			a.state.setProcessing(o, true)
+			if err := oh(o); err != nil {
+				a.state.setProcessing(o, false)
+				return pending, err
+			}
+			restoredS3Objects.Add(1)
+		case aws.RestoreNotRequested:
+			// Restored copy expired before being processed
+			logp.Warn("Restored copy of S3 object %s expired before being processed. Requesting it again", o.String())
+			if err := storage.RestoreObject(o, a.config.Days, a.tier(o)); err != nil {
+				logp.Err("Could not restore S3 object %s. Error: %v", o.String(), err)
+			} else {
+				restoreRequests.Add(1)
+			}
+			pending++
+		default:
+			pending++
+		}
+	}
+	return pending, a.state.save()
+}
+
+// restoredNotifications notifications of a restored object which remove it from pending restores
+// once it has been read and all its events acked. If it could not be read, it is kept to be processed
+// again on next runs
+type restoredNotifications struct {
+	S3ObjectProcessNotifications
+	archived  *ArchivedObjects
+	object    *aws.S3Object
+	mutex     sync.Mutex
+	events    uint64
+	processed bool
+	failed    bool
+}
+
+// restoredNotifications obtains the notifications of restored object o, wrapping notifications
+func (a *ArchivedObjects) restoredNotifications(o *aws.S3Object, notifications S3ObjectProcessNotifications) S3ObjectProcessNotifications {
+	return &restoredNotifications{
+		S3ObjectProcessNotifications: notifications,
+		archived:                     a,
+		object:                       o,
+	}
+}
+
+// EventSent counts the events pending to be acked
+func (n *restoredNotifications) EventSent() {
+	n.mutex.Lock()
+	n.events++
+	n.mutex.Unlock()
+	n.S3ObjectProcessNotifications.EventSent()
+}
+
+// EventACKed completes the restore once the object has been read and all its events acked
+func (n *restoredNotifications) EventACKed() {
+	n.mutex.Lock()
+	n.events--
+	n.completeIfDone()
+	n.mutex.Unlock()
+	n.S3ObjectProcessNotifications.EventACKed()
+}
+
+// S3ObjectFailed keeps the object on pending restores
+func (n *restoredNotifications) S3ObjectFailed(err error) {
+	n.mutex.Lock()
+	n.failed = true
+	n.mutex.Unlock()
+	if f, ok := n.S3ObjectProcessNotifications.(S3ObjectFailureNotifications); ok {
+		f.S3ObjectFailed(err)
+	}
+}
+
+// S3ObjectProcessed completes the restore if all events of the object have been acked
+func (n *restoredNotifications) S3ObjectProcessed() {
+	n.mutex.Lock()
+	n.processed = true
+	n.completeIfDone()
+	n.mutex.Unlock()
+	n.S3ObjectProcessNotifications.S3ObjectProcessed()
+}
+
+func (n *restoredNotifications) completeIfDone() {
+	if !n.processed || n.events > 0 {
+		return
+	}
+	state := n.archived.state
+	if n.failed {
+		logp.Warn("Restored S3 object %s could not be read. It is kept on pending restores to be processed again", n.object.String())
+		state.setProcessing(n.object, false)
+		return
+	}
+	state.remove(n.object)
+	if err := state.save(); err != nil {
+		logp.Err("Could not persist pending restores on %s. Error: %v", state.path, err)
+	}
+}
+
+// pendingRestore restore requested and not processed yet
+type pendingRestore struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	StorageClass string    `json:"storage_class"`
+	RequestedAt  time.Time `json:"requested_at"`
+
+	// Restored copy being processed (not persisted, so it is processed again after a restart)
+	processing bool
+}
+
+// restoreState pending restores persisted on a file, shared by all inputs using the same file
+type restoreState struct {
+	mutex   sync.Mutex
+	path    string
+	pending map[string]*pendingRestore
+}
+
+var restoreStates = struct {
+	sync.Mutex
+	m map[string]*restoreState
+}{m: map[string]*restoreState{}}
+
+// getRestoreState obtains the restore state persisted on path, loading it if needed
+func getRestoreState(path string) (*restoreState, error) {
+	restoreStates.Lock()
+	defer restoreStates.Unlock()
+	if s, ok := restoreStates.m[path]; ok {
+		return s, nil
+	}
+
+	s := &restoreState{
+		path:    path,
+		pending: map[string]*pendingRestore{},
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var pending []*pendingRestore
+		if err := json.Unmarshal(content, &pending); err != nil {
+			return nil, fmt.Errorf("Could not parse pending restores from %s: %v", path, err)
+		}
+		for _, p := range pending {
+			s.pending[p.Bucket+"/"+p.Key] = p
+		}
+		logp.Info("Loaded %d pending restores from %s", len(pending), path)
+	}
+	restoreStates.m[path] = s
+	return s, nil
+}
+
+func (s *restoreState) has(o *aws.S3Object) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.pending[o.Bucket+"/"+o.Key]
+	return ok
+}
+
+func (s *restoreState) add(o *aws.S3Object) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending[o.Bucket+"/"+o.Key] = &pendingRestore{
+		Bucket:       o.Bucket,
+		Key:          o.Key,
+		Size:         o.Size,
+		ETag:         o.ETag,
+		LastModified: o.LastModified,
+		StorageClass: o.StorageClass,
+		RequestedAt:  time.Now().UTC(),
+	}
+}
+
+// processing returns whether the restored copy of o is being processed
+func (s *restoreState) processing(o *aws.S3Object) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p, ok := s.pending[o.Bucket+"/"+o.Key]
+	return ok && p.processing
+}
+
+func (s *restoreState) setProcessing(o *aws.S3Object, processing bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if p, ok := s.pending[o.Bucket+"/"+o.Key]; ok {
+		p.processing = processing
+	}
+}
+
+func (s *restoreState) remove(o *aws.S3Object) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pending, o.Bucket+"/"+o.Key)
+}
+
+// under obtains pending restores present on prefix.Bucket and whose key starts with prefix.Key
+func (s *restoreState) under(prefix *aws.S3Object) []*aws.S3Object {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var r []*aws.S3Object
+	for _, p := range s.pending {
+		if p.Bucket == prefix.Bucket && strings.HasPrefix(p.Key, prefix.Key) {
+			o := aws.NewS3Object(p.Bucket, p.Key)
+			o.Size = p.Size
+			o.SizeKnown = true
+			o.ETag = p.ETag
+			o.LastModified = p.LastModified
+			o.StorageClass = p.StorageClass
+			r = append(r, o)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Key < r[j].Key })
+	return r
+}
+
+// save persists pending restores (atomically, writing a temporary file first)
+func (s *restoreState) save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pending := make([]*pendingRestore, 0, len(s.pending))
+	for _, p := range s.pending {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Bucket+"/"+pending[i].Key < pending[j].Bucket+"/"+pending[j].Key
+	})
+	content, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+	tmp := s.path + ".new"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,250 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+// archiveStorage fake storage with archived objects
+type archiveStorage struct {
+	mutex    sync.Mutex
+	objects  []*s3.Object
+	status   map[string]aws.RestoreStatus
+	restores []string
+	tiers    map[string]string
+}
+
+func (s *archiveStorage) GetReadCloser(o *aws.S3Object) (io.ReadCloser, error) {
+	return ioutil.NopCloser(nil), nil
+}
+
+func (s *archiveStorage) ListObjects(o *aws.S3Object, oh aws.S3ObjectHandler) (int, error) {
+	for _, r := range s.objects {
+		if err := oh(aws.NewS3ObjectWithOriginal(o.Bucket, r)); err != nil {
+			return 0, err
+		}
+	}
+	return len(s.objects), nil
+}
+
+func (s *archiveStorage) RestoreStatus(o *aws.S3Object) (aws.RestoreStatus, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status[o.Key], nil
+}
+
+func (s *archiveStorage) RestoreObject(o *aws.S3Object, days int, tier string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.restores = append(s.restores, o.Key)
+	s.tiers[o.Key] = tier
+	s.status[o.Key] = aws.RestoreOngoing
+	return nil
+}
+
+func (s *archiveStorage) setStatus(key string, status aws.RestoreStatus) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status[key] = status
+}
+
+func newTestArchiveStorage() *archiveStorage {
+	newObject := func(key, storageClass string) *s3.Object {
+		return &s3.Object{
+			Key:          awssdk.String(key),
+			Size:         awssdk.Int64(10),
+			LastModified: awssdk.Time(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)),
+			StorageClass: awssdk.String(storageClass),
+		}
+	}
+	return &archiveStorage{
+		objects: []*s3.Object{
+			newObject("logs/a.log", "STANDARD"),
+			newObject("logs/b.log", "GLACIER"),
+			newObject("logs/c.log", "DEEP_ARCHIVE"),
+		},
+		status: map[string]aws.RestoreStatus{
+			"logs/c.log": aws.Restored,
+		},
+		tiers: map[string]string{},
+	}
+}
+
+type nopEventCounter struct{}
+
+func (nopEventCounter) Add(n int)      {}
+func (nopEventCounter) Done()          {}
+func (nopEventCounter) Error(n uint64) {}
+
+// listObjects lists storage using ri and returns the objects sent to be read
+func listObjects(storage ObjectStorage, ri *S3ReaderInformation) []*S3Object {
+	out := make(chan *S3Object, 10)
+	w := NewS3ListerWorker(nil, out, nopEventCounter{})
+	w.onS3List(0, NewS3ListFromStorage(storage, aws.NewS3Object("mybucket", "logs/"), ri, time.Time{}, time.Now()))
+	close(out)
+	var objects []*S3Object
+	for o := range out {
+		objects = append(objects, o)
+	}
+	return objects
+}
+
+// listKeys lists storage using ri and returns the keys of the objects sent to be read
+func listKeys(storage ObjectStorage, ri *S3ReaderInformation) []string {
+	var keys []string
+	for _, o := range listObjects(storage, ri) {
+		keys = append(keys, o.Key)
+	}
+	return keys
+}
+
+func newTestRestoringReaderInformation(t *testing.T, dir string) (*S3ReaderInformation, *ArchivedObjects, *ArchivedObjectsConfig) {
+	config := &ArchivedObjectsConfig{Action: ArchivedRestore, StateFile: filepath.Join(dir, "restores.json")}
+	assert.NoError(t, config.Validate())
+	archivedObjects, err := NewArchivedObjects(config)
+	assert.NoError(t, err)
+	return NewS3ReaderInformation(nil, nil, "alb").WithArchivedObjects(archivedObjects), archivedObjects, config
+}
+
+func TestArchivedObjectsSkippedByDefault(t *testing.T) {
+	storage := newTestArchiveStorage()
+	archived := archivedS3Objects.Get()
+
+	keys := listKeys(storage, NewS3ReaderInformation(nil, nil, "alb"))
+	assert.Equal(t, []string{"logs/a.log"}, keys)
+	assert.Equal(t, archived+2, archivedS3Objects.Get())
+	assert.Empty(t, storage.restores)
+}
+
+func TestArchivedObjectsRestored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-restores")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ri, archivedObjects, config := newTestRestoringReaderInformation(t, dir)
+
+	// b is restored while c (already restored) is read
+	storage := newTestArchiveStorage()
+	keys := listKeys(storage, ri)
+	assert.Equal(t, []string{"logs/a.log", "logs/c.log"}, keys)
+	assert.Equal(t, []string{"logs/b.log"}, storage.restores)
+
+	// Pending restores are persisted
+	pending, err := ioutil.ReadFile(config.StateFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(pending), `"key": "logs/b.log"`)
+
+	// Restore is not requested again while ongoing
+	keys = listKeys(storage, ri)
+	assert.Equal(t, []string{"logs/a.log", "logs/c.log"}, keys)
+	assert.Equal(t, []string{"logs/b.log"}, storage.restores)
+
+	// Once restored, b is read only once
+	storage.setStatus("logs/b.log", aws.Restored)
+	objects := listObjects(storage, ri)
+	if !assert.Len(t, objects, 3) {
+		return
+	}
+	assert.Equal(t, "logs/b.log", objects[0].Key)
+	assert.Equal(t, []string{"logs/a.log", "logs/c.log"}, listKeys(storage, ri))
+
+	// b is kept on pending restores until it is read and its events acked
+	notifications := objects[0].s3ObjectProcessNotifications
+	notifications.EventSent()
+	notifications.S3ObjectProcessed()
+	assert.Len(t, archivedObjects.state.under(aws.NewS3Object("mybucket", "")), 1)
+	notifications.EventACKed()
+	assert.Empty(t, archivedObjects.state.under(aws.NewS3Object("mybucket", "")))
+	pending, err = ioutil.ReadFile(config.StateFile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(pending), `"key": "logs/b.log"`)
+}
+
+func TestArchivedObjectsRestoredWithSupportedTier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-restores")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := &ArchivedObjectsConfig{Action: ArchivedRestore, Tier: "Expedited", StateFile: filepath.Join(dir, "restores.json")}
+	assert.NoError(t, config.Validate())
+	archivedObjects, err := NewArchivedObjects(config)
+	assert.NoError(t, err)
+	ri := NewS3ReaderInformation(nil, nil, "alb").WithArchivedObjects(archivedObjects)
+
+	// Deep Archive objects are restored with Standard tier, as Expedited is not supported
+	storage := newTestArchiveStorage()
+	storage.setStatus("logs/c.log", aws.RestoreNotRequested)
+	assert.Equal(t, []string{"logs/a.log"}, listKeys(storage, ri))
+	assert.Equal(t, map[string]string{"logs/b.log": "Expedited", "logs/c.log": "Standard"}, storage.tiers)
+
+	// Also when restored copies expire before being processed
+	storage.setStatus("logs/c.log", aws.RestoreNotRequested)
+	storage.tiers = map[string]string{}
+	pending, err := archivedObjects.processRestored(storage, aws.NewS3Object("mybucket", "logs/"), func(o *aws.S3Object) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pending)
+	assert.Equal(t, map[string]string{"logs/c.log": "Standard"}, storage.tiers)
+}
+
+func TestArchivedObjectsRestoredKeptOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-restores")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ri, archivedObjects, _ := newTestRestoringReaderInformation(t, dir)
+
+	storage := newTestArchiveStorage()
+	listKeys(storage, ri)
+	storage.setStatus("logs/b.log", aws.Restored)
+	objects := listObjects(storage, ri)
+	if !assert.Len(t, objects, 3) {
+		return
+	}
+	assert.Equal(t, "logs/b.log", objects[0].Key)
+
+	// b could not be read, so it is processed again on next run
+	objects[0].failed(errors.New("connection reset"))
+	objects[0].s3ObjectProcessNotifications.S3ObjectProcessed()
+	assert.Len(t, archivedObjects.state.under(aws.NewS3Object("mybucket", "")), 1)
+	assert.Equal(t, []string{"logs/b.log", "logs/a.log", "logs/c.log"}, listKeys(storage, ri))
+}
+
+func TestRestoreStateLoaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3logsbeat-restores")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "restores.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"bucket":"mybucket","key":"logs/b.log","size":10}]`), 0600))
+
+	state, err := getRestoreState(path)
+	assert.NoError(t, err)
+	assert.True(t, state.has(aws.NewS3Object("mybucket", "logs/b.log")))
+	assert.Len(t, state.under(aws.NewS3Object("mybucket", "logs/")), 1)
+	assert.Empty(t, state.under(aws.NewS3Object("mybucket", "other/")))
+	assert.Empty(t, state.under(aws.NewS3Object("otherbucket", "")))
+}
+
+func TestArchivedObjectsConfigValidate(t *testing.T) {
+	config := &ArchivedObjectsConfig{}
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, ArchivedSkip, config.Action)
+	assert.Equal(t, "Bulk", config.Tier)
+	assert.Equal(t, 7, config.Days)
+
+	assert.Error(t, (&ArchivedObjectsConfig{Action: "ignore"}).Validate())
+	assert.Error(t, (&ArchivedObjectsConfig{Tier: "Fast"}).Validate())
+}
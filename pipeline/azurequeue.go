@@ -0,0 +1,28 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/sequra/s3logsbeat/azure"
+)
+
+// AzureQueue Azure Storage Queue element to send thru pipeline
+type AzureQueue struct {
+	*azure.Queue
+	*S3ReaderInformation
+}
+
+// NewAzureQueue creates a new Azure Storage Queue to be sent thru pipeline
+func NewAzureQueue(queue *azure.Queue, ri *S3ReaderInformation) *AzureQueue {
+	return &AzureQueue{
+		Queue:               queue,
+		S3ReaderInformation: ri,
+	}
+}
+
+// Poll receives messages from Azure Storage Queue. Receives return immediately, so they are not cancelled by ctx
+func (q *AzureQueue) Poll(ctx context.Context, keepOnCompleted bool, mh func(QueueMessage) error) (int, bool, error) {
+	return q.ReceiveMessages(func(message *azure.QueueMessage) error {
+		return mh(NewAzureQueueMessage(q, message, keepOnCompleted))
+	})
+}
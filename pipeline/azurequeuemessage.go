@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/sequra/s3logsbeat/azure"
+)
+
+// AzureQueueMessage Azure Storage Queue message to be passed thru pipeline.
+// As with SQS messages, we have to keep how much objects and how much events
+// are generated from this message in order to delete it once it finishes.
+// While objects are processed, the message is kept invisible to other consumers
+// extending its visibility timeout. If any blob could not be read, the message is
+// not deleted, so it is received again once its visibility timeout expires
+type AzureQueueMessage struct {
+	*azure.QueueMessage
+	*completionTracker
+
+	queue         *AzureQueue
+	keptInvisible bool
+	// receiptMutex protects the pop receipt, renewed by the visibility heartbeat while the message is processed
+	receiptMutex sync.Mutex
+}
+
+// NewAzureQueueMessage creates an Azure Storage Queue message received from queue
+func NewAzureQueueMessage(queue *AzureQueue, message *azure.QueueMessage, keepOnCompleted bool) *AzureQueueMessage {
+	m := &AzureQueueMessage{
+		QueueMessage: message,
+		queue:        queue,
+	}
+	m.completionTracker = newCompletionTracker(fmt.Sprintf("Azure queue message with ID %s", message.MessageID), keepOnCompleted, m.delete)
+	return m
+}
+
+// delete deletes the message from queue if all its blobs have been read
+func (m *AzureQueueMessage) delete(failures []string) {
+	if len(failures) > 0 {
+		logp.Warn("%d blobs present on Azure queue message with ID %s could not be read. Not deleting it, so it is received again (dequeued %d times)", len(failures), m.MessageID, m.DequeueCount)
+		return
+	}
+	logp.Debug("s3logsbeat", "Deleting Azure queue message with ID %s because it has been fully processed", m.MessageID)
+	m.receiptMutex.Lock()
+	defer m.receiptMutex.Unlock()
+	if err := m.queue.DeleteMessage(m.MessageID, m.PopReceipt); err != nil {
+		logp.Err("Couldn't delete Azure queue message with ID %s. Error: %v", m.MessageID, err)
+	}
+}
+
+// keepInvisible extends the visibility timeout of the message each half of it until the message
+// is deleted. Each extension renews the pop receipt used to delete the message. It is started once,
+// before the first blob of the message is passed
+func (m *AzureQueueMessage) keepInvisible() {
+	interval := m.queue.VisibilityTimeout() / 2
+	if interval <= 0 || m.keptInvisible {
+		return
+	}
+	m.keptInvisible = true
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.completed:
+				return
+			case <-ticker.C:
+				m.extendVisibility()
+			}
+		}
+	}()
+}
+
+func (m *AzureQueueMessage) extendVisibility() {
+	m.receiptMutex.Lock()
+	defer m.receiptMutex.Unlock()
+	select {
+	case <-m.completed:
+		return
+	default:
+	}
+	popReceipt, err := m.queue.ExtendVisibility(m.MessageID, m.PopReceipt)
+	if err != nil {
+		logp.Warn("Couldn't extend visibility of Azure queue message with ID %s. Error: %v", m.MessageID, err)
+		return
+	}
+	logp.Debug("s3logsbeat", "Extended visibility of Azure queue message with ID %s", m.MessageID)
+	m.PopReceipt = popReceipt
+}
+
+// ExtractNewS3Objects extracts the new blobs notified on an Azure queue message
+func (m *AzureQueueMessage) ExtractNewS3Objects(mh func(s3object *S3Object) error) error {
+	// Message is kept invisible before blobs are passed, as passing them can block until they are read
+	return m.extractNewS3Objects(m.queue.S3ReaderInformation, m.ExtractNewObjects, func(o *S3Object) error {
+		m.keepInvisible()
+		return mh(o)
+	})
+}
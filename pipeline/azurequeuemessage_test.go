@@ -0,0 +1,160 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sequra/s3logsbeat/azure"
+	"github.com/stretchr/testify/assert"
+)
+
+const blobCreatedMessage = `{"subject":"/blobServices/default/containers/logs/blobs/app/a.log","eventType":"Microsoft.Storage.BlobCreated","data":{"contentLength":10}}`
+
+// azureQueueRequests records requests done to a queue, renewing pop receipts on each update
+type azureQueueRequests struct {
+	mutex    sync.Mutex
+	updates  int
+	deletes  []string
+	receipts []string
+}
+
+func (a *azureQueueRequests) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	switch r.Method {
+	case "PUT":
+		a.updates++
+		a.receipts = append(a.receipts, r.URL.Query().Get("popreceipt"))
+		w.Header().Set("x-ms-popreceipt", "renewed")
+	case "DELETE":
+		a.deletes = append(a.deletes, r.URL.Query().Get("popreceipt"))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *azureQueueRequests) get() (int, []string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.updates, append([]string{}, a.deletes...)
+}
+
+func newTestAzureQueue(t *testing.T, visibilityTimeout time.Duration) (*AzureQueue, *azureQueueRequests, func()) {
+	requests := &azureQueueRequests{}
+	server := httptest.NewServer(requests)
+	account, err := azure.NewAccount(&azure.Config{
+		AccountName:   "devstoreaccount1",
+		SASToken:      "sig=abc",
+		QueueEndpoint: server.URL + "/devstoreaccount1",
+	})
+	assert.NoError(t, err)
+	queue := NewAzureQueue(azure.NewQueue(account, "logs", visibilityTimeout), &S3ReaderInformation{})
+	return queue, requests, server.Close
+}
+
+func TestAzureQueueMessageDeletedWhenCompleted(t *testing.T) {
+	queue, requests, close := newTestAzureQueue(t, 100*time.Millisecond)
+	defer close()
+
+	m := NewAzureQueueMessage(queue, &azure.QueueMessage{MessageID: "m1", PopReceipt: "r1", MessageText: blobCreatedMessage}, false)
+	deleted := false
+	m.OnDelete(func() { deleted = true })
+
+	var objects []*S3Object
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		objects = append(objects, o)
+		return nil
+	}))
+	if !assert.Len(t, objects, 1) {
+		return
+	}
+	assert.Equal(t, "logs", objects[0].Bucket)
+	assert.Equal(t, "app/a.log", objects[0].Key)
+
+	m.EventSent()
+	m.S3ObjectProcessed()
+
+	// Visibility is extended while events are pending to be ACKed
+	deadline := time.Now().Add(5 * time.Second)
+	for updates, _ := requests.get(); updates == 0 && time.Now().Before(deadline); updates, _ = requests.get() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	updates, deletes := requests.get()
+	assert.NotZero(t, updates)
+	assert.Empty(t, deletes)
+	assert.False(t, deleted)
+
+	// Message is deleted with the last pop receipt once all events are ACKed
+	m.EventACKed()
+	_, deletes = requests.get()
+	assert.Equal(t, []string{"renewed"}, deletes)
+	assert.True(t, deleted)
+	assert.Equal(t, "r1", requests.receipts[0])
+
+	// Visibility is not extended anymore
+	updates, _ = requests.get()
+	time.Sleep(150 * time.Millisecond)
+	updatesAfterDelete, _ := requests.get()
+	assert.Equal(t, updates, updatesAfterDelete)
+}
+
+func TestAzureQueueMessageVisibilityExtendedWhileBlobsArePassed(t *testing.T) {
+	queue, requests, close := newTestAzureQueue(t, 100*time.Millisecond)
+	defer close()
+
+	m := NewAzureQueueMessage(queue, &azure.QueueMessage{MessageID: "m1", PopReceipt: "r1", MessageText: blobCreatedMessage}, false)
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		// Passing the blob blocks longer than the visibility timeout
+		time.Sleep(300 * time.Millisecond)
+		updates, _ := requests.get()
+		assert.NotZero(t, updates)
+		return nil
+	}))
+
+	m.S3ObjectProcessed()
+	_, deletes := requests.get()
+	assert.Equal(t, []string{"renewed"}, deletes)
+}
+
+func TestAzureQueueMessageDeletedWhenNoObjects(t *testing.T) {
+	queue, requests, close := newTestAzureQueue(t, time.Minute)
+	defer close()
+
+	m := NewAzureQueueMessage(queue, &azure.QueueMessage{MessageID: "m1", PopReceipt: "r1", MessageText: strings.Replace(blobCreatedMessage, "BlobCreated", "BlobDeleted", 1)}, false)
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		t.Fatal("No object expected")
+		return nil
+	}))
+	_, deletes := requests.get()
+	assert.Equal(t, []string{"r1"}, deletes)
+}
+
+func TestAzureQueueMessageNotDeletedWhenFailed(t *testing.T) {
+	queue, requests, close := newTestAzureQueue(t, time.Minute)
+	defer close()
+
+	m := NewAzureQueueMessage(queue, &azure.QueueMessage{MessageID: "m1", PopReceipt: "r1", MessageText: blobCreatedMessage}, false)
+	deleted := false
+	m.OnDelete(func() { deleted = true })
+	var objects []*S3Object
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		objects = append(objects, o)
+		return nil
+	}))
+	if !assert.Len(t, objects, 1) {
+		return
+	}
+	objects[0].failed(errors.New("access denied"))
+	m.S3ObjectProcessed()
+
+	// Message is released (so it is received again) but not deleted
+	assert.True(t, deleted)
+	_, deletes := requests.get()
+	assert.Empty(t, deletes)
+}
@@ -3,7 +3,7 @@ package pipeline
 import "sync"
 
 const (
-	maxSQSChanCapacity    = 5
+	maxQueueChanCapacity  = 5
 	maxS3ListChanCapacity = 5
 	maxS3ObjectsCapacity  = 10
 )
@@ -31,7 +31,7 @@ func (c *baseChannels) CloseS3Channel() {
 // Channels Pipeline channels
 type Channels struct {
 	baseChannels
-	sqsChannel chan *SQS
+	queueChannel chan Queue
 }
 
 // NewChannels creates a new pipeline channels object
@@ -40,22 +40,22 @@ func NewChannels() *Channels {
 		baseChannels: baseChannels{
 			s3Channel: make(chan *S3Object, maxS3ObjectsCapacity),
 		},
-		sqsChannel: make(chan *SQS, maxSQSChanCapacity),
+		queueChannel: make(chan Queue, maxQueueChanCapacity),
 	}
 }
 
-// GetSQSChannel gets SQS channel
-func (c *Channels) GetSQSChannel() chan *SQS {
-	return c.sqsChannel
+// GetQueueChannel gets queue (SQS and Pub/Sub) channel
+func (c *Channels) GetQueueChannel() chan Queue {
+	return c.queueChannel
 }
 
-// CloseSQSChannel closes SQS channel
-func (c *Channels) CloseSQSChannel() {
+// CloseQueueChannel closes queue channel
+func (c *Channels) CloseQueueChannel() {
 	c.m.Lock()
 	defer c.m.Unlock()
-	if c.sqsChannel != nil {
-		close(c.sqsChannel)
-		c.sqsChannel = nil
+	if c.queueChannel != nil {
+		close(c.queueChannel)
+		c.queueChannel = nil
 	}
 }
 
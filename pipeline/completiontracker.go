@@ -0,0 +1,156 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+// completionTracker keeps how much S3 objects and how much events are generated from a queue message
+// in order to complete it (e.g. deleting it from queue) once all its S3 objects have been processed and
+// all its events have been ACKed. It is embedded by queue messages, which provide how they are completed.
+// Reasons of S3 objects which could not be read are kept, so messages can be retried instead of removed
+type completionTracker struct {
+	name            string
+	mutex           *sync.Mutex
+	s3objects       uint64
+	events          uint64
+	extracting      bool
+	keepOnCompleted bool
+	completed       chan struct{}
+	failures        []string
+	onCompleted     func(failures []string)
+
+	// Events
+	onDeleteCallbacks []func()
+}
+
+// newCompletionTracker creates the tracker of the message identified by name, executing onCompleted
+// with the failure reasons (if any) once completed, unless the message must be kept on queue
+func newCompletionTracker(name string, keepOnCompleted bool, onCompleted func(failures []string)) *completionTracker {
+	return &completionTracker{
+		name:            name,
+		mutex:           &sync.Mutex{},
+		keepOnCompleted: keepOnCompleted,
+		completed:       make(chan struct{}),
+		onCompleted:     onCompleted,
+	}
+}
+
+// Events
+
+// OnDelete adds callback for OnDelete event (executed once message is completed)
+func (t *completionTracker) OnDelete(f func()) {
+	t.onDeleteCallbacks = append(t.onDeleteCallbacks, f)
+}
+
+func (t *completionTracker) completeOnJobCompleted() {
+	if !t.extracting && t.s3objects == 0 && t.events == 0 {
+		t.complete()
+	}
+}
+
+// complete finishes the process of the message. Must be executed on the mutex
+func (t *completionTracker) complete() {
+	close(t.completed)
+	if !t.keepOnCompleted {
+		t.onCompleted(t.failures)
+	}
+	for _, c := range t.onDeleteCallbacks {
+		c()
+	}
+}
+
+// fail completes the message as failed because of err, before any S3 object is extracted from it
+func (t *completionTracker) fail(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.failures = append(t.failures, err.Error())
+	t.complete()
+}
+
+// extractNewS3Objects passes to mh the S3 objects obtained with extract which are not filtered by ri.
+// If no S3 object is passed, the message is completed.
+// The message can not be completed while extracting to avoid the following case:
+// Time 0 -> Goroutine A (GA) : executes ExtractNewS3Objects with first S3 element and keeps on the loop
+// Time 1 -> Goroutine B (GB) : downloads S3 object and is empty. It executes DeleteOnJobCompleted and deletes SQS message
+// Time 2 -> app crashes
+// Problem: as SQS message has already been deleted, it can not be processed again
+// The mutex is not held while passing S3 objects to mh, as it can block until they are read (and readers
+// notify their progress on the mutex). If extraction fails, the message is never completed, so it is
+// delivered again
+func (t *completionTracker) extractNewS3Objects(ri *S3ReaderInformation, extract func(func(*aws.S3Object) error) (uint64, error), mh func(s3object *S3Object) error) error {
+	t.mutex.Lock()
+	t.extracting = true
+	t.mutex.Unlock()
+
+	var c uint64
+	extracted, err := extract(func(o *aws.S3Object) error {
+		if !ri.filterS3Object(o) {
+			return nil
+		}
+		c++
+		t.mutex.Lock()
+		t.s3objects++
+		t.mutex.Unlock()
+		return mh(NewS3Object(o, ri, t))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.extracting = false
+	if c == 0 {
+		if extracted == 0 {
+			logp.Debug("s3logsbeat", "No S3 objects extracted from %s", t.name)
+		} else {
+			logp.Debug("s3logsbeat", "All S3 objects present on %s have been skipped", t.name)
+		}
+		t.complete()
+	} else {
+		t.completeOnJobCompleted()
+	}
+	return nil
+}
+
+// S3ObjectProcessNotifications implementations
+
+// S3ObjectFailed keeps the reason of an S3 object which could not be read, so message is not removed
+func (t *completionTracker) S3ObjectFailed(err error) {
+	t.mutex.Lock()
+	t.failures = append(t.failures, err.Error())
+	t.mutex.Unlock()
+}
+
+// S3ObjectProcessed reduces the number of pending S3 objects to process and completes message if done
+func (t *completionTracker) S3ObjectProcessed() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.s3objects--
+	t.completeOnJobCompleted()
+}
+
+// EventSent adds the number of events to the counter (to know the number of events pending to ACK)
+func (t *completionTracker) EventSent() {
+	t.mutex.Lock()
+	t.events++
+	t.mutex.Unlock()
+}
+
+// EventACKed reduces the number of events to the counter (to know the number of events pending to ACK).
+// If all events have been processed, the message is completed.
+func (t *completionTracker) EventACKed() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.events == 0 {
+		panic(fmt.Sprintf("Acked more events than added on %s", t.name))
+	}
+	t.events--
+	t.completeOnJobCompleted()
+}
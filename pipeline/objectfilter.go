@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/elastic/beats/libbeat/common/cfgtype"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+var (
+	skippedS3Objects = monitoring.NewUint(nil, "s3logsbeat.s3objects.skipped")
+)
+
+// ObjectFilterConfig configures which S3 objects are processed, based on their key, their size
+// and the event which notified them
+type ObjectFilterConfig struct {
+	IncludeKeys []*regexp.Regexp `config:"include_keys"`
+	ExcludeKeys []*regexp.Regexp `config:"exclude_keys"`
+	MinSize     cfgtype.ByteSize `config:"min_size"`
+	MaxSize     cfgtype.ByteSize `config:"max_size"`
+	EventNames  []string         `config:"event_names"`
+}
+
+// DefaultEventNames event names processed if no one is configured
+var DefaultEventNames = []string{"ObjectCreated:*"}
+
+// Validate validates object filter config logic
+func (c *ObjectFilterConfig) Validate() error {
+	if c.MaxSize > 0 && c.MinSize > c.MaxSize {
+		return fmt.Errorf("min_size (%d) can not be greater than max_size (%d)", c.MinSize, c.MaxSize)
+	}
+	for _, n := range c.EventNames {
+		if _, err := path.Match(n, ""); err != nil {
+			return fmt.Errorf("Invalid event name pattern %s: %v", n, err)
+		}
+	}
+	return nil
+}
+
+// accept returns whether o has to be processed. If not, the reason is returned
+func (c *ObjectFilterConfig) accept(o *aws.S3Object) (bool, string) {
+	if len(c.IncludeKeys) > 0 && !matchAny(c.IncludeKeys, o.Key) {
+		return false, "key does not match include_keys"
+	}
+	if matchAny(c.ExcludeKeys, o.Key) {
+		return false, "key matches exclude_keys"
+	}
+	// Objects notified without their size (e.g. by CloudTrail) are not filtered by size
+	if o.SizeKnown && o.Size < int64(c.MinSize) {
+		return false, fmt.Sprintf("size %d is lower than min_size", o.Size)
+	}
+	if o.SizeKnown && c.MaxSize > 0 && o.Size > int64(c.MaxSize) {
+		return false, fmt.Sprintf("size %d is greater than max_size", o.Size)
+	}
+	// Listed objects have not been notified by any event
+	if o.EventName != "" && !c.matchEventName(o.EventName) {
+		return false, fmt.Sprintf("event %s does not match event_names", o.EventName)
+	}
+	return true, ""
+}
+
+func (c *ObjectFilterConfig) matchEventName(name string) bool {
+	eventNames := c.EventNames
+	if len(eventNames) == 0 {
+		eventNames = DefaultEventNames
+	}
+	for _, n := range eventNames {
+		if ok, _ := path.Match(n, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(res []*regexp.Regexp, key string) bool {
+	for _, re := range res {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterS3Object returns whether o has to be processed according to the object filter of ri.
+// Skipped objects are counted and logged
+func (ri *S3ReaderInformation) filterS3Object(o *aws.S3Object) bool {
+	ok, reason := ri.objectFilter.accept(o)
+	if !ok {
+		skippedS3Objects.Add(1)
+		logp.Debug("s3logsbeat", "Skipping %s because %s", o.String(), reason)
+	}
+	return ok
+}
@@ -0,0 +1,187 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/stretchr/testify/assert"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func newTestObjectFilter(t *testing.T, config map[string]interface{}) ObjectFilterConfig {
+	c, err := common.NewConfigFrom(config)
+	assert.NoError(t, err)
+	var f ObjectFilterConfig
+	assert.NoError(t, c.Unpack(&f))
+	return f
+}
+
+func newTestS3Object(key string, size int64, eventName string) *aws.S3Object {
+	o := aws.NewS3Object("mybucket", key)
+	o.Size, o.SizeKnown = size, true
+	o.EventName = eventName
+	return o
+}
+
+func TestObjectFilterKeys(t *testing.T) {
+	f := newTestObjectFilter(t, map[string]interface{}{
+		"include_keys": []string{`^AWSLogs/`},
+		"exclude_keys": []string{`ELBAccessLogTestFile$`, `/_SUCCESS$`},
+	})
+
+	ok, _ := f.accept(newTestS3Object("AWSLogs/123456789012/elasticloadbalancing/file.log.gz", 10, ""))
+	assert.True(t, ok)
+	ok, _ = f.accept(newTestS3Object("AWSLogs/123456789012/ELBAccessLogTestFile", 10, ""))
+	assert.False(t, ok)
+	ok, _ = f.accept(newTestS3Object("AWSLogs/job/_SUCCESS", 10, ""))
+	assert.False(t, ok)
+	ok, _ = f.accept(newTestS3Object("other/file.log.gz", 10, ""))
+	assert.False(t, ok)
+}
+
+func TestObjectFilterSize(t *testing.T) {
+	f := newTestObjectFilter(t, map[string]interface{}{
+		"min_size": 1,
+		"max_size": "1KiB",
+	})
+
+	ok, _ := f.accept(newTestS3Object("empty", 0, ""))
+	assert.False(t, ok)
+	ok, _ = f.accept(newTestS3Object("small", 1024, ""))
+	assert.True(t, ok)
+	ok, _ = f.accept(newTestS3Object("big", 1025, ""))
+	assert.False(t, ok)
+
+	// Objects whose size is unknown are not filtered by size
+	ok, _ = f.accept(aws.NewS3Object("mybucket", "unknown"))
+	assert.True(t, ok)
+}
+
+func TestObjectFilterInvalidSize(t *testing.T) {
+	c, err := common.NewConfigFrom(map[string]interface{}{
+		"min_size": 10,
+		"max_size": 5,
+	})
+	assert.NoError(t, err)
+	var f ObjectFilterConfig
+	assert.Error(t, c.Unpack(&f))
+}
+
+func TestObjectFilterEventNames(t *testing.T) {
+	// Only objects created are processed by default
+	var f ObjectFilterConfig
+	ok, _ := f.accept(newTestS3Object("key", 10, "ObjectCreated:Put"))
+	assert.True(t, ok)
+	ok, _ = f.accept(newTestS3Object("key", 10, "ObjectRemoved:Delete"))
+	assert.False(t, ok)
+	// Listed objects have no event
+	ok, _ = f.accept(newTestS3Object("key", 10, ""))
+	assert.True(t, ok)
+
+	f = newTestObjectFilter(t, map[string]interface{}{
+		"event_names": []string{"ObjectCreated:CompleteMultipartUpload", "ObjectRestore:*"},
+	})
+	ok, _ = f.accept(newTestS3Object("key", 10, "ObjectCreated:Put"))
+	assert.False(t, ok)
+	ok, _ = f.accept(newTestS3Object("key", 10, "ObjectCreated:CompleteMultipartUpload"))
+	assert.True(t, ok)
+	ok, _ = f.accept(newTestS3Object("key", 10, "ObjectRestore:Completed"))
+	assert.True(t, ok)
+}
+
+func newTestSQSMessageS3Event(ri *S3ReaderInformation, body string) *SQSMessage {
+	queueURL := "https://sqs.eu-west-1.amazonaws.com/123456789012/myqueue"
+	sess := session.Must(session.NewSession(&awssdk.Config{Region: awssdk.String("eu-west-1")}))
+	return NewSQSMessage(NewSQS(sess, &queueURL, ri), &aws.SQSMessage{
+		Message: &sqs.Message{MessageId: awssdk.String("myMessageId"), Body: awssdk.String(body)},
+	}, true)
+}
+
+const testS3EventBody = `{"Records":[
+	{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"mybucket"},"object":{"key":"AWSLogs/file.log.gz","size":100}}},
+	{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"mybucket"},"object":{"key":"AWSLogs/ELBAccessLogTestFile","size":100}}},
+	{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"mybucket"},"object":{"key":"AWSLogs/empty.log.gz","size":0}}}
+]}`
+
+func TestSQSMessageSkipsFilteredObjects(t *testing.T) {
+	ri := NewS3ReaderInformation(nil, nil, "alb").WithObjectFilter(newTestObjectFilter(t, map[string]interface{}{
+		"exclude_keys": []string{`ELBAccessLogTestFile$`},
+		"min_size":     1,
+	}))
+	sqsMessage := newTestSQSMessageS3Event(ri, testS3EventBody)
+	deleted := false
+	sqsMessage.OnDelete(func() { deleted = true })
+
+	skipped := skippedS3Objects.Get()
+	var keys []string
+	err := sqsMessage.ExtractNewS3Objects(func(s3object *S3Object) error {
+		keys = append(keys, s3object.Key)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AWSLogs/file.log.gz"}, keys)
+	assert.Equal(t, skipped+2, skippedS3Objects.Get())
+	assert.False(t, deleted)
+
+	// Message is released once the only object not skipped is processed
+	sqsMessage.S3ObjectProcessed()
+	assert.True(t, deleted)
+}
+
+func TestSQSMessageAllObjectsFiltered(t *testing.T) {
+	ri := NewS3ReaderInformation(nil, nil, "alb").WithObjectFilter(newTestObjectFilter(t, map[string]interface{}{
+		"include_keys": []string{`^other/`},
+	}))
+	sqsMessage := newTestSQSMessageS3Event(ri, testS3EventBody)
+	deleted := false
+	sqsMessage.OnDelete(func() { deleted = true })
+
+	err := sqsMessage.ExtractNewS3Objects(func(s3object *S3Object) error {
+		assert.Fail(t, "No object expected", s3object.Key)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+}
+
+func TestSQSMessageFiltersEventBridgeObjects(t *testing.T) {
+	ri := NewS3ReaderInformation(nil, nil, "alb").WithObjectFilter(newTestObjectFilter(t, map[string]interface{}{
+		"min_size": 1,
+	}))
+	var keys []string
+	for _, body := range []string{
+		`{"source":"aws.s3","detail-type":"Object Created","detail":{"bucket":{"name":"mybucket"},"object":{"key":"AWSLogs/file.log.gz","size":100},"reason":"PutObject"}}`,
+		`{"source":"aws.s3","detail-type":"Object Created","detail":{"bucket":{"name":"mybucket"},"object":{"key":"AWSLogs/empty.log.gz","size":0},"reason":"PutObject"}}`,
+		`{"source":"aws.s3","detail-type":"Object Deleted","detail":{"bucket":{"name":"mybucket"},"object":{"key":"AWSLogs/deleted.log.gz","size":100},"reason":"DeleteObject"}}`,
+	} {
+		err := newTestSQSMessageS3Event(ri, body).ExtractNewS3Objects(func(s3object *S3Object) error {
+			keys = append(keys, s3object.Key)
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"AWSLogs/file.log.gz"}, keys)
+}
+
+func TestSQSMessageSizeFilterSkipsCloudTrailObjects(t *testing.T) {
+	ri := NewS3ReaderInformation(nil, nil, "cloudtrail").WithObjectFilter(newTestObjectFilter(t, map[string]interface{}{
+		"min_size": 1,
+		"max_size": "1KiB",
+	}))
+
+	// CloudTrail notifications do not include the size of log files
+	sqsMessage := newTestSQSMessageS3Event(ri, `{"s3Bucket":"org-trail","s3ObjectKey":["AWSLogs/123456789012/CloudTrail/eu-west-1/2019/05/07/a.json.gz"]}`)
+	var keys []string
+	err := sqsMessage.ExtractNewS3Objects(func(s3object *S3Object) error {
+		keys = append(keys, s3object.Key)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AWSLogs/123456789012/CloudTrail/eu-west-1/2019/05/07/a.json.gz"}, keys)
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+var (
+	parseErrorThresholdExceeded = monitoring.NewUint(nil, "s3logsbeat.s3objects.parseErrorThresholdExceeded")
+)
+
+// ParseStats statistics of the lines of an object
+type ParseStats struct {
+	Read    uint64
+	Parsed  uint64
+	Ignored uint64
+	Failed  uint64
+}
+
+// complete obtains ignored lines (e.g. empty lines or comments) from the lines read. Parsers which
+// do not read lines one by one are considered to read all lines parsed or failed
+func (s *ParseStats) complete() {
+	if s.Read < s.Parsed+s.Failed {
+		s.Read = s.Parsed + s.Failed
+	}
+	s.Ignored = s.Read - s.Parsed - s.Failed
+}
+
+func (s *ParseStats) String() string {
+	return fmt.Sprintf("%d lines read, %d parsed, %d ignored, %d failed", s.Read, s.Parsed, s.Ignored, s.Failed)
+}
+
+// ParseErrorThresholdConfig configures when an object is considered failed because too many of its
+// lines could not be parsed: Max is either an absolute number of lines (e.g. 100) or a percentage of
+// the lines not ignored (e.g. 50%). If Pause is set, the input is also paused during that time
+type ParseErrorThresholdConfig struct {
+	Max   string        `config:"max"`
+	Pause time.Duration `config:"pause" validate:"min=0"`
+
+	maxLines   uint64
+	maxPercent float64
+	percent    bool
+}
+
+// Validate validates parse error threshold config logic
+func (c *ParseErrorThresholdConfig) Validate() error {
+	max := strings.TrimSpace(c.Max)
+	if max == "" {
+		return fmt.Errorf("parse_error_threshold.max is required")
+	}
+	if strings.HasSuffix(max, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(max, "%")), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return fmt.Errorf("Invalid parse_error_threshold.max %s: percentage must be between 0%% and 100%%", c.Max)
+		}
+		c.maxPercent, c.percent = percent, true
+		return nil
+	}
+	lines, err := strconv.ParseUint(max, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid parse_error_threshold.max %s: it must be a number of lines or a percentage", c.Max)
+	}
+	c.maxLines = lines
+	return nil
+}
+
+// exceeded returns whether the lines which failed on stats exceed the threshold
+func (c *ParseErrorThresholdConfig) exceeded(stats *ParseStats) bool {
+	if stats.Failed == 0 {
+		return false
+	}
+	if c.percent {
+		return float64(stats.Failed)*100/float64(stats.Parsed+stats.Failed) > c.maxPercent
+	}
+	return stats.Failed > c.maxLines
+}
+
+// inputPause keeps whether an input is paused
+type inputPause struct {
+	mutex sync.Mutex
+	until time.Time
+}
+
+// pause pauses the input during d
+func (p *inputPause) pause(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if until := time.Now().Add(d); until.After(p.until) {
+		p.until = until
+	}
+}
+
+// remaining obtains the time the input remains paused (0 if not paused)
+func (p *inputPause) remaining() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if d := time.Until(p.until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// pausable elements (like queues) whose input can be paused
+type pausable interface {
+	pausedFor() time.Duration
+}
+
+// pausedFor obtains the time the input of q remains paused (0 if not paused or not pausable)
+func pausedFor(q interface{}) time.Duration {
+	if p, ok := q.(pausable); ok {
+		return p.pausedFor()
+	}
+	return 0
+}
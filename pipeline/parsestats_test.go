@@ -0,0 +1,125 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func TestParseErrorThresholdConfigValidate(t *testing.T) {
+	c := &ParseErrorThresholdConfig{Max: "100"}
+	assert.NoError(t, c.Validate())
+	assert.False(t, c.percent)
+	assert.Equal(t, uint64(100), c.maxLines)
+
+	c = &ParseErrorThresholdConfig{Max: "12.5%"}
+	assert.NoError(t, c.Validate())
+	assert.True(t, c.percent)
+	assert.Equal(t, 12.5, c.maxPercent)
+
+	for _, max := range []string{"", "abc", "-1", "101%", "-5%", "x%"} {
+		c = &ParseErrorThresholdConfig{Max: max}
+		assert.Error(t, c.Validate(), max)
+	}
+}
+
+func TestParseErrorThresholdExceeded(t *testing.T) {
+	lines := &ParseErrorThresholdConfig{Max: "2"}
+	assert.NoError(t, lines.Validate())
+	assert.False(t, lines.exceeded(&ParseStats{Parsed: 0, Failed: 2}))
+	assert.True(t, lines.exceeded(&ParseStats{Parsed: 1000, Failed: 3}))
+
+	percent := &ParseErrorThresholdConfig{Max: "50%"}
+	assert.NoError(t, percent.Validate())
+	assert.False(t, percent.exceeded(&ParseStats{}))
+	assert.False(t, percent.exceeded(&ParseStats{Parsed: 5, Failed: 5}))
+	assert.True(t, percent.exceeded(&ParseStats{Parsed: 4, Failed: 6}))
+
+	// Ignored lines are not considered
+	assert.False(t, percent.exceeded(&ParseStats{Read: 100, Parsed: 1, Ignored: 98, Failed: 1}))
+
+	zero := &ParseErrorThresholdConfig{Max: "0%"}
+	assert.NoError(t, zero.Validate())
+	assert.False(t, zero.exceeded(&ParseStats{Parsed: 10}))
+	assert.True(t, zero.exceeded(&ParseStats{Parsed: 10, Failed: 1}))
+}
+
+func TestParseStatsComplete(t *testing.T) {
+	stats := &ParseStats{Read: 10, Parsed: 6, Failed: 1}
+	stats.complete()
+	assert.Equal(t, uint64(3), stats.Ignored)
+
+	// Parsers which do not read lines one by one
+	stats = &ParseStats{Parsed: 6, Failed: 1}
+	stats.complete()
+	assert.Equal(t, uint64(7), stats.Read)
+	assert.Equal(t, uint64(0), stats.Ignored)
+}
+
+func TestInputPause(t *testing.T) {
+	p := &inputPause{}
+	assert.Equal(t, time.Duration(0), p.remaining())
+
+	p.pause(time.Hour)
+	assert.True(t, p.remaining() > 59*time.Minute)
+
+	// Shorter pauses do not reduce current one
+	p.pause(time.Minute)
+	assert.True(t, p.remaining() > 59*time.Minute)
+}
+
+func TestQueuesPausedByInput(t *testing.T) {
+	ri := &S3ReaderInformation{}
+	sqs := &SQS{S3ReaderInformation: ri}
+	assert.Equal(t, time.Duration(0), pausedFor(sqs))
+
+	ri.WithParseErrorThreshold(&ParseErrorThresholdConfig{Max: "1"})
+	assert.Equal(t, time.Duration(0), pausedFor(sqs))
+
+	ri.pause.pause(time.Hour)
+	assert.True(t, pausedFor(sqs) > 0)
+	assert.True(t, pausedFor(&PubSub{S3ReaderInformation: ri}) > 0)
+	assert.Equal(t, time.Duration(0), pausedFor(struct{}{}))
+}
+
+// failureRecorder records the errors of the S3 objects which could not be read
+type failureRecorder struct {
+	s3ObjectProcessNotificationsIgnorer
+	failures []error
+}
+
+func (f *failureRecorder) S3ObjectFailed(err error) {
+	f.failures = append(f.failures, err)
+}
+
+func TestCheckParseStats(t *testing.T) {
+	c := &ParseErrorThresholdConfig{Max: "10%", Pause: time.Hour}
+	assert.NoError(t, c.Validate())
+	ri := NewS3ReaderInformation(nil, nil, "elb").
+		WithInputName("input [type=sqs]").
+		WithParseErrorThreshold(c)
+	w := NewS3ReaderWorker(nil, nopEventCounter{}, nopEventCounter{})
+
+	notifications := &failureRecorder{}
+	s3object := NewS3Object(aws.NewS3Object("mybucket", "mykey.log"), ri, notifications)
+	w.checkParseStats(s3object, &ParseStats{Read: 20, Parsed: 9, Failed: 1})
+	assert.Empty(t, notifications.failures)
+	assert.Equal(t, time.Duration(0), ri.pausedFor())
+
+	w.checkParseStats(s3object, &ParseStats{Read: 20, Parsed: 8, Failed: 2})
+	if assert.Len(t, notifications.failures, 1) {
+		assert.Contains(t, notifications.failures[0].Error(), "2 of 10 lines could not be parsed with log format elb")
+	}
+	assert.True(t, ri.pausedFor() > 0)
+
+	// Without threshold objects never fail because of parse errors
+	notifications = &failureRecorder{}
+	s3object = NewS3Object(aws.NewS3Object("mybucket", "mykey.log"), NewS3ReaderInformation(nil, nil, "elb"), notifications)
+	w.checkParseStats(s3object, &ParseStats{Failed: 10})
+	assert.Empty(t, notifications.failures)
+}
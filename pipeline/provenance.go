@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// Targets in which provenance information is stored
+const (
+	// ProvenanceTargetFields stores provenance information as event fields
+	ProvenanceTargetFields = "fields"
+	// ProvenanceTargetMetadata stores provenance information as event metadata (@metadata)
+	ProvenanceTargetMetadata = "metadata"
+)
+
+// linePosition position of the line from which an event is generated
+type linePosition interface {
+	// Line number (starting on 1)
+	Line() uint64
+	// Offset in bytes where line starts on decompressed object (negative if unknown)
+	Offset() int64
+}
+
+// recordPosition position of a line obtained from a dead-letter record (offset is unknown)
+type recordPosition uint64
+
+func (r recordPosition) Line() uint64 {
+	return uint64(r)
+}
+
+func (r recordPosition) Offset() int64 {
+	return -1
+}
+
+// provenanceFields obtains information about where events of this object come from
+func (s *S3Object) provenanceFields() common.MapStr {
+	object := common.MapStr{
+		"key": s.Key,
+	}
+	if s.ETag != "" {
+		object["etag"] = s.ETag
+	}
+	if s.Size > 0 {
+		object["size"] = s.Size
+	}
+	if !s.LastModified.IsZero() {
+		object["last_modified"] = s.LastModified
+	}
+
+	s3 := common.MapStr{
+		"bucket": common.MapStr{
+			"name": s.Bucket,
+		},
+		"object": object,
+	}
+	if !s.EventTime.IsZero() {
+		s3["event"] = common.MapStr{
+			"time": s.EventTime,
+		}
+	}
+
+	fields := common.MapStr{
+		"log": common.MapStr{
+			"file": common.MapStr{
+				"path": fmt.Sprintf("s3://%s/%s", s.Bucket, s.Key),
+			},
+		},
+		"aws": common.MapStr{
+			"s3": s3,
+		},
+	}
+
+	if m, ok := s.s3ObjectProcessNotifications.(*SQSMessage); ok {
+		fields.Put("aws.sqs.queue_url", m.sqs.String())
+		fields.Put("aws.sqs.message_id", *m.MessageId)
+	}
+	return fields
+}
+
+// addProvenance adds object provenance and line position to event on configured target
+func (s *S3Object) addProvenance(event *beat.Event, objectFields common.MapStr, pos linePosition) {
+	if s.provenanceTarget == "" {
+		return
+	}
+
+	fields := objectFields.Clone()
+	fields.Put("log.line", pos.Line())
+	if offset := pos.Offset(); offset >= 0 {
+		fields.Put("log.offset", offset)
+	}
+
+	if s.provenanceTarget == ProvenanceTargetMetadata {
+		if event.Meta == nil {
+			event.Meta = common.MapStr{}
+		}
+		event.Meta.DeepUpdate(fields)
+	} else {
+		event.Fields.DeepUpdate(fields)
+	}
+}
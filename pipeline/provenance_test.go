@@ -0,0 +1,86 @@
+//go:build !integration
+// +build !integration
+
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/stretchr/testify/assert"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func TestProvenanceFieldsFromSQS(t *testing.T) {
+	o := aws.NewS3Object("mybucket", "mykey.log.gz")
+	o.Size = 1234
+	o.ETag = "0f0c79b67cf091c2228c16640d75ff3b"
+	o.EventTime = time.Date(2018, 7, 7, 9, 35, 10, 990000000, time.UTC)
+
+	queueURL := "https://sqs.eu-west-1.amazonaws.com/123456789012/myqueue"
+	ri := NewS3ReaderInformation(nil, nil, "alb").WithProvenance(ProvenanceTargetFields)
+	sess := session.Must(session.NewSession(&awssdk.Config{Region: awssdk.String("eu-west-1")}))
+	sqsMessage := NewSQSMessage(NewSQS(sess, &queueURL, ri), &aws.SQSMessage{
+		Message: &sqs.Message{MessageId: awssdk.String("myMessageId")},
+	}, true)
+	s3object := NewS3Object(o, ri, sqsMessage)
+
+	event := &beat.Event{Fields: common.MapStr{"field": "value"}}
+	s3object.addProvenance(event, s3object.provenanceFields(), recordPosition(7))
+
+	expected := map[string]interface{}{
+		"field":              "value",
+		"log.file.path":      "s3://mybucket/mykey.log.gz",
+		"log.line":           uint64(7),
+		"aws.s3.bucket.name": "mybucket",
+		"aws.s3.object.key":  "mykey.log.gz",
+		"aws.s3.object.size": int64(1234),
+		"aws.s3.object.etag": "0f0c79b67cf091c2228c16640d75ff3b",
+		"aws.s3.event.time":  o.EventTime,
+		"aws.sqs.queue_url":  queueURL,
+		"aws.sqs.message_id": "myMessageId",
+	}
+	for k, v := range expected {
+		value, err := event.Fields.GetValue(k)
+		assert.NoError(t, err, k)
+		assert.Equal(t, v, value, k)
+	}
+	has, _ := event.Fields.HasKey("log.offset")
+	assert.False(t, has)
+	assert.Nil(t, event.Meta)
+}
+
+func TestProvenanceMetadata(t *testing.T) {
+	o := aws.NewS3Object("mybucket", "mykey.log")
+	ri := NewS3ReaderInformation(nil, nil, "alb").WithProvenance(ProvenanceTargetMetadata)
+	s3object := NewS3Object(o, ri, NewS3ObjectProcessNotificationsIgnorer())
+
+	event := &beat.Event{Fields: common.MapStr{}, Meta: common.MapStr{"_id": "myid"}}
+	s3object.addProvenance(event, s3object.provenanceFields(), &testPosition{line: 2, offset: 10})
+
+	assert.Equal(t, common.MapStr{}, event.Fields)
+	path, _ := event.Meta.GetValue("log.file.path")
+	assert.Equal(t, "s3://mybucket/mykey.log", path)
+	offset, _ := event.Meta.GetValue("log.offset")
+	assert.Equal(t, int64(10), offset)
+	assert.Equal(t, "myid", event.Meta["_id"])
+}
+
+type testPosition struct {
+	line   uint64
+	offset int64
+}
+
+func (p *testPosition) Line() uint64 {
+	return p.line
+}
+
+func (p *testPosition) Offset() int64 {
+	return p.offset
+}
@@ -0,0 +1,28 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/sequra/s3logsbeat/gcp"
+)
+
+// PubSub Pub/Sub subscription element to send thru pipeline
+type PubSub struct {
+	*gcp.PubSub
+	*S3ReaderInformation
+}
+
+// NewPubSub creates a new Pub/Sub subscription to be sent thru pipeline
+func NewPubSub(pubSub *gcp.PubSub, ri *S3ReaderInformation) *PubSub {
+	return &PubSub{
+		PubSub:              pubSub,
+		S3ReaderInformation: ri,
+	}
+}
+
+// Poll pulls messages from Pub/Sub subscription. Pulls return immediately, so they are not cancelled by ctx
+func (p *PubSub) Poll(ctx context.Context, keepOnCompleted bool, mh func(QueueMessage) error) (int, bool, error) {
+	return p.ReceiveMessages(func(message *gcp.PubSubMessage) error {
+		return mh(NewPubSubMessage(p, message, keepOnCompleted))
+	})
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/sequra/s3logsbeat/gcp"
+)
+
+// PubSubMessage Pub/Sub message to be passed thru pipeline.
+// As with SQS messages, we have to keep how much objects and how much events
+// are generated from this message in order to ack it once it finishes.
+// While its object is processed, the message is not delivered to other consumers
+// extending its ack deadline. If the object could not be read, the message is not acked, so it is delivered
+// again once its ack deadline expires
+type PubSubMessage struct {
+	*gcp.PubSubMessage
+	*completionTracker
+
+	pubSub *PubSub
+}
+
+// NewPubSubMessage creates a Pub/Sub message received from subscription pubSub
+func NewPubSubMessage(pubSub *PubSub, message *gcp.PubSubMessage, keepOnCompleted bool) *PubSubMessage {
+	p := &PubSubMessage{
+		PubSubMessage: message,
+		pubSub:        pubSub,
+	}
+	p.completionTracker = newCompletionTracker(fmt.Sprintf("Pub/Sub message with ID %s", message.MessageID), keepOnCompleted, p.ack)
+	return p
+}
+
+// ack acks the message if its object has been read
+func (p *PubSubMessage) ack(failures []string) {
+	if len(failures) > 0 {
+		logp.Warn("Object present on Pub/Sub message with ID %s could not be read. Not acking it, so it is delivered again: %s", p.MessageID, failures[0])
+		return
+	}
+	logp.Debug("s3logsbeat", "Acking Pub/Sub message with ID %s because it has been fully processed", p.MessageID)
+	if err := p.pubSub.Acknowledge(p.AckID); err != nil {
+		logp.Err("Couldn't ack Pub/Sub message with ID %s. Error: %v", p.MessageID, err)
+	}
+}
+
+// keepAckDeadline extends the ack deadline of the message now and each half of it until the message
+// is completed
+func (p *PubSubMessage) keepAckDeadline() {
+	interval := p.pubSub.AckDeadline() / 2
+	if interval <= 0 {
+		return
+	}
+	p.extendAckDeadline()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.completed:
+				return
+			case <-ticker.C:
+				p.extendAckDeadline()
+			}
+		}
+	}()
+}
+
+func (p *PubSubMessage) extendAckDeadline() {
+	select {
+	case <-p.completed:
+		return
+	default:
+	}
+	if err := p.pubSub.ModifyAckDeadline(p.AckID); err != nil {
+		logp.Warn("Couldn't extend ack deadline of Pub/Sub message with ID %s. Error: %v", p.MessageID, err)
+		return
+	}
+	logp.Debug("s3logsbeat", "Extended ack deadline of Pub/Sub message with ID %s", p.MessageID)
+}
+
+// ExtractNewS3Objects extracts the new object notified by a Pub/Sub message. Ack deadline is extended
+// before the object is passed, so it is not delivered again while it waits to be read
+func (p *PubSubMessage) ExtractNewS3Objects(mh func(s3object *S3Object) error) error {
+	return p.extractNewS3Objects(p.pubSub.S3ReaderInformation, p.ExtractNewObjects, func(o *S3Object) error {
+		p.keepAckDeadline()
+		return mh(o)
+	})
+}
@@ -0,0 +1,143 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sequra/s3logsbeat/gcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// pubSubRequests records acks and ack deadline modifications done on a subscription
+type pubSubRequests struct {
+	mutex     sync.Mutex
+	acks      int
+	deadlines int
+}
+
+func (p *pubSubRequests) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch {
+	case strings.HasSuffix(r.URL.Path, ":acknowledge"):
+		p.acks++
+	case strings.HasSuffix(r.URL.Path, ":modifyAckDeadline"):
+		p.deadlines++
+	}
+	w.Write([]byte("{}"))
+}
+
+func (p *pubSubRequests) get() (int, int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.acks, p.deadlines
+}
+
+func newTestPubSub(ackDeadline time.Duration) (*PubSub, *pubSubRequests, func()) {
+	requests := &pubSubRequests{}
+	server := httptest.NewServer(requests)
+	clients := &gcp.Clients{PubSubEndpoint: server.URL, PubSubClient: server.Client()}
+	pubSub := NewPubSub(gcp.NewPubSub(clients, "projects/myproject/subscriptions/logs", ackDeadline), &S3ReaderInformation{})
+	return pubSub, requests, server.Close
+}
+
+func newTestPubSubMessage(pubSub *PubSub, eventType string) *PubSubMessage {
+	return NewPubSubMessage(pubSub, &gcp.PubSubMessage{
+		AckID:      "ack1",
+		MessageID:  "1",
+		Attributes: map[string]string{"eventType": eventType, "bucketId": "mybucket", "objectId": "logs/a.log"},
+	}, false)
+}
+
+func TestPubSubMessageAckedWhenCompleted(t *testing.T) {
+	pubSub, requests, close := newTestPubSub(100 * time.Millisecond)
+	defer close()
+
+	m := newTestPubSubMessage(pubSub, gcp.EventTypeObjectFinalize)
+	deleted := false
+	m.OnDelete(func() { deleted = true })
+
+	var objects []*S3Object
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		// Ack deadline is extended before object is passed
+		_, deadlines := requests.get()
+		assert.Equal(t, 1, deadlines)
+		objects = append(objects, o)
+		return nil
+	}))
+	if !assert.Len(t, objects, 1) {
+		return
+	}
+	assert.Equal(t, "logs/a.log", objects[0].Key)
+
+	// Acked once object is processed and all its events are ACKed
+	m.EventSent()
+	m.EventSent()
+	m.S3ObjectProcessed()
+	m.EventACKed()
+
+	// Ack deadline is extended while events are pending to be ACKed
+	deadline := time.Now().Add(5 * time.Second)
+	for _, deadlines := requests.get(); deadlines < 2 && time.Now().Before(deadline); _, deadlines = requests.get() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	acks, deadlines := requests.get()
+	assert.True(t, deadlines >= 2)
+	assert.Equal(t, 0, acks)
+	assert.False(t, deleted)
+
+	m.EventACKed()
+	acks, deadlines = requests.get()
+	assert.Equal(t, 1, acks)
+	assert.True(t, deleted)
+
+	// Ack deadline is not extended anymore
+	time.Sleep(150 * time.Millisecond)
+	_, deadlinesAfterAck := requests.get()
+	assert.Equal(t, deadlines, deadlinesAfterAck)
+}
+
+func TestPubSubMessageAckedWhenNoObjects(t *testing.T) {
+	pubSub, requests, close := newTestPubSub(time.Minute)
+	defer close()
+
+	m := newTestPubSubMessage(pubSub, "OBJECT_DELETE")
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		t.Fatal("No object expected")
+		return nil
+	}))
+	acks, deadlines := requests.get()
+	assert.Equal(t, 1, acks)
+	assert.Equal(t, 0, deadlines)
+}
+
+func TestPubSubMessageNotAckedWhenFailed(t *testing.T) {
+	pubSub, requests, close := newTestPubSub(time.Minute)
+	defer close()
+
+	m := newTestPubSubMessage(pubSub, gcp.EventTypeObjectFinalize)
+	deleted := false
+	m.OnDelete(func() { deleted = true })
+	var objects []*S3Object
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		objects = append(objects, o)
+		return nil
+	}))
+	if !assert.Len(t, objects, 1) {
+		return
+	}
+	objects[0].failed(errors.New("access denied"))
+	m.S3ObjectProcessed()
+
+	// Message is released (so it is delivered again) but not acked
+	assert.True(t, deleted)
+	acks, _ := requests.get()
+	assert.Equal(t, 0, acks)
+}
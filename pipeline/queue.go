@@ -0,0 +1,27 @@
+package pipeline
+
+import (
+	"context"
+)
+
+// Queue queue of notifications about new objects to send thru pipeline (SQS or Pub/Sub)
+type Queue interface {
+	// Poll receives messages from queue executing message handler for each one. Messages are
+	// removed from queue once processed unless keepOnCompleted is set.
+	// Returns the number of messages received, a boolean indicating that more possible available
+	// messages are present on the queue, and the error (if any). Cancelling ctx interrupts receives
+	// which wait for messages (long polling)
+	Poll(ctx context.Context, keepOnCompleted bool, mh func(QueueMessage) error) (int, bool, error)
+
+	String() string
+}
+
+// QueueMessage message received from a queue, removed from it once all objects and events
+// generated from it have been processed
+type QueueMessage interface {
+	// OnDelete adds callback executed when message is removed from queue
+	OnDelete(f func())
+
+	// ExtractNewS3Objects extracts those new objects present on the message
+	ExtractNewS3Objects(mh func(s3object *S3Object) error) error
+}
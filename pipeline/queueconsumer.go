@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+const (
+	sqsConsumerWorkers = 2
+)
+
+// QueueConsumerWorker is a worker to read queue notifications for reading messages from SQS or Pub/Sub
+// (present on in channel), extract new S3 objects present on messages and pass to the output (out channel)
+type QueueConsumerWorker struct {
+	wg              sync.WaitGroup
+	in              <-chan Queue
+	out             chan<- *S3Object
+	done            chan struct{}
+	doneForced      chan struct{}
+	ctx             context.Context
+	cancel          context.CancelFunc
+	inClosed        chan struct{}
+	inClosedOnce    sync.Once
+	queuesMutex     sync.Mutex
+	closers         map[io.Closer]Queue
+	wgSQSMessages   eventCounter
+	wgS3Objects     eventCounter
+	keepSQSMessages bool
+}
+
+// NewQueueConsumerWorker creates a QueueConsumerWorker
+func NewQueueConsumerWorker(in <-chan Queue, out chan<- *S3Object, wgSQSMessages eventCounter, wgS3Objects eventCounter, keepSQSMessages bool) *QueueConsumerWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &QueueConsumerWorker{
+		in:              in,
+		out:             out,
+		done:            make(chan struct{}),
+		doneForced:      make(chan struct{}),
+		ctx:             ctx,
+		cancel:          cancel,
+		inClosed:        make(chan struct{}),
+		closers:         make(map[io.Closer]Queue),
+		wgSQSMessages:   wgSQSMessages,
+		wgS3Objects:     wgS3Objects,
+		keepSQSMessages: keepSQSMessages,
+	}
+}
+
+// Start starts the queue consumer workers
+func (w *QueueConsumerWorker) Start() {
+	w.wg.Add(sqsConsumerWorkers)
+	for n := 0; n < sqsConsumerWorkers; n++ {
+		go func(workerID int) {
+			defer w.wg.Done()
+			logp.Info("Queue consumer worker #%d : waiting for input data", workerID)
+			for {
+				select {
+				case <-w.done:
+					logp.Info("Queue consumer worker #%d finished", workerID)
+					return
+				case queue, ok := <-w.in:
+					if !ok {
+						logp.Info("Queue consumer worker #%d finished because channel is closed", workerID)
+						w.inClosedOnce.Do(func() { close(w.inClosed) })
+						return
+					}
+					w.addQueue(queue)
+					if l, ok := queue.(LoopedQueue); ok && l.GetReceiveLoop() != nil {
+						w.startReceiveLoop(queue, l.GetReceiveLoop())
+					} else {
+						w.onQueueNotification(workerID, queue)
+					}
+				}
+			}
+		}(n)
+	}
+}
+
+// addQueue keeps queue to be closed when workers stop if it needs to be closed (e.g. to send
+// pending deletes)
+func (w *QueueConsumerWorker) addQueue(queue Queue) {
+	if c, ok := queue.(io.Closer); ok {
+		w.queuesMutex.Lock()
+		defer w.queuesMutex.Unlock()
+		w.closers[c] = queue
+	}
+}
+
+// closeQueues closes the queues which need to be closed
+func (w *QueueConsumerWorker) closeQueues() {
+	w.queuesMutex.Lock()
+	defer w.queuesMutex.Unlock()
+	for c, queue := range w.closers {
+		if err := c.Close(); err != nil {
+			logp.Err("Could not close queue %s. Error: %v", queue.String(), err)
+		}
+	}
+}
+
+// startReceiveLoop polls queue on its own goroutine until workers stop accepting messages. Once
+// input channel is closed (inputs have finished), loop finishes when queue is empty
+func (w *QueueConsumerWorker) startReceiveLoop(queue Queue, receiveLoop *ReceiveLoop) {
+	logp.Info("Starting receive loop of queue %s", queue.String())
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		var delay time.Duration
+		for {
+			select {
+			case <-w.done:
+				logp.Info("Receive loop of queue %s finished", queue.String())
+				return
+			case <-time.After(delay):
+			}
+			if paused := pausedFor(queue); paused > 0 {
+				select {
+				case <-w.inClosed:
+					logp.Info("Receive loop of queue %s finished because its input is paused and channel is closed", queue.String())
+					return
+				default:
+				}
+				logp.Debug("s3logsbeat", "Input of queue %s paused. Next poll in %v", queue.String(), paused)
+				delay = paused
+				continue
+			}
+			received := w.onQueueNotification(-1, queue)
+			if received == 0 {
+				select {
+				case <-w.inClosed:
+					logp.Info("Receive loop of queue %s finished because queue is empty and channel is closed", queue.String())
+					return
+				default:
+				}
+			}
+			delay = receiveLoop.next(delay, received)
+			if delay > 0 {
+				logp.Debug("s3logsbeat", "No messages received from queue %s. Next poll in %v", queue.String(), delay)
+			}
+		}
+	}()
+}
+
+// Reads messages from queue until empty or the queue returns less than
+// maximum. Returns the number of messages received
+func (w *QueueConsumerWorker) onQueueNotification(workerID int, queue Queue) int {
+	if paused := pausedFor(queue); paused > 0 {
+		logp.Debug("s3logsbeat", "Not reading messages from queue %s because its input is paused during %v", queue.String(), paused)
+		return 0
+	}
+	logp.Debug("s3logsbeat", "Reading messages from queue %s", queue.String())
+	var messagesReceived, total int
+	var err error
+	more := true
+
+	onNewS3Object := func(s3object *S3Object) error {
+		// Using a select because w.out could be full
+		select {
+		case <-w.doneForced:
+			logp.Info("Cancelling ExtractNewS3Objects")
+			return fmt.Errorf("Cancelling")
+		case w.out <- s3object:
+			w.wgS3Objects.Add(1)
+		}
+		return nil
+	}
+
+	onMessage := func(m QueueMessage) error {
+		// Monitoring
+		w.wgSQSMessages.Add(1)
+		m.OnDelete(func() { w.wgSQSMessages.Done() })
+
+		// Extract new S3 objects from message
+		return m.ExtractNewS3Objects(onNewS3Object)
+	}
+
+	for more {
+		// Avoid reading more SQS messages on stop
+		select {
+		case <-w.done:
+			return total
+		default:
+			if messagesReceived, more, err = queue.Poll(w.ctx, w.keepSQSMessages, onMessage); err != nil && w.ctx.Err() != nil {
+				logp.Debug("s3logsbeat", "Receive from queue %s cancelled because workers are stopping", queue.String())
+			} else if err != nil {
+				w.wgSQSMessages.Error(1)
+				logp.Err("Could not receive messages from queue %s. Error: %v", queue.String(), err)
+				// more is false when err != nil -> exiting from loop
+			} else {
+				logp.Debug("s3logsbeat", "Received %d messages from queue %s", messagesReceived, queue.String())
+				total += messagesReceived
+			}
+		}
+	}
+	return total
+}
+
+// StopAcceptingMessages sends notification to stop to workers and wait until all workers finish
+func (w *QueueConsumerWorker) StopAcceptingMessages() {
+	logp.Debug("s3logsbeat", "Queue consumers not accepting more messages")
+	close(w.done)
+	w.cancel()
+}
+
+// Wait waits until all workers have finished
+func (w *QueueConsumerWorker) Wait() {
+	w.wg.Wait()
+}
+
+// Stop sends notification to stop to workers and wait untill all workers finish
+func (w *QueueConsumerWorker) Stop() {
+	logp.Debug("s3logsbeat", "Stopping queue consumer workers")
+	close(w.doneForced)
+	w.cancel()
+	w.wg.Wait()
+	w.closeQueues()
+	logp.Debug("s3logsbeat", "Queue consumer workers stopped")
+}
@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"time"
+)
+
+// ReceiveLoop configures how a queue is polled continuously by its own receive loop, independently
+// of the poll frequency of its input. After a poll in which no messages are received (or which fails)
+// next poll is delayed with exponential back-off, from Backoff up to MaxBackoff. Delay is reset
+// as soon as messages are received
+type ReceiveLoop struct {
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// LoopedQueue queue polled continuously by a receive loop
+type LoopedQueue interface {
+	Queue
+
+	// GetReceiveLoop obtains the receive loop of the queue (nil if it is polled only when sent thru pipeline)
+	GetReceiveLoop() *ReceiveLoop
+}
+
+// next obtains the delay before next poll, based on current delay and the messages received
+// on last poll
+func (l *ReceiveLoop) next(current time.Duration, received int) time.Duration {
+	switch {
+	case received > 0:
+		return 0
+	case current == 0:
+		return l.Backoff
+	case current*2 > l.MaxBackoff:
+		return l.MaxBackoff
+	default:
+		return current * 2
+	}
+}
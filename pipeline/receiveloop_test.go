@@ -0,0 +1,136 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveLoopNext(t *testing.T) {
+	l := &ReceiveLoop{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Duration(0), l.next(0, 3))
+	assert.Equal(t, time.Duration(0), l.next(4*time.Second, 1))
+	assert.Equal(t, time.Second, l.next(0, 0))
+	assert.Equal(t, 2*time.Second, l.next(time.Second, 0))
+	assert.Equal(t, 4*time.Second, l.next(2*time.Second, 0))
+	assert.Equal(t, 5*time.Second, l.next(4*time.Second, 0))
+	assert.Equal(t, 5*time.Second, l.next(5*time.Second, 0))
+}
+
+// loopedQueue fake queue polled by a receive loop, returning batches of messages in order (and no
+// messages once consumed)
+type loopedQueue struct {
+	mutex   sync.Mutex
+	loop    *ReceiveLoop
+	batches []int
+	polls   int
+}
+
+type nopQueueMessage struct{}
+
+func (nopQueueMessage) OnDelete(f func())                                  {}
+func (nopQueueMessage) ExtractNewS3Objects(mh func(*S3Object) error) error { return nil }
+
+func (q *loopedQueue) Poll(ctx context.Context, keepOnCompleted bool, mh func(QueueMessage) error) (int, bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.polls++
+	if len(q.batches) == 0 {
+		return 0, false, nil
+	}
+	n := q.batches[0]
+	q.batches = q.batches[1:]
+	for i := 0; i < n; i++ {
+		mh(nopQueueMessage{})
+	}
+	return n, false, nil
+}
+
+func (q *loopedQueue) GetReceiveLoop() *ReceiveLoop {
+	return q.loop
+}
+
+func (q *loopedQueue) String() string {
+	return "looped"
+}
+
+func (q *loopedQueue) getPolls() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.polls
+}
+
+func TestQueueConsumerWorkerReceiveLoopFinishesWhenInputClosed(t *testing.T) {
+	in := make(chan Queue, 1)
+	q := &loopedQueue{
+		loop:    &ReceiveLoop{Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+		batches: []int{3, 2},
+	}
+	w := NewQueueConsumerWorker(in, make(chan *S3Object), nopEventCounter{}, nopEventCounter{}, false)
+	w.Start()
+	in <- q
+	close(in)
+	w.Wait()
+
+	// Both batches and an empty poll (after which loop finishes)
+	assert.Equal(t, 3, q.getPolls())
+}
+
+func TestQueueConsumerWorkerReceiveLoopBacksOffUntilStopped(t *testing.T) {
+	in := make(chan Queue, 1)
+	q := &loopedQueue{
+		loop: &ReceiveLoop{Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+	}
+	w := NewQueueConsumerWorker(in, make(chan *S3Object), nopEventCounter{}, nopEventCounter{}, false)
+	w.Start()
+	in <- q
+
+	// Queue is polled continuously while empty
+	for start := time.Now(); q.getPolls() < 3 && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, q.getPolls() >= 3)
+
+	w.StopAcceptingMessages()
+	w.Wait()
+	polls := q.getPolls()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, polls, q.getPolls())
+}
+
+// longPollingQueue waits for messages until poll is cancelled
+type longPollingQueue struct {
+	loop *ReceiveLoop
+}
+
+func (q *longPollingQueue) Poll(ctx context.Context, keepOnCompleted bool, mh func(QueueMessage) error) (int, bool, error) {
+	<-ctx.Done()
+	return 0, false, ctx.Err()
+}
+
+func (q *longPollingQueue) GetReceiveLoop() *ReceiveLoop {
+	return q.loop
+}
+
+func (q *longPollingQueue) String() string {
+	return "long-polling"
+}
+
+func TestQueueConsumerWorkerCancelsLongPolling(t *testing.T) {
+	in := make(chan Queue, 1)
+	w := NewQueueConsumerWorker(in, make(chan *S3Object), nopEventCounter{}, nopEventCounter{}, false)
+	w.Start()
+	in <- &longPollingQueue{loop: &ReceiveLoop{}}
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+	w.StopAcceptingMessages()
+	w.Wait()
+	assert.True(t, time.Since(start) < time.Second)
+}
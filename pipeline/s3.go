@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -9,16 +10,22 @@ import (
 
 // S3List S3 list object to send thru pipeline
 type S3List struct {
-	*aws.S3
+	ObjectStorage
 	*S3ReaderInformation
 	s3prefix  *aws.S3Object
 	since, to time.Time
+	tracker   ObjectTracker
 }
 
 // NewS3List creates a new S3 to be sent thru pipeline
 func NewS3List(session *session.Session, s3prefix *aws.S3Object, ri *S3ReaderInformation, since, to time.Time) *S3List {
+	return NewS3ListFromStorage(aws.NewS3(session), s3prefix, ri, since, to)
+}
+
+// NewS3ListFromStorage creates a new list of objects present on storage to be sent thru pipeline
+func NewS3ListFromStorage(storage ObjectStorage, s3prefix *aws.S3Object, ri *S3ReaderInformation, since, to time.Time) *S3List {
 	return &S3List{
-		S3:                  aws.NewS3(session),
+		ObjectStorage:       storage,
 		S3ReaderInformation: ri,
 		s3prefix:            s3prefix,
 		since:               since,
@@ -26,6 +33,20 @@ func NewS3List(session *session.Session, s3prefix *aws.S3Object, ri *S3ReaderInf
 	}
 }
 
+// WithTracker configures the tracker of objects listed, used to skip those already processed
+func (s *S3List) WithTracker(tracker ObjectTracker) *S3List {
+	s.tracker = tracker
+	return s
+}
+
+// notifications obtains the notifications of the process of o
+func (s *S3List) notifications(o *aws.S3Object) S3ObjectProcessNotifications {
+	if s.tracker == nil {
+		return NewS3ObjectProcessNotificationsIgnorer()
+	}
+	return s.tracker.Track(o)
+}
+
 // S3Object S3 object element to send thru pipeline
 type S3Object struct {
 	*aws.S3Object
@@ -41,3 +62,10 @@ func NewS3Object(awsS3Object *aws.S3Object, ri *S3ReaderInformation, s3ObjectPro
 		s3ObjectProcessNotifications: s3ObjectProcessNotifications,
 	}
 }
+
+// failed notifies that the object could not be read because of err (if notifications are interested on it)
+func (s *S3Object) failed(err error) {
+	if f, ok := s.s3ObjectProcessNotifications.(S3ObjectFailureNotifications); ok {
+		f.S3ObjectFailed(fmt.Errorf("%s: %v", s.String(), err))
+	}
+}
@@ -3,6 +3,7 @@ package pipeline
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/sequra/s3logsbeat/aws"
@@ -59,6 +60,20 @@ func (w *S3ListerWorker) Start() {
 // onS3ListNotification Reads S3 objects from a bucket and prefix
 func (w *S3ListerWorker) onS3List(workerID int, s3 *S3List) {
 	logp.Debug("s3logsbeat", "Listening S3 objects present on S3 prefix URI %s", s3.s3prefix.String())
+	archiveStorage, _ := s3.ObjectStorage.(ArchiveStorage)
+	archived := 0
+
+	// Restores requested on previous runs are processed first (and not again when listed)
+	restored := map[string]struct{}{}
+	if s3.archivedObjects.restoring() && archiveStorage != nil {
+		if _, err := s3.archivedObjects.processRestored(archiveStorage, s3.s3prefix, func(o *aws.S3Object) error {
+			restored[o.Key] = struct{}{}
+			return w.sendRestored(s3, o)
+		}); err != nil {
+			logp.Err("Could not process restored S3 objects from S3 prefix URI %s. Error: %v", s3.s3prefix.String(), err)
+		}
+	}
+
 	onS3Object := func(o *aws.S3ObjectWithOriginal) error {
 		// Case in which we have a lot of filtered S3 files and we want to cancel the process
 		select {
@@ -67,19 +82,27 @@ func (w *S3ListerWorker) onS3List(workerID int, s3 *S3List) {
 			return fmt.Errorf("Cancelling")
 		default:
 		}
-		if o.LastModified.After(s3.since) && o.LastModified.Before(s3.to) {
-			// Using a select because w.out could be full
-			select {
-			case <-w.done:
-				logp.Info("Cancelling ListS3Objects")
-				return fmt.Errorf("Cancelling")
-			case w.out <- NewS3Object(o.S3Object, s3.S3ReaderInformation, NewS3ObjectProcessNotificationsIgnorer()):
-				w.wgS3Objects.Add(1)
+		if o.S3Object.LastModified.After(s3.since) && o.S3Object.LastModified.Before(s3.to) {
+			if !s3.filterS3Object(o.S3Object) {
+				return nil
 			}
-		} else {
-			if logp.IsDebug("s3logsbeat") {
-				logp.Debug("s3logsbeat", "Filtering key s3://%s/%s because does not fit with timestamp (%s) filters (since=%s,to=%s)", o.Bucket, o.S3Object.Key, o.LastModified, s3.since.UTC(), s3.to.UTC())
+			if s3.tracker != nil && s3.tracker.Processed(o.S3Object) {
+				logp.Debug("s3logsbeat", "Skipping %s because it has already been processed", o.S3Object.String())
+				return nil
 			}
+			if o.S3Object.IsArchived() {
+				if _, ok := restored[o.S3Object.Key]; ok {
+					return nil
+				}
+				archived++
+				if !s3.archivedObjects.onArchived(archiveStorage, o.S3Object) {
+					return nil
+				}
+			}
+			return w.send(s3, o.S3Object)
+		}
+		if logp.IsDebug("s3logsbeat") {
+			logp.Debug("s3logsbeat", "Filtering key s3://%s/%s because does not fit with timestamp (%s) filters (since=%s,to=%s)", o.Bucket, o.S3Object.Key, o.S3Object.LastModified, s3.since.UTC(), s3.to.UTC())
 		}
 		return nil
 	}
@@ -89,6 +112,83 @@ func (w *S3ListerWorker) onS3List(workerID int, s3 *S3List) {
 	} else {
 		logp.Debug("s3logsbeat", "Received %d S3 objects from S3 prefix URI %s", objectsReceived, s3.s3prefix.String())
 	}
+
+	if archived > 0 {
+		if s3.archivedObjects.restoring() && archiveStorage != nil {
+			logp.Info("Found %d archived S3 objects on S3 prefix URI %s. They are processed once restored", archived, s3.s3prefix.String())
+			w.waitRestores(s3, archiveStorage)
+		} else {
+			logp.Warn("Skipped %d archived S3 objects present on S3 prefix URI %s", archived, s3.s3prefix.String())
+		}
+	}
+}
+
+// waitRestores persists pending restores present on the prefix of s3 and, if configured, waits
+// until all of them are restored and processed
+func (w *S3ListerWorker) waitRestores(s3 *S3List, storage ArchiveStorage) {
+	config := s3.archivedObjects.config
+	for {
+		pending, err := s3.archivedObjects.processRestored(storage, s3.s3prefix, func(o *aws.S3Object) error {
+			return w.sendRestored(s3, o)
+		})
+		if err != nil {
+			logp.Err("Could not process restored S3 objects from S3 prefix URI %s. Error: %v", s3.s3prefix.String(), err)
+			return
+		}
+		if pending == 0 {
+			return
+		}
+		if !config.Wait {
+			logp.Info("%d restores pending on S3 prefix URI %s. They will be processed on next runs", pending, s3.s3prefix.String())
+			return
+		}
+		logp.Info("Waiting for %d restores pending on S3 prefix URI %s", pending, s3.s3prefix.String())
+		select {
+		case <-w.done:
+			return
+		case <-time.After(config.CheckInterval):
+		}
+	}
+}
+
+// send sends o to be read
+func (w *S3ListerWorker) send(s3 *S3List, o *aws.S3Object) error {
+	return w.sendWithNotifications(s3, o, s3.notifications(o))
+}
+
+// sendRestored sends restored object o to be read, removing it from pending restores once processed
+func (w *S3ListerWorker) sendRestored(s3 *S3List, o *aws.S3Object) error {
+	return w.sendWithNotifications(s3, o, s3.archivedObjects.restoredNotifications(o, s3.notifications(o)))
+}
+
+func (w *S3ListerWorker) sendWithNotifications(s3 *S3List, o *aws.S3Object, notifications S3ObjectProcessNotifications) error {
+	if err := w.waitPause(s3); err != nil {
+		return err
+	}
+	// Using a select because w.out could be full
+	select {
+	case <-w.done:
+		logp.Info("Cancelling ListS3Objects")
+		return fmt.Errorf("Cancelling")
+	case w.out <- NewS3Object(o, s3.S3ReaderInformation, notifications):
+		w.wgS3Objects.Add(1)
+	}
+	return nil
+}
+
+// waitPause waits while the input of s3 is paused because of parse errors, so no more objects are
+// sent to be read during the pause
+func (w *S3ListerWorker) waitPause(s3 *S3List) error {
+	for paused := pausedFor(s3); paused > 0; paused = pausedFor(s3) {
+		logp.Info("Not sending S3 objects from S3 prefix URI %s because its input is paused during %v", s3.s3prefix.String(), paused)
+		select {
+		case <-w.done:
+			logp.Info("Cancelling ListS3Objects")
+			return fmt.Errorf("Cancelling")
+		case <-time.After(paused):
+		}
+	}
+	return nil
 }
 
 // Wait waits until all workers have finished
@@ -1,5 +1,9 @@
 package pipeline
 
+import (
+	"github.com/sequra/s3logsbeat/aws"
+)
+
 // S3ObjectProcessNotifications interface implemented by elements passed on event.Private
 type S3ObjectProcessNotifications interface {
 	// EventACKed executed when an event is ACKed
@@ -12,6 +16,22 @@ type S3ObjectProcessNotifications interface {
 	S3ObjectProcessed()
 }
 
+// S3ObjectFailureNotifications interface optionally implemented by S3 object process notifications
+// which need to know that an S3 object could not be read
+type S3ObjectFailureNotifications interface {
+	// S3ObjectFailed executed with the error when an S3 object could not be read (before S3ObjectProcessed)
+	S3ObjectFailed(err error)
+}
+
+// ObjectTracker tracks objects listed, avoiding to read again those already processed
+type ObjectTracker interface {
+	// Processed returns whether o has already been processed
+	Processed(o *aws.S3Object) bool
+
+	// Track obtains the notifications of the process of o
+	Track(o *aws.S3Object) S3ObjectProcessNotifications
+}
+
 type s3ObjectProcessNotificationsIgnorer struct{}
 
 // NewS3ObjectProcessNotificationsIgnorer creates an S3 object process notifications which ignores all events
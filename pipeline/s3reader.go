@@ -1,11 +1,19 @@
 package pipeline
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/elastic/beats/libbeat/common"
 
 	"github.com/sequra/s3logsbeat/aws"
+	"github.com/sequra/s3logsbeat/deadletter"
+	"github.com/sequra/s3logsbeat/logparser"
 
 	"github.com/elastic/beats/libbeat/beat"
 	"github.com/elastic/beats/libbeat/logp"
@@ -13,6 +21,9 @@ import (
 
 const (
 	s3ReaderWorkers = 5
+
+	// archiveMemberField key field containing the name of the file read from an archive
+	archiveMemberField = "archive_member"
 )
 
 type eventCounter interface {
@@ -22,20 +33,19 @@ type eventCounter interface {
 }
 
 // S3ReaderWorker is a worker to read objects from S3, parse their content, and send events to output
+// through the client of the input each object comes from
 type S3ReaderWorker struct {
 	wg          sync.WaitGroup
 	in          <-chan *S3Object
-	out         beat.Client
 	done        chan struct{}
 	wgEvents    eventCounter
 	wgS3Objects eventCounter
 }
 
 // NewS3ReaderWorker creates a new S3ReaderWorker
-func NewS3ReaderWorker(in <-chan *S3Object, out beat.Client, wgEvents eventCounter, wgS3Objects eventCounter) *S3ReaderWorker {
+func NewS3ReaderWorker(in <-chan *S3Object, wgEvents eventCounter, wgS3Objects eventCounter) *S3ReaderWorker {
 	return &S3ReaderWorker{
 		in:          in,
-		out:         out,
 		done:        make(chan struct{}),
 		wgEvents:    wgEvents,
 		wgS3Objects: wgS3Objects,
@@ -44,8 +54,6 @@ func NewS3ReaderWorker(in <-chan *S3Object, out beat.Client, wgEvents eventCount
 
 // Start starts the worker
 func (w *S3ReaderWorker) Start() {
-	s3 := aws.NewS3(aws.NewSession())
-
 	w.wg.Add(s3ReaderWorkers)
 	for n := 0; n < s3ReaderWorkers; n++ {
 		go func(workerID int) {
@@ -61,50 +69,219 @@ func (w *S3ReaderWorker) Start() {
 						logp.Info("S3 reader worker #%d finished because channel is closed", workerID)
 						return
 					}
-					w.onS3ObjectFromSQSMessage(s3, s3object)
+					w.onS3ObjectFromSQSMessage(s3object)
 				}
 			}
 		}(n)
 	}
 }
 
-func (w *S3ReaderWorker) onS3ObjectFromSQSMessage(s3 *aws.S3, s3object *S3Object) {
+func (w *S3ReaderWorker) onS3ObjectFromSQSMessage(s3object *S3Object) {
+	if s3object.deadLetterReplay {
+		w.replayDeadLetterObject(s3object)
+	} else {
+		w.readS3Object(s3object)
+	}
+
+	// Monitoring
+	w.wgS3Objects.Done()
+
+	// Counting how much remaining events are on this SQS message to delete it when all will be processed
+	s3object.s3ObjectProcessNotifications.S3ObjectProcessed()
+}
+
+// readS3Object downloads and parses an S3 object. Those lines that could not be parsed and the
+// object itself (if it could not be read) are written to dead-letter sink (if configured)
+func (w *S3ReaderWorker) readS3Object(s3object *S3Object) {
+	deadLetterBatch := s3object.deadLetter.NewBatch(s3object.S3Object, s3object.GetMetadataType())
+	defer func() {
+		if err := deadLetterBatch.Flush(); err != nil {
+			logp.Err("%v", err)
+		}
+	}()
+
+	logp.Debug("s3logsbeat", "Reading S3 object %s", s3object.String())
+	readCloser, err := s3object.getStorage().GetReadCloser(s3object.S3Object)
+	if err != nil {
+		w.wgS3Objects.Error(1)
+		s3object.failed(err)
+		logp.Err("Could not download S3 object %s. Error: %v", s3object.String(), err)
+		deadLetterBatch.AddObject(err)
+		return
+	}
+	defer readCloser.Close()
+
+	stats := &ParseStats{}
+	err = aws.ReadArchive(readCloser, func(member string, r io.Reader) error {
+		lineReader := logparser.NewLineReader(r)
+		err := w.parse(s3object, member, lineReader, lineReader, deadLetterBatch, stats)
+		stats.Read += lineReader.Line()
+		return err
+	})
+	if err != nil {
+		w.wgS3Objects.Error(1)
+		s3object.failed(err)
+		logp.Err("Could not read S3 object %s. Error: %v", s3object.String(), err)
+		deadLetterBatch.AddObject(err)
+		return
+	}
+	w.checkParseStats(s3object, stats)
+}
+
+// checkParseStats marks the object as failed if lines which could not be parsed exceed the parse error
+// threshold of its input, pausing the input if configured
+func (w *S3ReaderWorker) checkParseStats(s3object *S3Object, stats *ParseStats) {
+	stats.complete()
+	logp.Debug("s3logsbeat", "Parse stats of S3 object %s: %s", s3object.String(), stats.String())
+	c := s3object.parseErrors
+	if c == nil || !c.exceeded(stats) {
+		return
+	}
+	parseErrorThresholdExceeded.Add(1)
+	w.wgS3Objects.Error(1)
+	err := fmt.Errorf("%d of %d lines could not be parsed with log format %s on %s (threshold: %s)", stats.Failed, stats.Parsed+stats.Failed, s3object.GetMetadataType(), s3object.inputName, c.Max)
+	logp.Err("S3 object %s exceeded parse error threshold: %v. Check log_format of the input", s3object.String(), err)
+	s3object.failed(err)
+	if c.Pause > 0 {
+		logp.Err("Pausing %s during %v because of parse errors", s3object.inputName, c.Pause)
+		s3object.pause.pause(c.Pause)
+	}
+}
+
+// parse parses the content of reader and publishes the events generated from it.
+// pos obtains the position of the line being processed. member is the name of the file
+// being read when object is an archive. Lines parsed and failed are counted on stats
+func (w *S3ReaderWorker) parse(s3object *S3Object, member string, reader io.Reader, pos linePosition, deadLetterBatch *deadletter.Batch, stats *ParseStats) error {
 	keyFields, err := s3object.GetKeyFields(s3object.Key)
 	if err != nil {
 		logp.Warn("Get key fields error. Ignoring. Error: %v", err)
+		keyFields = &common.MapStr{}
+	}
+	if member != "" {
+		keyFields.Put(archiveMemberField, member)
+	}
+	var provenanceFields common.MapStr
+	if s3object.provenanceTarget != "" {
+		provenanceFields = s3object.provenanceFields()
 	}
 
-	onLogParserSucceed := func(event *beat.Event) {
+	publish := func(event *beat.Event) {
 		if event.Meta == nil {
 			event.Meta = common.MapStr{}
 		}
 		event.Meta["format"] = s3object.GetMetadataType()
 		event.Private = s3object.s3ObjectProcessNotifications // store to send ACK on complete
 		event.Fields.Update(*keyFields)
+		s3object.addProvenance(event, provenanceFields, pos)
 		s3object.s3ObjectProcessNotifications.EventSent()
 		w.wgEvents.Add(1)
-		w.out.Publish(*event)
+		s3object.client.Publish(*event)
 	}
 
 	onLogParserError := func(errLine string, err error) {
+		stats.Failed++
 		w.wgEvents.Error(1)
-		logp.Warn("Could not parse line: %s, reason: %+v", errLine, err)
+		deadLetterBatch.AddLine(errLine, pos.Line(), err)
+		if !s3object.publishParseErrors {
+			logp.Warn("Could not parse line: %s, reason: %+v", errLine, err)
+			return
+		}
+		publish(newParseErrorEvent(s3object, errLine, pos.Line(), err))
 	}
 
-	logp.Debug("s3logsbeat", "Reading S3 object %s", s3object.String())
-	if readCloser, err := s3.GetReadCloser(s3object.S3Object); err != nil {
+	onEvent := func(event *beat.Event) {
+		stats.Parsed++
+		publish(event)
+	}
+
+	return s3object.GetLogParser().Parse(reader, onEvent, onLogParserError)
+}
+
+// replayDeadLetterObject reads a dead-letter file and processes again its records: lines are
+// parsed with current log parser and objects are downloaded and parsed again
+func (w *S3ReaderWorker) replayDeadLetterObject(s3object *S3Object) {
+	logp.Debug("s3logsbeat", "Replaying dead-letter file %s", s3object.String())
+	readCloser, err := s3object.getStorage().GetReadCloser(s3object.S3Object)
+	if err != nil {
 		w.wgS3Objects.Error(1)
-		logp.Err("Could not download S3 object %s", s3object.String())
-	} else {
-		defer readCloser.Close()
-		s3object.GetLogParser().Parse(readCloser, onLogParserSucceed, onLogParserError)
+		s3object.failed(err)
+		logp.Err("Could not read dead-letter file %s. Error: %v", s3object.String(), err)
+		return
 	}
+	defer readCloser.Close()
 
-	// Monitoring
-	w.wgS3Objects.Done()
+	ri := s3object.forDeadLetterRecords()
+	deadLetterBatches := make(map[aws.S3Object]*deadletter.Batch)
+	defer func() {
+		for _, b := range deadLetterBatches {
+			if err := b.Flush(); err != nil {
+				logp.Err("%v", err)
+			}
+		}
+	}()
 
-	// Counting how much remaining events are on this SQS message to delete it when all will be processed
-	s3object.s3ObjectProcessNotifications.S3ObjectProcessed()
+	err = deadletter.ReadRecords(readCloser, func(r *deadletter.Record) error {
+		o := aws.NewS3Object(r.Bucket, r.Key)
+		o.LastModified = r.ObjectTime
+		original := NewS3Object(o, ri, s3object.s3ObjectProcessNotifications)
+		switch r.Type {
+		case deadletter.RecordTypeObject:
+			w.readS3Object(original)
+		case deadletter.RecordTypeLine:
+			b, ok := deadLetterBatches[*o]
+			if !ok {
+				b = ri.deadLetter.NewBatch(o, ri.GetMetadataType())
+				deadLetterBatches[*o] = b
+			}
+			w.parse(original, "", strings.NewReader(r.Message+"\n"), recordPosition(r.Line), b, &ParseStats{})
+		default:
+			logp.Warn("Ignoring unknown record type %s on dead-letter file %s", r.Type, s3object.String())
+		}
+		return nil
+	})
+	if err != nil {
+		w.wgS3Objects.Error(1)
+		s3object.failed(err)
+		logp.Err("Could not read dead-letter file %s. Error: %v", s3object.String(), err)
+	}
+}
+
+// newParseErrorEvent creates an event containing a line that could not be parsed.
+// As no timestamp can be extracted from the line, object time is used instead
+func newParseErrorEvent(s3object *S3Object, line string, lineNumber uint64, err error) *beat.Event {
+	line = strings.TrimRight(line, "\r\n")
+	timestamp := s3object.Time()
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "s3://%s/%s:%d:%s", s3object.Bucket, s3object.Key, lineNumber, line)
+	return &beat.Event{
+		Timestamp: timestamp,
+		Fields: common.MapStr{
+			"message": line,
+			"error": common.MapStr{
+				"message": err.Error(),
+			},
+			"aws": common.MapStr{
+				"s3": common.MapStr{
+					"bucket": common.MapStr{
+						"name": s3object.Bucket,
+					},
+					"object": common.MapStr{
+						"key": s3object.Key,
+					},
+				},
+			},
+			"log": common.MapStr{
+				"line": lineNumber,
+			},
+		},
+		Meta: common.MapStr{
+			"_id": hex.EncodeToString(h.Sum(nil)),
+		},
+	}
 }
 
 // Wait waits until all workers have finished
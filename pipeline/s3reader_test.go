@@ -0,0 +1,34 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func TestNewParseErrorEvent(t *testing.T) {
+	o := aws.NewS3Object("mybucket", "mykey.log")
+	o.LastModified = time.Date(2019, 3, 23, 17, 4, 53, 0, time.UTC)
+	s3object := NewS3Object(o, &S3ReaderInformation{}, NewS3ObjectProcessNotificationsIgnorer())
+
+	event := newParseErrorEvent(s3object, "invalid line\n", 3, fmt.Errorf("Line does not match expected format"))
+
+	assert.Equal(t, o.LastModified, event.Timestamp)
+	message, _ := event.Fields.GetValue("message")
+	assert.Equal(t, "invalid line", message)
+	errorMessage, _ := event.Fields.GetValue("error.message")
+	assert.Equal(t, "Line does not match expected format", errorMessage)
+	bucket, _ := event.Fields.GetValue("aws.s3.bucket.name")
+	assert.Equal(t, "mybucket", bucket)
+	key, _ := event.Fields.GetValue("aws.s3.object.key")
+	assert.Equal(t, "mykey.log", key)
+	line, _ := event.Fields.GetValue("log.line")
+	assert.Equal(t, uint64(3), line)
+	assert.NotEmpty(t, event.Meta["_id"])
+}
@@ -3,16 +3,37 @@ package pipeline
 import (
 	"fmt"
 	"regexp"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/elastic/beats/libbeat/beat"
 	"github.com/elastic/beats/libbeat/common"
+	"github.com/sequra/s3logsbeat/aws"
+	"github.com/sequra/s3logsbeat/deadletter"
 	"github.com/sequra/s3logsbeat/logparser"
 )
 
 // S3ReaderInformation information present on inputs needed at S3 reader stage
 type S3ReaderInformation struct {
-	logParser      logparser.LogParser
-	keyRegexFields *regexp.Regexp
-	metadataType   string
+	logParser          logparser.LogParser
+	keyRegexFields     *regexp.Regexp
+	metadataType       string
+	publishParseErrors bool
+	storage            ObjectStorage
+	deadLetter         *deadletter.Sink
+	deadLetterReplay   bool
+	provenanceTarget   string
+	client             beat.Client
+	downloadRetries    int
+	parallelDownload   *aws.ParallelDownloadConfig
+	objectFilter       ObjectFilterConfig
+	archivedObjects    *ArchivedObjects
+	encryption         *aws.Encryption
+	session            *session.Session
+	s3                 *aws.S3
+	inputName          string
+	parseErrors        *ParseErrorThresholdConfig
+	pause              *inputPause
 }
 
 // NewS3ReaderInformation creates a new S3 reader information
@@ -24,6 +45,137 @@ func NewS3ReaderInformation(logParser logparser.LogParser, keyRegexFields *regex
 	}
 }
 
+// WithPublishParseErrors configures the reader to publish lines that could not be parsed
+// as error events instead of dropping them
+func (ri *S3ReaderInformation) WithPublishParseErrors(publishParseErrors bool) *S3ReaderInformation {
+	ri.publishParseErrors = publishParseErrors
+	return ri
+}
+
+// WithStorage configures the storage from which objects are read (S3 by default)
+func (ri *S3ReaderInformation) WithStorage(storage ObjectStorage) *S3ReaderInformation {
+	ri.storage = storage
+	return ri
+}
+
+// WithDeadLetter configures the sink to which failed lines and objects are written
+func (ri *S3ReaderInformation) WithDeadLetter(deadLetter *deadletter.Sink) *S3ReaderInformation {
+	ri.deadLetter = deadLetter
+	return ri
+}
+
+// WithDeadLetterReplay configures the reader to read objects as dead-letter files, processing
+// again the lines and objects present on them
+func (ri *S3ReaderInformation) WithDeadLetterReplay() *S3ReaderInformation {
+	ri.deadLetterReplay = true
+	return ri
+}
+
+// WithProvenance configures the reader to add information about where events come from
+// on target (ProvenanceTargetFields or ProvenanceTargetMetadata)
+func (ri *S3ReaderInformation) WithProvenance(target string) *S3ReaderInformation {
+	ri.provenanceTarget = target
+	return ri
+}
+
+// WithClient configures the client through which events are published
+func (ri *S3ReaderInformation) WithClient(client beat.Client) *S3ReaderInformation {
+	ri.client = client
+	return ri
+}
+
+// WithDownloadRetries configures how many times an interrupted download of an S3 object is resumed
+func (ri *S3ReaderInformation) WithDownloadRetries(downloadRetries int) *S3ReaderInformation {
+	ri.downloadRetries = downloadRetries
+	return ri
+}
+
+// WithParallelDownload configures how large S3 objects are downloaded in parallel (nil disables it)
+func (ri *S3ReaderInformation) WithParallelDownload(parallelDownload *aws.ParallelDownloadConfig) *S3ReaderInformation {
+	ri.parallelDownload = parallelDownload
+	return ri
+}
+
+// WithSession configures the AWS session of the input, used to read its S3 objects
+func (ri *S3ReaderInformation) WithSession(session *session.Session) *S3ReaderInformation {
+	ri.session = session
+	ri.s3 = aws.NewS3(session)
+	return ri
+}
+
+// GetSession obtains the AWS session of the input (the default one if not configured)
+func (ri *S3ReaderInformation) GetSession() *session.Session {
+	if ri.session != nil {
+		return ri.session
+	}
+	return aws.NewSession()
+}
+
+// WithEncryption configures how encrypted S3 objects are read (nil reads them as plain objects)
+func (ri *S3ReaderInformation) WithEncryption(encryption *aws.Encryption) *S3ReaderInformation {
+	ri.encryption = encryption
+	return ri
+}
+
+// WithObjectFilter configures which S3 objects are processed (the others are skipped)
+func (ri *S3ReaderInformation) WithObjectFilter(objectFilter ObjectFilterConfig) *S3ReaderInformation {
+	ri.objectFilter = objectFilter
+	return ri
+}
+
+// WithArchivedObjects configures how objects stored on Glacier or Glacier Deep Archive are handled
+// when listing (nil skips them)
+func (ri *S3ReaderInformation) WithArchivedObjects(archivedObjects *ArchivedObjects) *S3ReaderInformation {
+	ri.archivedObjects = archivedObjects
+	return ri
+}
+
+// WithInputName configures the name of the input, used to identify it on errors
+func (ri *S3ReaderInformation) WithInputName(inputName string) *S3ReaderInformation {
+	ri.inputName = inputName
+	return ri
+}
+
+// WithParseErrorThreshold configures when objects are considered failed because too many lines could
+// not be parsed (and whether input is paused then)
+func (ri *S3ReaderInformation) WithParseErrorThreshold(parseErrors *ParseErrorThresholdConfig) *S3ReaderInformation {
+	ri.parseErrors = parseErrors
+	ri.pause = &inputPause{}
+	return ri
+}
+
+// pausedFor obtains the time the input remains paused because of parse errors (0 if not paused)
+func (ri *S3ReaderInformation) pausedFor() time.Duration {
+	if ri.pause == nil {
+		return 0
+	}
+	return ri.pause.remaining()
+}
+
+// forDeadLetterRecords obtains the information used to process records present on
+// dead-letter files, which reference objects stored on S3
+func (ri *S3ReaderInformation) forDeadLetterRecords() *S3ReaderInformation {
+	r := *ri
+	r.storage = nil
+	r.deadLetterReplay = false
+	return &r
+}
+
+// getStorage obtains the storage from which objects are read: S3 with the session of the input
+// (or the default one) if no storage is configured
+func (ri *S3ReaderInformation) getStorage() ObjectStorage {
+	if ri.storage != nil {
+		return ri.storage
+	}
+	s3 := ri.s3
+	if s3 == nil {
+		s3 = aws.NewS3(aws.NewSession())
+	}
+	return s3.WithResumeRetries(ri.downloadRetries).
+		WithParallelDownload(ri.parallelDownload).
+		WithEncryption(ri.encryption)
+}
+
 // GetLogParser obtains the log parser
 func (ri *S3ReaderInformation) GetLogParser() logparser.LogParser {
 	return ri.logParser
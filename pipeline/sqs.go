@@ -1,6 +1,10 @@
 package pipeline
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/sequra/s3logsbeat/aws"
 )
@@ -9,6 +13,15 @@ import (
 type SQS struct {
 	*aws.SQS
 	*S3ReaderInformation
+	receiveLoop         *ReceiveLoop
+	visibilityExtension *VisibilityExtensionConfig
+	batchConfig         *SQSBatchConfig
+	batcherOnce         sync.Once
+	batcher             *sqsBatcher
+	retry               *SQSRetryConfig
+	deadLetterQueue     *aws.SQS
+	snsVerifier         *aws.SNSVerifier
+	pending             sync.WaitGroup
 }
 
 // NewSQS creates a new SQS to be sent thru pipeline
@@ -18,3 +31,92 @@ func NewSQS(session *session.Session, queueURL *string, ri *S3ReaderInformation)
 		S3ReaderInformation: ri,
 	}
 }
+
+// WithWaitTime configures the time receives wait for messages to arrive when queue is empty (long polling)
+func (s *SQS) WithWaitTime(waitTime time.Duration) *SQS {
+	s.SQS = s.SQS.WithWaitTime(waitTime)
+	return s
+}
+
+// WithReceiveLoop configures the SQS to be polled continuously by its own receive loop
+func (s *SQS) WithReceiveLoop(receiveLoop *ReceiveLoop) *SQS {
+	s.receiveLoop = receiveLoop
+	return s
+}
+
+// WithVisibilityExtension configures the heartbeat which extends the visibility timeout of the messages
+// received while they are being processed
+func (s *SQS) WithVisibilityExtension(visibilityExtension *VisibilityExtensionConfig) *SQS {
+	s.visibilityExtension = visibilityExtension
+	return s
+}
+
+// WithBatch configures how deletes and visibility changes of the messages received are batched
+func (s *SQS) WithBatch(batchConfig *SQSBatchConfig) *SQS {
+	s.batchConfig = batchConfig
+	return s
+}
+
+// WithRetry configures what is done with the messages whose S3 objects could not be read
+func (s *SQS) WithRetry(retry *SQSRetryConfig) *SQS {
+	s.retry = retry
+	if retry.DeadLetterQueueURL != "" {
+		s.deadLetterQueue = s.SQS.WithURL(&retry.DeadLetterQueueURL)
+	}
+	return s
+}
+
+// WithSNSVerifier configures the verifier of the signature of S3 events received thru SNS
+func (s *SQS) WithSNSVerifier(snsVerifier *aws.SNSVerifier) *SQS {
+	s.snsVerifier = snsVerifier
+	return s
+}
+
+// GetReceiveLoop obtains the receive loop of the SQS (nil if not polled continuously)
+func (s *SQS) GetReceiveLoop() *ReceiveLoop {
+	return s.receiveLoop
+}
+
+// Poll receives messages from SQS queue
+func (s *SQS) Poll(ctx context.Context, keepOnCompleted bool, mh func(QueueMessage) error) (int, bool, error) {
+	return s.ReceiveMessages(ctx, func(message *aws.SQSMessage) error {
+		return mh(NewSQSMessage(s, message, keepOnCompleted))
+	})
+}
+
+// getBatcher obtains the batcher of deletes and visibility changes of the messages received, started
+// on first use
+func (s *SQS) getBatcher() *sqsBatcher {
+	s.batcherOnce.Do(func() {
+		c := s.batchConfig
+		if c == nil {
+			c = &DefaultSQSBatchConfig
+		}
+		s.batcher = newSQSBatcher(s.SQS, c)
+	})
+	return s.batcher
+}
+
+// getRetry obtains the retry config of messages whose S3 objects could not be read
+func (s *SQS) getRetry() *SQSRetryConfig {
+	if s.retry == nil {
+		return &DefaultSQSRetryConfig
+	}
+	return s.retry
+}
+
+// async executes f on its own goroutine, waiting for it on Close
+func (s *SQS) async(f func()) {
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		f()
+	}()
+}
+
+// Close sends pending deletes and visibility changes of messages. Once closed, they are sent directly
+func (s *SQS) Close() error {
+	s.pending.Wait()
+	s.getBatcher().close()
+	return nil
+}
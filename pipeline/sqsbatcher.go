@@ -0,0 +1,228 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+const (
+	// sqsBatcherQueueSize number of requests which can be pending to be batched before blocking
+	sqsBatcherQueueSize = 1024
+)
+
+var (
+	sqsBatchRequests = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.batchRequests")
+	sqsBatchRetries  = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.batchRetries")
+	sqsDeleteErrors  = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.deleteError")
+)
+
+// SQSBatchConfig configures how deletes and visibility changes of SQS messages are batched. Requests
+// are sent once SQSMaxBatchEntries are collected or each FlushInterval. Entries which fail are retried
+// up to Retries times (unless failure is caused by the request itself, like an invalid receipt handle)
+type SQSBatchConfig struct {
+	FlushInterval time.Duration `config:"flush_interval" validate:"min=0, nonzero"`
+	Retries       int           `config:"retries" validate:"min=0"`
+}
+
+// DefaultSQSBatchConfig batch config used if no one is configured
+var DefaultSQSBatchConfig = SQSBatchConfig{
+	FlushInterval: 1 * time.Second,
+	Retries:       3,
+}
+
+// sqsBatchEntry delete or visibility change of a message. done is executed with the result once
+// the request has been sent (and retried if needed)
+type sqsBatchEntry struct {
+	receiptHandle     *string
+	visibilityTimeout time.Duration
+	attempts          int
+	done              func(error)
+}
+
+// sqsBatcher collects deletes and visibility changes of the messages of a queue and sends them on
+// batch requests from its own goroutine, keeping network calls out of the ACK path
+type sqsBatcher struct {
+	sqs               *aws.SQS
+	config            *SQSBatchConfig
+	deletes           chan *sqsBatchEntry
+	visibilityChanges chan *sqsBatchEntry
+	mutex             sync.RWMutex
+	stopped           bool
+	closing           chan struct{}
+	closed            chan struct{}
+}
+
+func newSQSBatcher(sqs *aws.SQS, config *SQSBatchConfig) *sqsBatcher {
+	b := &sqsBatcher{
+		sqs:               sqs,
+		config:            config,
+		deletes:           make(chan *sqsBatchEntry, sqsBatcherQueueSize),
+		visibilityChanges: make(chan *sqsBatchEntry, sqsBatcherQueueSize),
+		closing:           make(chan struct{}),
+		closed:            make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// deleteMessage deletes the message with receiptHandle on next batch
+func (b *sqsBatcher) deleteMessage(receiptHandle *string, done func(error)) {
+	b.add(b.deletes, &sqsBatchEntry{receiptHandle: receiptHandle, done: done})
+}
+
+// changeMessageVisibility changes the visibility timeout of the message with receiptHandle on next batch
+func (b *sqsBatcher) changeMessageVisibility(receiptHandle *string, timeout time.Duration, done func(error)) {
+	b.add(b.visibilityChanges, &sqsBatchEntry{receiptHandle: receiptHandle, visibilityTimeout: timeout, done: done})
+}
+
+// add adds e to be sent on next batch. Once closed, e is sent directly
+func (b *sqsBatcher) add(entries chan *sqsBatchEntry, e *sqsBatchEntry) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if !b.stopped {
+		entries <- e
+		return
+	}
+	for pending := []*sqsBatchEntry{e}; len(pending) > 0; {
+		if entries == b.deletes {
+			pending = b.flushDeletes(pending)
+		} else {
+			pending = b.flushVisibilityChanges(pending)
+		}
+	}
+}
+
+func (b *sqsBatcher) run() {
+	defer close(b.closed)
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+
+	var deletes, visibilityChanges []*sqsBatchEntry
+	for {
+		select {
+		case e := <-b.deletes:
+			if deletes = append(deletes, e); len(deletes) >= aws.SQSMaxBatchEntries {
+				deletes = b.flushDeletes(deletes)
+			}
+		case e := <-b.visibilityChanges:
+			if visibilityChanges = append(visibilityChanges, e); len(visibilityChanges) >= aws.SQSMaxBatchEntries {
+				visibilityChanges = b.flushVisibilityChanges(visibilityChanges)
+			}
+		case <-ticker.C:
+			// Visibility changes first, as they would fail once messages are deleted
+			visibilityChanges = b.flushVisibilityChanges(visibilityChanges)
+			deletes = b.flushDeletes(deletes)
+		case <-b.closing:
+			// No more entries are added once closing
+			for drained := false; !drained; {
+				select {
+				case e := <-b.deletes:
+					deletes = append(deletes, e)
+				case e := <-b.visibilityChanges:
+					visibilityChanges = append(visibilityChanges, e)
+				default:
+					drained = true
+				}
+			}
+			for len(visibilityChanges) > 0 {
+				visibilityChanges = b.flushVisibilityChanges(visibilityChanges)
+			}
+			for len(deletes) > 0 {
+				deletes = b.flushDeletes(deletes)
+			}
+			return
+		}
+	}
+}
+
+// flushDeletes deletes messages of entries on batches. Returns the entries to be retried
+func (b *sqsBatcher) flushDeletes(entries []*sqsBatchEntry) []*sqsBatchEntry {
+	var retry []*sqsBatchEntry
+	for len(entries) > 0 {
+		batch := nextBatch(entries)
+		entries = entries[len(batch):]
+		receiptHandles := make([]*string, len(batch))
+		for i, e := range batch {
+			receiptHandles[i] = e.receiptHandle
+		}
+		logp.Debug("s3logsbeat", "Deleting %d messages from SQS queue %s", len(batch), b.sqs.String())
+		sqsBatchRequests.Add(1)
+		failed, err := b.sqs.DeleteMessageBatch(receiptHandles)
+		retry = append(retry, b.complete(batch, failed, err)...)
+	}
+	return retry
+}
+
+// flushVisibilityChanges changes visibility of messages of entries on batches. Returns the entries to
+// be retried
+func (b *sqsBatcher) flushVisibilityChanges(entries []*sqsBatchEntry) []*sqsBatchEntry {
+	var retry []*sqsBatchEntry
+	for len(entries) > 0 {
+		batch := nextBatch(entries)
+		entries = entries[len(batch):]
+		changes := make([]*aws.SQSVisibilityChange, len(batch))
+		for i, e := range batch {
+			changes[i] = &aws.SQSVisibilityChange{ReceiptHandle: e.receiptHandle, VisibilityTimeout: e.visibilityTimeout}
+		}
+		logp.Debug("s3logsbeat", "Changing visibility of %d messages from SQS queue %s", len(batch), b.sqs.String())
+		sqsBatchRequests.Add(1)
+		failed, err := b.sqs.ChangeMessageVisibilityBatch(changes)
+		retry = append(retry, b.complete(batch, failed, err)...)
+	}
+	return retry
+}
+
+// complete notifies the result of each entry of batch, whose request returned failed entries and err.
+// Returns the entries to be retried
+func (b *sqsBatcher) complete(batch []*sqsBatchEntry, failed map[int]*aws.SQSBatchError, err error) []*sqsBatchEntry {
+	var retry []*sqsBatchEntry
+	for i, e := range batch {
+		entryErr, senderFault := err, false
+		if f, ok := failed[i]; ok {
+			entryErr, senderFault = f, f.SenderFault
+		}
+		if entryErr == nil {
+			e.done(nil)
+			continue
+		}
+		e.attempts++
+		if !senderFault && e.attempts <= b.config.Retries {
+			sqsBatchRetries.Add(1)
+			retry = append(retry, e)
+			continue
+		}
+		e.done(entryErr)
+	}
+	return retry
+}
+
+// close sends pending entries and stops batching
+func (b *sqsBatcher) close() {
+	b.mutex.Lock()
+	if b.stopped {
+		b.mutex.Unlock()
+		return
+	}
+	b.stopped = true
+	b.mutex.Unlock()
+	close(b.closing)
+	<-b.closed
+}
+
+// nextBatch obtains the first entries to be sent on a batch: up to SQSMaxBatchEntries, and only until
+// a receipt handle is repeated, so requests of the same message are sent in order
+func nextBatch(entries []*sqsBatchEntry) []*sqsBatchEntry {
+	receiptHandles := make(map[string]bool)
+	for i, e := range entries {
+		if i == aws.SQSMaxBatchEntries || receiptHandles[*e.receiptHandle] {
+			return entries[:i]
+		}
+		receiptHandles[*e.receiptHandle] = true
+	}
+	return entries
+}
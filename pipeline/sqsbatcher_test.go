@@ -0,0 +1,182 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+// sqsBatchServer fake SQS batch API. Receipt handles starting with "transient" fail the first time
+// and "invalid" ones always fail (as sender fault)
+type sqsBatchServer struct {
+	mutex    sync.Mutex
+	batches  [][]string
+	attempts map[string]int
+}
+
+func (s *sqsBatchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r.ParseForm()
+	action := r.Form.Get("Action")
+	prefix := action + "RequestEntry"
+	var handles []string
+	var result strings.Builder
+	for i := 1; r.Form.Get(fmt.Sprintf("%s.%d.Id", prefix, i)) != ""; i++ {
+		id := r.Form.Get(fmt.Sprintf("%s.%d.Id", prefix, i))
+		handle := r.Form.Get(fmt.Sprintf("%s.%d.ReceiptHandle", prefix, i))
+		handles = append(handles, handle)
+		s.attempts[handle]++
+		switch {
+		case handle == "invalid":
+			fmt.Fprintf(&result, "<BatchResultErrorEntry><Id>%s</Id><Code>ReceiptHandleIsInvalid</Code><Message>invalid</Message><SenderFault>true</SenderFault></BatchResultErrorEntry>", id)
+		case strings.HasPrefix(handle, "transient") && s.attempts[handle] == 1:
+			fmt.Fprintf(&result, "<BatchResultErrorEntry><Id>%s</Id><Code>InternalError</Code><Message>retry</Message><SenderFault>false</SenderFault></BatchResultErrorEntry>", id)
+		default:
+			fmt.Fprintf(&result, "<%sResultEntry><Id>%s</Id></%sResultEntry>", action, id, action)
+		}
+	}
+	s.batches = append(s.batches, handles)
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, "<%sResponse><%sResult>%s</%sResult><ResponseMetadata><RequestId>id</RequestId></ResponseMetadata></%sResponse>", action, action, result.String(), action, action)
+}
+
+func (s *sqsBatchServer) get() [][]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]string{}, s.batches...)
+}
+
+func newTestSQSBatcher(t *testing.T, c *SQSBatchConfig) (*sqsBatcher, *sqsBatchServer, func()) {
+	server := &sqsBatchServer{attempts: map[string]int{}}
+	httpServer := httptest.NewServer(server)
+	sess, err := session.NewSession(&awssdk.Config{
+		Region:      awssdk.String("eu-west-1"),
+		Endpoint:    awssdk.String(httpServer.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	assert.NoError(t, err)
+	return newSQSBatcher(aws.NewSQS(sess, awssdk.String(httpServer.URL+"/123456789012/logs")), c), server, httpServer.Close
+}
+
+// results collects the results of entries
+type results struct {
+	mutex  sync.Mutex
+	wg     sync.WaitGroup
+	errors map[string]error
+}
+
+func newResults() *results {
+	return &results{errors: map[string]error{}}
+}
+
+func (r *results) done(handle string) func(error) {
+	r.wg.Add(1)
+	return func(err error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.errors[handle] = err
+		r.wg.Done()
+	}
+}
+
+func TestSQSBatcherFlushesOnSize(t *testing.T) {
+	b, server, closeServer := newTestSQSBatcher(t, &SQSBatchConfig{FlushInterval: time.Hour})
+	defer closeServer()
+	defer b.close()
+
+	r := newResults()
+	for i := 0; i < 12; i++ {
+		handle := fmt.Sprintf("r%d", i)
+		b.deleteMessage(awssdk.String(handle), r.done(handle))
+	}
+	for start := time.Now(); len(server.get()) == 0 && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	batches := server.get()
+	if assert.Len(t, batches, 1) {
+		assert.Len(t, batches[0], aws.SQSMaxBatchEntries)
+	}
+
+	// Remaining entries are sent on close
+	b.close()
+	r.wg.Wait()
+	assert.Len(t, server.get(), 2)
+	assert.Len(t, r.errors, 12)
+	for _, err := range r.errors {
+		assert.NoError(t, err)
+	}
+}
+
+func TestSQSBatcherRetriesFailedEntries(t *testing.T) {
+	b, server, closeServer := newTestSQSBatcher(t, &SQSBatchConfig{FlushInterval: 10 * time.Millisecond, Retries: 3})
+	defer closeServer()
+	defer b.close()
+
+	r := newResults()
+	b.changeMessageVisibility(awssdk.String("ok"), time.Minute, r.done("ok"))
+	b.deleteMessage(awssdk.String("transient"), r.done("transient"))
+	b.deleteMessage(awssdk.String("invalid"), r.done("invalid"))
+	r.wg.Wait()
+
+	assert.NoError(t, r.errors["ok"])
+	assert.NoError(t, r.errors["transient"])
+	if assert.Error(t, r.errors["invalid"]) {
+		assert.Contains(t, r.errors["invalid"].Error(), "ReceiptHandleIsInvalid")
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	assert.Equal(t, 2, server.attempts["transient"])
+	assert.Equal(t, 1, server.attempts["invalid"])
+	assert.Equal(t, 1, server.attempts["ok"])
+}
+
+func TestSQSBatcherReportsEntriesFailedAfterRetries(t *testing.T) {
+	b, server, closeServer := newTestSQSBatcher(t, &SQSBatchConfig{FlushInterval: 10 * time.Millisecond, Retries: 0})
+	defer closeServer()
+	defer b.close()
+
+	r := newResults()
+	b.deleteMessage(awssdk.String("transient"), r.done("transient"))
+	r.wg.Wait()
+	assert.Error(t, r.errors["transient"])
+	assert.Len(t, server.get(), 1)
+}
+
+func TestSQSBatcherSendsDirectlyOnceClosed(t *testing.T) {
+	b, server, closeServer := newTestSQSBatcher(t, &SQSBatchConfig{FlushInterval: time.Hour})
+	defer closeServer()
+
+	b.close()
+	r := newResults()
+	b.deleteMessage(awssdk.String("r0"), r.done("r0"))
+	r.wg.Wait()
+	assert.NoError(t, r.errors["r0"])
+	assert.Equal(t, [][]string{{"r0"}}, server.get())
+}
+
+func TestSQSBatcherSendsRequestsOfSameMessageInOrder(t *testing.T) {
+	b, server, closeServer := newTestSQSBatcher(t, &SQSBatchConfig{FlushInterval: time.Hour})
+	defer closeServer()
+
+	r := newResults()
+	b.changeMessageVisibility(awssdk.String("r0"), time.Minute, r.done("r0-heartbeat"))
+	b.changeMessageVisibility(awssdk.String("r1"), time.Minute, r.done("r1"))
+	b.changeMessageVisibility(awssdk.String("r0"), 30*time.Second, r.done("r0-retry"))
+	b.close()
+	r.wg.Wait()
+	assert.Equal(t, [][]string{{"r0", "r1"}, {"r0"}}, server.get())
+}
@@ -2,121 +2,195 @@ package pipeline
 
 import (
 	"fmt"
-	"sync"
+	"time"
 
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
 
 	"github.com/sequra/s3logsbeat/aws"
 )
 
+var (
+	sqsMessagesSNS        = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.sns")
+	snsVerificationErrors = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.snsVerificationError")
+)
+
 // SQSMessage SQS message to be passed thru pipeline.
 // We have to keep how much S3 objects and how much events
 // are generated from this message in order to delete it
-// from SQS once it finishes
+// from SQS once it finishes.
+// While objects or events are outstanding, the message is kept invisible to
+// other consumers extending its visibility timeout (if configured).
+// If any S3 object could not be read, the message is not deleted but retried
+// after a back-off (or sent to a dead-letter queue once attempts are exhausted)
 type SQSMessage struct {
 	*aws.SQSMessage
+	*completionTracker
 
-	sqs *SQS
-
-	// Control S3 objects to be processed and events to be acked
-	mutex           *sync.Mutex
-	s3objects       uint64
-	events          uint64
-	keepOnCompleted bool
-
-	// Events
-	onDeleteCallbacks []func()
+	sqs           *SQS
+	receivedAt    time.Time
+	keptInvisible bool
 }
 
 // NewSQSMessage is a construct function for creating the object
 // with session and url of the queue as arguments
 func NewSQSMessage(sqs *SQS, sqsMessage *aws.SQSMessage, keepOnCompleted bool) *SQSMessage {
-	return &SQSMessage{
-		SQSMessage:      sqsMessage,
-		sqs:             sqs,
-		mutex:           &sync.Mutex{},
-		keepOnCompleted: keepOnCompleted,
+	s := &SQSMessage{
+		SQSMessage: sqsMessage,
+		sqs:        sqs,
+		receivedAt: time.Now(),
 	}
+	s.completionTracker = newCompletionTracker(fmt.Sprintf("SQS message with ID %s", *sqsMessage.MessageId), keepOnCompleted, s.delete)
+	return s
 }
 
-// Events
-
-// OnDelete adds callback for OnDelete event
-func (s *SQSMessage) OnDelete(f func()) {
-	s.onDeleteCallbacks = append(s.onDeleteCallbacks, f)
+// delete deletes the message from queue if all its S3 objects have been read or retries it otherwise
+func (s *SQSMessage) delete(failures []string) {
+	if len(failures) > 0 {
+		s.retry(failures)
+		return
+	}
+	logp.Debug("s3logsbeat", "Deleting SQS message with ID %s because it has been fully processed", *s.MessageId)
+	messageID := *s.MessageId
+	s.sqs.getBatcher().deleteMessage(s.ReceiptHandle, func(err error) {
+		if err != nil {
+			sqsDeleteErrors.Add(1)
+			logp.Err("Couldn't delete SQS message with ID %s. Error: %v", messageID, err)
+		}
+	})
 }
 
-func (s *SQSMessage) deleteOnJobCompleted() {
-	if s.s3objects == 0 && s.events == 0 {
-		s.delete()
+// retry keeps the message on queue to be received again after a back-off based on the number of times
+// it has been received. Once attempts are exhausted, message is sent to dead-letter queue (if configured)
+func (s *SQSMessage) retry(failures []string) {
+	sqsMessagesFailed.Add(1)
+	c := s.sqs.getRetry()
+	receiveCount := s.ReceiveCount()
+	if c.exhausted(receiveCount) {
+		s.sendToDeadLetterQueue(c, receiveCount, failures)
+		return
 	}
+	backoff := c.backoff(receiveCount)
+	logp.Warn("%d S3 objects present on SQS message with ID %s could not be read. Retrying it in %v (received %d times)", len(failures), *s.MessageId, backoff, receiveCount)
+	s.retryIn(backoff)
 }
 
-func (s *SQSMessage) delete() {
-	if !s.keepOnCompleted {
-		logp.Debug("s3logsbeat", "Deleting SQS message with ID %s because it has been fully processed", *s.MessageId)
-		if err := s.sqs.DeleteMessage(s.ReceiptHandle); err != nil {
-			logp.Err("Couldn't delete SQS message with ID %s. Error: %v", *s.MessageId, err)
+// retryIn makes the message visible on queue after backoff
+func (s *SQSMessage) retryIn(backoff time.Duration) {
+	messageID := *s.MessageId
+	s.sqs.getBatcher().changeMessageVisibility(s.ReceiptHandle, backoff, func(err error) {
+		if err != nil {
+			logp.Err("Couldn't change visibility of SQS message with ID %s to retry it. Error: %v", messageID, err)
 		}
-	}
-	for _, c := range s.onDeleteCallbacks {
-		c()
-	}
+	})
 }
 
-// ExtractNewS3Objects extracts those new S3 objects present on an SQS message
-// This function is executed on a mutex to avoid the following case:
-// Time 0 -> Goroutine A (GA) : executes ExtractNewS3Objects with first S3 element and keeps on the loop
-// Time 1 -> Goroutine B (GB) : downloads S3 object and is empty. It executes DeleteOnJobCompleted and deletes SQS message
-// Time 2 -> app crashes
-// Problem: as SQS message has already been deleted, it can not be processed again
-func (s *SQSMessage) ExtractNewS3Objects(mh func(s3object *S3Object) error) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	s3event := aws.NewSQSMessageS3Event(s.SQSMessage)
-	c, err := s3event.ExtractNewObjects(func(awsS3Object *aws.S3Object) error {
-		return mh(NewS3Object(awsS3Object, s.sqs.S3ReaderInformation, s))
+// sendToDeadLetterQueue sends the message with the failure reasons to dead-letter queue, deleting it
+// from queue once sent. If it can not be sent, it is retried later
+func (s *SQSMessage) sendToDeadLetterQueue(c *SQSRetryConfig, receiveCount int, failures []string) {
+	logp.Warn("SQS message with ID %s could not be processed after being received %d times. Sending it to dead-letter queue %s", *s.MessageId, receiveCount, c.DeadLetterQueueURL)
+	messageID := *s.MessageId
+	attributes := deadLetterAttributes(s.sqs.String(), receiveCount, failures)
+	s.sqs.async(func() {
+		if err := s.sqs.deadLetterQueue.SendMessage(s.Body, attributes); err != nil {
+			sqsDeadLetterErrors.Add(1)
+			logp.Err("Couldn't send SQS message with ID %s to dead-letter queue %s. Error: %v", messageID, c.DeadLetterQueueURL, err)
+			s.retryIn(c.backoff(receiveCount))
+			return
+		}
+		sqsMessagesDeadLettered.Add(1)
+		s.sqs.getBatcher().deleteMessage(s.ReceiptHandle, func(err error) {
+			if err != nil {
+				sqsDeleteErrors.Add(1)
+				logp.Err("Couldn't delete SQS message with ID %s sent to dead-letter queue. Error: %v", messageID, err)
+			}
+		})
 	})
+}
 
-	if err != nil {
-		return err
+// keepInvisible extends the visibility timeout of the message now and each half of the configured step
+// until the message is deleted or the maximum visibility is reached. It is started once, before the
+// first S3 object of the message is passed
+func (s *SQSMessage) keepInvisible() {
+	c := s.sqs.visibilityExtension
+	if c == nil || c.Step <= 0 || s.keptInvisible {
+		return
 	}
-
-	if c == 0 {
-		logp.Warn("No S3 objects extracted from SQS message with ID %s", *s.MessageId)
-		s.delete()
-	} else {
-		s.s3objects += c
+	s.keptInvisible = true
+	if !s.extendVisibility(c) {
+		return
 	}
-	return nil
+	go func() {
+		ticker := time.NewTicker(c.Step / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.completed:
+				return
+			case <-ticker.C:
+				if !s.extendVisibility(c) {
+					return
+				}
+			}
+		}
+	}()
 }
 
-// S3ObjectProcessNotifications implementations
-
-// S3ObjectProcessed reduces the number of pending S3 objects to process and executed DeleteOnJobCompleted
-func (s *SQSMessage) S3ObjectProcessed() {
+// extendVisibility extends the visibility timeout of the message. Returns false if visibility must not
+// be extended anymore (message deleted or maximum visibility reached)
+func (s *SQSMessage) extendVisibility(c *VisibilityExtensionConfig) bool {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.s3objects--
-	s.deleteOnJobCompleted()
+	select {
+	case <-s.completed:
+		return false
+	default:
+	}
+	timeout, ok := c.nextTimeout(time.Since(s.receivedAt))
+	if !ok {
+		visibilityExpirations.Add(1)
+		logp.Warn("SQS message with ID %s reached maximum visibility of %v with %d S3 objects and %d events pending. It will be visible again on queue", *s.MessageId, c.Max, s.s3objects, s.events)
+		return false
+	}
+	messageID := *s.MessageId
+	s.sqs.getBatcher().changeMessageVisibility(s.ReceiptHandle, timeout, func(err error) {
+		if err != nil {
+			visibilityExtensionErrors.Add(1)
+			logp.Warn("Couldn't extend visibility of SQS message with ID %s. Error: %v", messageID, err)
+			return
+		}
+		visibilityExtensions.Add(1)
+		logp.Debug("s3logsbeat", "Extended visibility of SQS message with ID %s by %v", messageID, timeout)
+	})
+	return true
 }
 
-// EventSent adds the number of events to the counter (to know the number of events pending to ACK)
-func (s *SQSMessage) EventSent() {
-	s.mutex.Lock()
-	s.events++
-	s.mutex.Unlock()
+// ExtractNewS3Objects extracts those new S3 objects present on an SQS message
+func (s *SQSMessage) ExtractNewS3Objects(mh func(s3object *S3Object) error) error {
+	s3event := aws.NewSQSMessageS3Event(s.SQSMessage)
+	if n := s3event.GetSNSNotification(); n != nil {
+		sqsMessagesSNS.Add(1)
+		logp.Debug("s3logsbeat", "SQS message with ID %s received thru SNS: %s", *s.MessageId, n.String())
+	}
+	if err := s.verifySNSSignature(s3event); err != nil {
+		snsVerificationErrors.Add(1)
+		logp.Err("Couldn't verify SNS signature of SQS message with ID %s. Error: %v", *s.MessageId, err)
+		s.fail(err)
+		return nil
+	}
+	// Message is kept invisible before objects are passed, as passing them can block until they are read
+	return s.extractNewS3Objects(s.sqs.S3ReaderInformation, s3event.ExtractNewObjects, func(o *S3Object) error {
+		s.keepInvisible()
+		return mh(o)
+	})
 }
 
-// EventACKed reduces the number of events to the counter (to know the number of events pending to ACK).
-// If all events have been processed, the SQS message is deleted.
-func (s *SQSMessage) EventACKed() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.events--
-	if s.events < 0 {
-		panic(fmt.Sprintf("Acked %d more events than added", -s.events))
+// verifySNSSignature verifies the SNS envelope of the message (if signature verification is enabled).
+// Messages which can not be verified (including those without SNS envelope) are retried as failed, so
+// they end on the dead-letter queue
+func (s *SQSMessage) verifySNSSignature(s3event *aws.SQSMessageS3Event) error {
+	if s.sqs.snsVerifier == nil {
+		return nil
 	}
-	s.deleteOnJobCompleted()
+	return s3event.VerifySNSSignature(s.sqs.snsVerifier)
 }
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+const (
+	// maxFailureReasonsSize maximum size of the failure reasons attached to messages sent to dead-letter queue
+	maxFailureReasonsSize = 4096
+
+	// Attributes of the messages sent to dead-letter queue
+	failureReasonsAttribute = "s3logsbeat.failures"
+	sourceQueueAttribute    = "s3logsbeat.source_queue"
+	receiveCountAttribute   = "s3logsbeat.receive_count"
+)
+
+var (
+	sqsMessagesFailed       = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.failed")
+	sqsMessagesDeadLettered = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.deadLettered")
+	sqsDeadLetterErrors     = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.deadLetterError")
+)
+
+// SQSRetryConfig configures what is done with SQS messages containing S3 objects which could not be
+// read. They are not deleted, but made visible again after a back-off based on the number of times
+// they have been received: from Backoff, doubled on each receive, up to MaxBackoff. Once received
+// MaxAttempts times, they are sent to DeadLetterQueueURL (if configured) with the failure reasons
+type SQSRetryConfig struct {
+	Backoff            time.Duration `config:"backoff" validate:"min=0, max=12h"`
+	MaxBackoff         time.Duration `config:"max_backoff" validate:"min=0, max=12h"`
+	MaxAttempts        int           `config:"max_attempts" validate:"min=0"`
+	DeadLetterQueueURL string        `config:"dead_letter_queue_url"`
+}
+
+// DefaultSQSRetryConfig retry config used if no one is configured
+var DefaultSQSRetryConfig = SQSRetryConfig{
+	Backoff:     30 * time.Second,
+	MaxBackoff:  15 * time.Minute,
+	MaxAttempts: 5,
+}
+
+// Validate validates retry config logic
+func (c *SQSRetryConfig) Validate() error {
+	if c.MaxBackoff < c.Backoff {
+		return fmt.Errorf("retry.max_backoff (%v) must be greater than or equal to retry.backoff (%v)", c.MaxBackoff, c.Backoff)
+	}
+	if c.DeadLetterQueueURL != "" && c.MaxAttempts == 0 {
+		return fmt.Errorf("retry.dead_letter_queue_url requires retry.max_attempts greater than 0")
+	}
+	return nil
+}
+
+// backoff obtains the time a message received receiveCount times is kept invisible before retrying it
+func (c *SQSRetryConfig) backoff(receiveCount int) time.Duration {
+	backoff := c.Backoff
+	for i := 1; i < receiveCount && backoff < c.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.MaxBackoff {
+		backoff = c.MaxBackoff
+	}
+	return backoff
+}
+
+// exhausted returns whether a message received receiveCount times has to be sent to dead-letter queue
+func (c *SQSRetryConfig) exhausted(receiveCount int) bool {
+	return c.DeadLetterQueueURL != "" && receiveCount >= c.MaxAttempts
+}
+
+// deadLetterAttributes obtains the attributes of a message sent to dead-letter queue
+func deadLetterAttributes(sourceQueue string, receiveCount int, failures []string) map[string]string {
+	reasons := strings.Join(failures, "\n")
+	if len(reasons) > maxFailureReasonsSize {
+		// Truncated on a rune boundary, as attributes must be valid UTF-8
+		i := maxFailureReasonsSize
+		for i > 0 && !utf8.RuneStart(reasons[i]) {
+			i--
+		}
+		reasons = reasons[:i]
+	}
+	return map[string]string{
+		failureReasonsAttribute: reasons,
+		sourceQueueAttribute:    sourceQueue,
+		receiveCountAttribute:   strconv.Itoa(receiveCount),
+	}
+}
@@ -0,0 +1,161 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func TestSQSRetryConfigBackoff(t *testing.T) {
+	c := &SQSRetryConfig{Backoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}
+	assert.Equal(t, 30*time.Second, c.backoff(1))
+	assert.Equal(t, time.Minute, c.backoff(2))
+	assert.Equal(t, 4*time.Minute, c.backoff(4))
+	assert.Equal(t, 5*time.Minute, c.backoff(5))
+	assert.Equal(t, 5*time.Minute, c.backoff(100))
+}
+
+func TestSQSRetryConfigValidate(t *testing.T) {
+	assert.NoError(t, (&SQSRetryConfig{Backoff: time.Second, MaxBackoff: time.Minute}).Validate())
+	assert.Error(t, (&SQSRetryConfig{Backoff: time.Minute, MaxBackoff: time.Second}).Validate())
+	assert.Error(t, (&SQSRetryConfig{DeadLetterQueueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/dlq"}).Validate())
+}
+
+func TestSQSRetryConfigExhausted(t *testing.T) {
+	c := &SQSRetryConfig{MaxAttempts: 3}
+	assert.False(t, c.exhausted(5), "Never exhausted without dead-letter queue")
+	c.DeadLetterQueueURL = "https://sqs.eu-west-1.amazonaws.com/123456789012/dlq"
+	assert.False(t, c.exhausted(2))
+	assert.True(t, c.exhausted(3))
+}
+
+func TestDeadLetterAttributesTruncated(t *testing.T) {
+	attributes := deadLetterAttributes("queue", 3, []string{strings.Repeat("a", maxFailureReasonsSize), "b"})
+	assert.Len(t, attributes[failureReasonsAttribute], maxFailureReasonsSize)
+	assert.Equal(t, "queue", attributes[sourceQueueAttribute])
+	assert.Equal(t, "3", attributes[receiveCountAttribute])
+
+	// Multi-byte characters are not split
+	attributes = deadLetterAttributes("queue", 3, []string{"a" + strings.Repeat("é", maxFailureReasonsSize)})
+	assert.Len(t, attributes[failureReasonsAttribute], maxFailureReasonsSize-1)
+	assert.True(t, utf8.ValidString(attributes[failureReasonsAttribute]))
+}
+
+func TestSQSMessageRetriedOnFailure(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, nil)
+	defer closeServer()
+	m.sqs.WithRetry(&SQSRetryConfig{Backoff: 30 * time.Second, MaxBackoff: time.Hour, MaxAttempts: 5})
+	m.Attributes = map[string]*string{"ApproximateReceiveCount": awssdk.String("2")}
+
+	m.s3objects = 2
+	m.S3ObjectFailed(errors.New("s3://bucket/a.log: access denied"))
+	m.S3ObjectProcessed()
+	m.S3ObjectProcessed()
+	m.sqs.Close()
+
+	actions, timeouts := requests.get()
+	assert.Equal(t, []string{"ChangeMessageVisibilityBatch"}, actions)
+	assert.Equal(t, []string{"60"}, timeouts)
+}
+
+func TestSQSMessageSentToDeadLetterQueue(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, nil)
+	defer closeServer()
+	dlq := strings.Replace(m.sqs.String(), "/logs", "/logs-dlq", 1)
+	m.sqs.WithRetry(&SQSRetryConfig{Backoff: 30 * time.Second, MaxBackoff: time.Hour, MaxAttempts: 3, DeadLetterQueueURL: dlq})
+	m.Attributes = map[string]*string{"ApproximateReceiveCount": awssdk.String("3")}
+
+	m.s3objects = 1
+	m.S3ObjectFailed(errors.New("s3://bucket/a.log: access denied"))
+	m.S3ObjectProcessed()
+	m.sqs.Close()
+
+	actions, _ := requests.get()
+	assert.Equal(t, []string{"SendMessage", "DeleteMessageBatch"}, actions)
+	if sends := requests.getSends(); assert.Len(t, sends, 1) {
+		assert.Equal(t, dlq, sends[0].Get("QueueUrl"))
+		assert.Equal(t, `{"Records":[]}`, sends[0].Get("MessageBody"))
+		attributes := map[string]string{}
+		for i := 1; sends[0].Get(fmt.Sprintf("MessageAttribute.%d.Name", i)) != ""; i++ {
+			n := fmt.Sprintf("MessageAttribute.%d", i)
+			attributes[sends[0].Get(n+".Name")] = sends[0].Get(n + ".Value.StringValue")
+		}
+		assert.Equal(t, "s3://bucket/a.log: access denied", attributes[failureReasonsAttribute])
+		assert.Equal(t, "3", attributes[receiveCountAttribute])
+	}
+}
+
+func TestSQSMessageDeletedWithoutFailures(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, nil)
+	defer closeServer()
+
+	m.s3objects = 1
+	m.S3ObjectProcessed()
+	m.sqs.Close()
+
+	actions, _ := requests.get()
+	assert.Equal(t, []string{"DeleteMessageBatch"}, actions)
+}
+
+func TestSQSMessageRetriedOnSNSVerificationError(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, nil)
+	defer closeServer()
+	m.sqs.WithRetry(&SQSRetryConfig{Backoff: 30 * time.Second, MaxBackoff: time.Hour, MaxAttempts: 5}).
+		WithSNSVerifier(aws.NewSNSVerifier())
+	m.Body = awssdk.String(`{"Type":"Notification","MessageId":"1","TopicArn":"arn:aws:sns:eu-west-1:123456789012:s3-logs",` +
+		`"Message":"{\"Records\":[{\"eventSource\":\"aws:s3\",\"s3\":{\"bucket\":{\"name\":\"b\"},\"object\":{\"key\":\"a.log\"}}}]}",` +
+		`"SignatureVersion":"1","Signature":"","SigningCertURL":"https://example.com/cert.pem"}`)
+
+	assert.NoError(t, m.ExtractNewS3Objects(func(s3object *S3Object) error {
+		t.Errorf("Unexpected object %s", s3object.String())
+		return nil
+	}))
+	m.sqs.Close()
+
+	actions, timeouts := requests.get()
+	assert.Equal(t, []string{"ChangeMessageVisibilityBatch"}, actions)
+	assert.Equal(t, []string{"30"}, timeouts)
+}
+
+func TestSQSMessageRetriedWithoutSNSEnvelopeWhenVerifying(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, nil)
+	defer closeServer()
+	m.sqs.WithRetry(&SQSRetryConfig{Backoff: 30 * time.Second, MaxBackoff: time.Hour, MaxAttempts: 5}).
+		WithSNSVerifier(aws.NewSNSVerifier())
+	// S3 event sent directly to the queue, which can not be verified
+	m.Body = awssdk.String(`{"Records":[{"eventSource":"aws:s3","s3":{"bucket":{"name":"b"},"object":{"key":"a.log"}}}]}`)
+
+	assert.NoError(t, m.ExtractNewS3Objects(func(s3object *S3Object) error {
+		t.Errorf("Unexpected object %s", s3object.String())
+		return nil
+	}))
+	m.sqs.Close()
+
+	actions, timeouts := requests.get()
+	assert.Equal(t, []string{"ChangeMessageVisibilityBatch"}, actions)
+	assert.Equal(t, []string{"30"}, timeouts)
+}
+
+func TestSQSMessageS3ObjectsUnwrappedFromSNS(t *testing.T) {
+	m, _, closeServer := newTestSQSMessage(t, nil)
+	defer closeServer()
+	m.Body = awssdk.String(`{"Type":"Notification","MessageId":"1","TopicArn":"arn:aws:sns:eu-west-1:123456789012:s3-logs",` +
+		`"Message":"{\"Records\":[{\"eventSource\":\"aws:s3\",\"s3\":{\"bucket\":{\"name\":\"b\"},\"object\":{\"key\":\"a.log\"}}}]}"}`)
+
+	var keys []string
+	assert.NoError(t, m.ExtractNewS3Objects(func(s3object *S3Object) error {
+		keys = append(keys, s3object.Key)
+		return nil
+	}))
+	assert.Equal(t, []string{"a.log"}, keys)
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+// ObjectStorage storage from which objects are listed and read. aws.S3 implements it
+type ObjectStorage interface {
+	// GetReadCloser returns a io.ReadCloser to be readed (and then closed) by another method
+	GetReadCloser(o *aws.S3Object) (io.ReadCloser, error)
+
+	// ListObjects lists objects present on o.Bucket and prefix o.Key
+	ListObjects(o *aws.S3Object, oh aws.S3ObjectHandler) (int, error)
+}
+
+// localStorage storage based on local filesystem. Buckets are directories and keys
+// are paths relative to them (using always slashes as separator)
+type localStorage struct {
+	pattern string
+}
+
+// NewLocalStorage creates a storage which reads objects from local filesystem
+func NewLocalStorage() ObjectStorage {
+	return &localStorage{}
+}
+
+// NewLocalGlobStorage creates a storage which reads objects from local filesystem, listing only
+// files matching glob pattern (and all files present on directories matching it)
+func NewLocalGlobStorage(pattern string) ObjectStorage {
+	return &localStorage{
+		pattern: pattern,
+	}
+}
+
+// GetReadCloser opens the file represented by o
+func (l *localStorage) GetReadCloser(o *aws.S3Object) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(o.Bucket, filepath.FromSlash(o.Key)))
+	if err != nil {
+		return nil, err
+	}
+	return aws.NewS3ReadCloser(f, "")
+}
+
+// ListObjects walks all regular files present on directory o.Bucket whose relative path
+// starts with o.Key. If storage has a pattern, only files matching it are listed
+func (l *localStorage) ListObjects(o *aws.S3Object, oh aws.S3ObjectHandler) (int, error) {
+	if l.pattern != "" {
+		return l.listGlob(o, oh)
+	}
+	return l.walk(o.Bucket, o, oh)
+}
+
+// listGlob walks files and directories matching pattern whose relative path to o.Bucket starts with o.Key
+func (l *localStorage) listGlob(o *aws.S3Object, oh aws.S3ObjectHandler) (int, error) {
+	matches, err := filepath.Glob(l.pattern)
+	if err != nil {
+		return 0, err
+	}
+	received := 0
+	for _, m := range matches {
+		n, err := l.walk(m, o, oh)
+		received += n
+		if err != nil {
+			return received, err
+		}
+	}
+	return received, nil
+}
+
+// walk walks all regular files present on root whose relative path to o.Bucket starts with o.Key
+func (l *localStorage) walk(root string, o *aws.S3Object, oh aws.S3ObjectHandler) (int, error) {
+	received := 0
+	prefix := filepath.FromSlash(o.Key)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(o.Bucket, p)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(rel, prefix) {
+			return nil
+		}
+		received++
+		return oh(aws.NewS3ObjectWithOriginal(o.Bucket, &s3.Object{
+			Key:          awssdk.String(filepath.ToSlash(rel)),
+			Size:         awssdk.Int64(info.Size()),
+			LastModified: awssdk.Time(info.ModTime()),
+		}))
+	})
+	return received, err
+}
@@ -0,0 +1,112 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func newTestLocalFiles(t *testing.T, files ...string) string {
+	dir, err := ioutil.TempDir("", "s3logsbeat-storage")
+	assert.NoError(t, err)
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		assert.NoError(t, ioutil.WriteFile(p, []byte(f+"\n"), 0600))
+	}
+	return dir
+}
+
+func listLocalKeys(t *testing.T, storage ObjectStorage, o *aws.S3Object) []string {
+	var keys []string
+	_, err := storage.ListObjects(o, func(o *aws.S3ObjectWithOriginal) error {
+		keys = append(keys, o.S3Object.Key)
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	return keys
+}
+
+func TestLocalStorageListObjects(t *testing.T) {
+	dir := newTestLocalFiles(t, "prod-app/a.log", "prod-app/b.log.gz", "test-app/c.log")
+	defer os.RemoveAll(dir)
+
+	keys := listLocalKeys(t, NewLocalStorage(), aws.NewS3Object(dir, "prod-"))
+	assert.Equal(t, []string{"prod-app/a.log", "prod-app/b.log.gz"}, keys)
+}
+
+func TestLocalGlobStorageListObjects(t *testing.T) {
+	dir := newTestLocalFiles(t, "prod-app/a.log", "prod-app/b.log.gz", "test-app/c.log", "test-app/sub/d.log")
+	defer os.RemoveAll(dir)
+
+	keys := listLocalKeys(t, NewLocalGlobStorage(filepath.Join(dir, "*", "*.log")), aws.NewS3Object(dir, ""))
+	assert.Equal(t, []string{"prod-app/a.log", "test-app/c.log"}, keys)
+
+	// Directories matching the pattern are walked
+	keys = listLocalKeys(t, NewLocalGlobStorage(filepath.Join(dir, "test-*")), aws.NewS3Object(dir, ""))
+	assert.Equal(t, []string{"test-app/c.log", "test-app/sub/d.log"}, keys)
+}
+
+// testTracker tracks objects whose key is not on processed
+type testTracker struct {
+	processed map[string]bool
+	tracked   []string
+}
+
+func (t *testTracker) Processed(o *aws.S3Object) bool {
+	return t.processed[o.Key]
+}
+
+func (t *testTracker) Track(o *aws.S3Object) S3ObjectProcessNotifications {
+	t.tracked = append(t.tracked, o.Key)
+	return NewS3ObjectProcessNotificationsIgnorer()
+}
+
+func TestS3ListerSkipsTrackedObjects(t *testing.T) {
+	dir := newTestLocalFiles(t, "logs/a.log", "logs/b.log")
+	defer os.RemoveAll(dir)
+
+	tracker := &testTracker{processed: map[string]bool{"logs/a.log": true}}
+	out := make(chan *S3Object, 10)
+	w := NewS3ListerWorker(nil, out, nopEventCounter{})
+	s3list := NewS3ListFromStorage(NewLocalStorage(), aws.NewS3Object(dir, ""), NewS3ReaderInformation(nil, nil, "alb"), time.Time{}, time.Now().Add(time.Hour))
+	w.onS3List(0, s3list.WithTracker(tracker))
+	close(out)
+
+	var keys []string
+	for o := range out {
+		keys = append(keys, o.Key)
+	}
+	assert.Equal(t, []string{"logs/b.log"}, keys)
+	assert.Equal(t, []string{"logs/b.log"}, tracker.tracked)
+}
+
+func TestS3ListerWaitsWhilePaused(t *testing.T) {
+	dir := newTestLocalFiles(t, "logs/a.log")
+	defer os.RemoveAll(dir)
+
+	ri := NewS3ReaderInformation(nil, nil, "alb").WithParseErrorThreshold(&ParseErrorThresholdConfig{Max: "1"})
+	ri.pause.pause(200 * time.Millisecond)
+	out := make(chan *S3Object, 10)
+	w := NewS3ListerWorker(nil, out, nopEventCounter{})
+	start := time.Now()
+	w.onS3List(0, NewS3ListFromStorage(NewLocalStorage(), aws.NewS3Object(dir, ""), ri, time.Time{}, time.Now().Add(time.Hour)))
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	assert.Len(t, out, 1)
+
+	// Stopping workers cancels the pause
+	ri.pause.pause(time.Hour)
+	close(w.done)
+	w.onS3List(0, NewS3ListFromStorage(NewLocalStorage(), aws.NewS3Object(dir, ""), ri, time.Time{}, time.Now().Add(time.Hour)))
+	assert.Len(t, out, 1)
+}
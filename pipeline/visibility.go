@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+var (
+	visibilityExtensions      = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.visibilityExtended")
+	visibilityExtensionErrors = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.visibilityExtensionError")
+	visibilityExpirations     = monitoring.NewUint(nil, "s3logsbeat.sqsMessages.visibilityExpired")
+)
+
+// SQSMaxVisibility maximum time a message can be kept invisible since it was received
+const SQSMaxVisibility = 12 * time.Hour
+
+// VisibilityExtensionConfig configures the heartbeat which keeps SQS messages invisible to other
+// consumers while their objects or events are outstanding. Once the message is received and each half
+// of Step, the visibility timeout of the message is extended to Step from now, until Max since the
+// message was received is reached. As the first extension replaces the visibility timeout of the queue,
+// Step does not depend on it. A Step of 0 disables the heartbeat
+type VisibilityExtensionConfig struct {
+	Step time.Duration `config:"step" validate:"min=0, max=12h"`
+	Max  time.Duration `config:"max" validate:"min=0, max=12h"`
+}
+
+// Validate validates visibility extension config logic
+func (c *VisibilityExtensionConfig) Validate() error {
+	if c.Step > 0 && c.Step < 2*time.Second {
+		return fmt.Errorf("visibility_extension.step (%v) must be at least 2s", c.Step)
+	}
+	if c.Max == 0 {
+		c.Max = SQSMaxVisibility
+	}
+	if c.Step > c.Max {
+		return fmt.Errorf("visibility_extension.step (%v) can not be greater than visibility_extension.max (%v)", c.Step, c.Max)
+	}
+	return nil
+}
+
+// nextTimeout obtains the visibility timeout to set on a message received receivedAgo, which is
+// lower than Step when close to Max. false is returned when Max has been reached
+func (c *VisibilityExtensionConfig) nextTimeout(receivedAgo time.Duration) (time.Duration, bool) {
+	timeout := c.Step
+	if remaining := c.Max - receivedAgo; remaining < timeout {
+		timeout = remaining
+	}
+	// Visibility timeout has a granularity of seconds
+	timeout = timeout.Truncate(time.Second)
+	return timeout, timeout > 0
+}
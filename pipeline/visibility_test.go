@@ -0,0 +1,203 @@
+// +build !integration
+
+package pipeline
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sequra/s3logsbeat/aws"
+)
+
+func TestVisibilityExtensionConfigValidate(t *testing.T) {
+	c := &VisibilityExtensionConfig{Step: time.Minute}
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, SQSMaxVisibility, c.Max)
+
+	assert.Error(t, (&VisibilityExtensionConfig{Step: time.Second}).Validate())
+	assert.Error(t, (&VisibilityExtensionConfig{Step: time.Hour, Max: time.Minute}).Validate())
+	assert.NoError(t, (&VisibilityExtensionConfig{}).Validate())
+}
+
+func TestVisibilityExtensionConfigNextTimeout(t *testing.T) {
+	c := &VisibilityExtensionConfig{Step: time.Minute, Max: 10 * time.Minute}
+
+	timeout, ok := c.nextTimeout(30 * time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, timeout)
+
+	timeout, ok = c.nextTimeout(9*time.Minute + 30500*time.Millisecond)
+	assert.True(t, ok)
+	assert.Equal(t, 29*time.Second, timeout)
+
+	_, ok = c.nextTimeout(10*time.Minute - 500*time.Millisecond)
+	assert.False(t, ok)
+	_, ok = c.nextTimeout(11 * time.Minute)
+	assert.False(t, ok)
+}
+
+// sqsRequests records actions requested to SQS queues
+type sqsRequests struct {
+	mutex   sync.Mutex
+	actions []string
+	timeout []string
+	sends   []url.Values
+}
+
+func (s *sqsRequests) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r.ParseForm()
+	action := r.Form.Get("Action")
+	s.actions = append(s.actions, action)
+	result := ""
+	switch action {
+	case "ChangeMessageVisibilityBatch":
+		s.timeout = append(s.timeout, r.Form.Get("ChangeMessageVisibilityBatchRequestEntry.1.VisibilityTimeout"))
+	case "SendMessage":
+		s.sends = append(s.sends, r.Form)
+		result = fmt.Sprintf("<SendMessageResult><MD5OfMessageBody>%x</MD5OfMessageBody><MessageId>dlq</MessageId></SendMessageResult>", md5.Sum([]byte(r.Form.Get("MessageBody"))))
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte("<" + action + "Response>" + result + "<ResponseMetadata><RequestId>id</RequestId></ResponseMetadata></" + action + "Response>"))
+}
+
+func (s *sqsRequests) get() ([]string, []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.actions...), append([]string{}, s.timeout...)
+}
+
+func (s *sqsRequests) getSends() []url.Values {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]url.Values{}, s.sends...)
+}
+
+func newTestSQSMessage(t *testing.T, c *VisibilityExtensionConfig) (*SQSMessage, *sqsRequests, func()) {
+	requests := &sqsRequests{}
+	server := httptest.NewServer(requests)
+	sess, err := session.NewSession(&awssdk.Config{
+		Region:      awssdk.String("eu-west-1"),
+		Endpoint:    awssdk.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	assert.NoError(t, err)
+	queue := NewSQS(sess, awssdk.String(server.URL+"/123456789012/logs"), &S3ReaderInformation{}).
+		WithVisibilityExtension(c).
+		WithBatch(&SQSBatchConfig{FlushInterval: 100 * time.Millisecond})
+	message := NewSQSMessage(queue, &aws.SQSMessage{Message: &sqs.Message{
+		MessageId:     awssdk.String("id"),
+		ReceiptHandle: awssdk.String("receipt"),
+		Body:          awssdk.String(`{"Records":[]}`),
+	}}, false)
+	return message, requests, server.Close
+}
+
+func TestSQSMessageVisibilityExtendedUntilDeleted(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, &VisibilityExtensionConfig{Step: 2 * time.Second, Max: time.Hour})
+	defer closeServer()
+
+	m.s3objects = 1
+	m.keepInvisible()
+	time.Sleep(1500 * time.Millisecond)
+	m.S3ObjectProcessed()
+	m.sqs.Close()
+
+	// Extended when heartbeat starts and after half of the step
+	actions, timeouts := requests.get()
+	assert.Equal(t, []string{"ChangeMessageVisibilityBatch", "ChangeMessageVisibilityBatch", "DeleteMessageBatch"}, actions)
+	assert.Equal(t, []string{"2", "2"}, timeouts)
+}
+
+func TestSQSMessageVisibilityExtendedOnReceive(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, &VisibilityExtensionConfig{Step: time.Hour, Max: 12 * time.Hour})
+	defer closeServer()
+	m.Body = awssdk.String(`{"Records":[{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"mybucket"},"object":{"key":"a.log","size":10}}}]}`)
+
+	// Visibility is extended before the objects of the message are passed (which can block while
+	// previous objects are read), without waiting for half of the step
+	passed, extracted := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(extracted)
+		assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+			<-passed
+			return nil
+		}))
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, timeouts := requests.get(); len(timeouts) == 0 && time.Now().Before(deadline); _, timeouts = requests.get() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, timeouts := requests.get()
+	assert.Equal(t, []string{"3600"}, timeouts)
+
+	close(passed)
+	<-extracted
+	m.S3ObjectProcessed()
+	m.sqs.Close()
+}
+
+func TestSQSMessageVisibilityExtendedWhileObjectsArePassed(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, &VisibilityExtensionConfig{Step: 2 * time.Second, Max: time.Hour})
+	defer closeServer()
+	m.Body = awssdk.String(`{"Records":[{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"mybucket"},"object":{"key":"a.log","size":10}}},{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"mybucket"},"object":{"key":"b.log","size":10}}}]}`)
+
+	// Passing an object blocks longer than the step while readers notify their progress: neither
+	// readers nor the visibility extension must wait for the extraction to finish
+	var passed int
+	assert.NoError(t, m.ExtractNewS3Objects(func(o *S3Object) error {
+		passed++
+		if passed > 1 {
+			return nil
+		}
+		sent := make(chan struct{})
+		go func() {
+			m.EventSent()
+			close(sent)
+		}()
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Error("Event could not be notified while objects are passed")
+		}
+		time.Sleep(2500 * time.Millisecond)
+		actions, _ := requests.get()
+		assert.True(t, len(actions) > 1, "Visibility extended %d times while object was passed", len(actions))
+		return nil
+	}))
+	assert.Equal(t, 2, passed)
+
+	m.S3ObjectProcessed()
+	m.EventACKed()
+	m.S3ObjectProcessed()
+	m.sqs.Close()
+	actions, _ := requests.get()
+	assert.Equal(t, "DeleteMessageBatch", actions[len(actions)-1])
+}
+
+func TestSQSMessageVisibilityExpired(t *testing.T) {
+	m, requests, closeServer := newTestSQSMessage(t, &VisibilityExtensionConfig{Step: time.Minute, Max: time.Hour})
+	defer closeServer()
+
+	m.s3objects = 1
+	m.receivedAt = time.Now().Add(-time.Hour)
+	expirations := visibilityExpirations.Get()
+	assert.False(t, m.extendVisibility(m.sqs.visibilityExtension))
+	assert.Equal(t, expirations+1, visibilityExpirations.Get())
+
+	actions, _ := requests.get()
+	assert.Empty(t, actions)
+}